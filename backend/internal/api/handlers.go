@@ -1,12 +1,25 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"gamecloud/internal/direct"
 	"gamecloud/internal/download"
+	"gamecloud/internal/hooks"
 	"gamecloud/internal/middleware"
 	"gamecloud/internal/models"
 	"gamecloud/internal/search"
+	"gamecloud/internal/torrent"
+	"io"
 	"log"
+	"mime"
 	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -216,9 +229,30 @@ func createDownload(db *gorm.DB, dm *download.Manager) gin.HandlerFunc {
 			return
 		}
 
-		// Проверяем наличие magnet URL или torrent URL
-		if download.MagnetURL == "" && download.TorrentURL == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Either magnet_url or torrent_url is required"})
+		// Проверяем наличие magnet URL, torrent URL или прямой ссылки
+		if download.MagnetURL == "" && download.TorrentURL == "" && download.DirectURL == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Either magnet_url, torrent_url or direct_url is required"})
+			return
+		}
+
+		if download.DirectURL != "" {
+			if !direct.ValidURL(download.DirectURL) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid direct_url: expected an absolute http or https URL"})
+				return
+			}
+			if err := direct.ValidateChecksum(download.Checksum); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if !torrent.ValidStorage(download.StorageBackend) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid storage_backend: expected file, mmap or piece"})
+			return
+		}
+
+		if err := torrent.ValidateWebSeeds(download.WebSeeds); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
@@ -237,126 +271,988 @@ func createDownload(db *gorm.DB, dm *download.Manager) gin.HandlerFunc {
 		download.Status = "queued"
 		download.Progress = 0.0
 
-		if err := dm.AddDownload(&download); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := dm.AddDownload(&download); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Возвращаем download с включенной информацией об игре
+		if err := db.Preload("Game").First(&download, "id = ?", download.ID).Error; err != nil {
+			log.Printf("Failed to reload download with game info: %v", err)
+		}
+
+		c.JSON(http.StatusCreated, download)
+	}
+}
+
+func pauseDownload(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid download ID"})
+			return
+		}
+
+		if err := dm.PauseDownload(id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Download paused"})
+	}
+}
+
+func resumeDownload(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid download ID"})
+			return
+		}
+
+		if err := dm.ResumeDownload(id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Download resumed"})
+	}
+}
+
+func retryDownload(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dl, ok := ownedDownload(c, dm)
+		if !ok {
+			return
+		}
+
+		if err := dm.RetryDownload(dl.ID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Download not found"})
+				return
+			}
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Download queued for retry"})
+	}
+}
+
+func getDownloadProgress(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, _, ok := middleware.GetUserFromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+			return
+		}
+
+		// Получаем все активные загрузки
+		activeDownloads := dm.GetActiveDownloads()
+
+		// Фильтруем по пользователю и формируем ответ
+		var progressList []gin.H
+		for _, job := range activeDownloads {
+			if job.Download.UserID == userID {
+				progressInfo := gin.H{
+					"id":               job.Download.ID,
+					"game_id":          job.Download.GameID,
+					"game_title":       job.Download.Game.Title,
+					"status":           job.Download.Status,
+					"progress":         job.Download.Progress,
+					"downloaded_bytes": job.Download.DownloadedBytes,
+					"total_bytes":      job.Download.TotalBytes,
+					"download_speed":   job.Download.DownloadSpeed,
+					"upload_speed":     job.Download.UploadSpeed,
+					"eta":              job.Download.ETA,
+					"peers_connected":  job.Download.PeersConnected,
+					"seeds_connected":  job.Download.SeedsConnected,
+				}
+				progressList = append(progressList, progressInfo)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"active_downloads": progressList,
+			"total_active":     len(progressList),
+		})
+	}
+}
+
+func cancelDownload(db *gorm.DB, dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid download ID"})
+			return
+		}
+
+		userID, _, _, ok := middleware.GetUserFromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+			return
+		}
+
+		// Отменяем загрузку в download manager
+		if err := dm.CancelDownload(id); err != nil {
+			log.Printf("Failed to cancel download in manager: %v", err)
+		}
+
+		// Удаляем запись из базы данных
+		result := db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Download{})
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+			return
+		}
+
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Download not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Download cancelled and removed"})
+	}
+}
+
+// Torrent handlers
+func inspectTorrent(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var preview *torrent.TorrentPreview
+		var err error
+
+		if file, fileErr := c.FormFile("torrent"); fileErr == nil {
+			// Загружен .torrent файл
+			src, openErr := file.Open()
+			if openErr != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open torrent file"})
+				return
+			}
+			defer src.Close()
+
+			preview, err = dm.InspectTorrentFile(src)
+		} else {
+			var req struct {
+				MagnetURL  string `json:"magnet_url" form:"magnet_url"`
+				TorrentURL string `json:"torrent_url" form:"torrent_url"`
+			}
+			if err := c.ShouldBind(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			switch {
+			case req.MagnetURL != "":
+				preview, err = dm.InspectMagnet(c.Request.Context(), req.MagnetURL)
+			case strings.HasPrefix(req.TorrentURL, "http://") || strings.HasPrefix(req.TorrentURL, "https://"):
+				preview, err = dm.InspectTorrentURL(c.Request.Context(), req.TorrentURL)
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Either torrent file, magnet_url or http(s) torrent_url is required"})
+				return
+			}
+		}
+
+		if err != nil {
+			var httpErr *torrent.HTTPStatusError
+			switch {
+			case errors.Is(err, torrent.ErrInvalidTorrent):
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			case errors.Is(err, torrent.ErrMetadataTimeout):
+				c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+			case errors.As(err, &httpErr):
+				c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, preview)
+	}
+}
+
+func createTorrent(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, _, ok := middleware.GetUserFromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+			return
+		}
+
+		var req download.CreateTorrentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		dl, err := dm.CreateTorrent(userID, req)
+		if err != nil {
+			switch {
+			case errors.Is(err, download.ErrNotSupported):
+				c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			case errors.Is(err, download.ErrPathNotAllowed):
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			case errors.Is(err, os.ErrNotExist):
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Path does not exist"})
+			case errors.Is(err, torrent.ErrInvalidTracker):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": "Game not found"})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		// Хеширование идет в фоне; прогресс приходит по WebSocket
+		c.JSON(http.StatusAccepted, dl)
+	}
+}
+
+func getDownloadTorrentFile(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dl, ok := ownedDownload(c, dm)
+		if !ok {
+			return
+		}
+
+		data, err := dm.GetTorrentFile(dl)
+		if err != nil {
+			torrentError(c, err)
+			return
+		}
+
+		name := dl.Game.Title
+		if name == "" {
+			name = dl.InfoHash
+		}
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".torrent"}))
+		c.Data(http.StatusOK, "application/x-bittorrent", data)
+	}
+}
+
+// importDownload подключает существующие данные игры: JSON с magnet_url или torrent_url
+// либо multipart-форма с .torrent файлом в поле torrent
+func importDownload(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, _, ok := middleware.GetUserFromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+			return
+		}
+
+		var req download.ImportRequest
+		var torrentData []byte
+		var torrentName string
+		if c.ContentType() == "multipart/form-data" {
+			file, err := c.FormFile("torrent")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "No torrent file provided"})
+				return
+			}
+			gameID, err := uuid.Parse(c.PostForm("game_id"))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid game ID format"})
+				return
+			}
+			req.GameID = gameID
+			req.Path = c.PostForm("path")
+			if req.Path == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Path is required"})
+				return
+			}
+
+			src, err := file.Open()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open torrent file"})
+				return
+			}
+			defer src.Close()
+			if torrentData, err = io.ReadAll(src); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read torrent file"})
+				return
+			}
+			torrentName = file.Filename
+		} else if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		dl, err := dm.ImportDownload(userID, req, torrentData, torrentName)
+		if err != nil {
+			switch {
+			case errors.Is(err, download.ErrNotSupported):
+				c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			case errors.Is(err, download.ErrPathNotAllowed):
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			case errors.Is(err, os.ErrNotExist):
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Path does not exist"})
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": "Game not found"})
+			case errors.Is(err, torrent.ErrTorrentActive):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			case errors.Is(err, torrent.ErrInvalidTorrent):
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		// Проверка данных идет в фоне; прогресс приходит по WebSocket со статусом checking
+		c.JSON(http.StatusAccepted, dl)
+	}
+}
+
+// Tracker handlers
+
+// torrentError отвечает на ошибку операции с торрентом активной загрузки
+func torrentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Download not found"})
+	case errors.Is(err, torrent.ErrTorrentNotFound):
+		c.JSON(http.StatusConflict, gin.H{"error": "Download is not active"})
+	case errors.Is(err, download.ErrNotSupported):
+		c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+	case errors.Is(err, torrent.ErrInvalidTracker):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, torrent.ErrTrackerNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, torrent.ErrInvalidWebSeed):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func getDownloadTrackers(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dl, ok := ownedDownload(c, dm)
+		if !ok {
+			return
+		}
+
+		trackers, err := dm.GetTrackers(dl.ID)
+		if err != nil {
+			torrentError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, trackers)
+	}
+}
+
+func addDownloadTracker(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dl, ok := ownedDownload(c, dm)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			URL string `json:"url" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := dm.AddTracker(dl.ID, strings.TrimSpace(req.URL)); err != nil {
+			torrentError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Tracker added"})
+	}
+}
+
+func removeDownloadTracker(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dl, ok := ownedDownload(c, dm)
+		if !ok {
+			return
+		}
+
+		trackerURL := c.Query("url")
+		if trackerURL == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "url query parameter is required"})
+			return
+		}
+
+		if err := dm.RemoveTracker(dl.ID, trackerURL); err != nil {
+			torrentError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Tracker removed"})
+	}
+}
+
+func getDownloadWebSeeds(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dl, ok := ownedDownload(c, dm)
+		if !ok {
+			return
+		}
+
+		webSeeds, err := dm.GetWebSeeds(dl.ID)
+		if err != nil {
+			torrentError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"web_seeds": webSeeds})
+	}
+}
+
+func addDownloadWebSeeds(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dl, ok := ownedDownload(c, dm)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			URLs []string `json:"urls" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		urls := make([]string, 0, len(req.URLs))
+		for _, u := range req.URLs {
+			if u = strings.TrimSpace(u); u != "" {
+				urls = append(urls, u)
+			}
+		}
+		if len(urls) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "At least one web seed URL is required"})
+			return
+		}
+
+		if err := dm.AddWebSeeds(dl.ID, urls); err != nil {
+			torrentError(c, err)
+			return
+		}
+
+		webSeeds, _ := dm.GetWebSeeds(dl.ID)
+		c.JSON(http.StatusOK, gin.H{"web_seeds": webSeeds})
+	}
+}
+
+func reannounceDownload(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dl, ok := ownedDownload(c, dm)
+		if !ok {
+			return
+		}
+
+		if err := dm.Reannounce(dl.ID); err != nil {
+			torrentError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"message": "Reannounce requested"})
+	}
+}
+
+func getDefaultTrackers(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		trackers, err := dm.GetDefaultTrackers()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"trackers": trackers})
+	}
+}
+
+func updateDefaultTrackers(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Trackers []string `json:"trackers"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		trackers := make([]string, 0, len(req.Trackers))
+		for _, u := range req.Trackers {
+			if u = strings.TrimSpace(u); u != "" {
+				trackers = append(trackers, u)
+			}
+		}
+
+		if err := dm.SetDefaultTrackers(trackers); err != nil {
+			torrentError(c, err)
+			return
+		}
+
+		trackers, _ = dm.GetDefaultTrackers()
+		c.JSON(http.StatusOK, gin.H{"trackers": trackers})
+	}
+}
+
+func getDownloadPieces(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dl, ok := ownedDownload(c, dm)
+		if !ok {
+			return
+		}
+
+		pieceMap, err := dm.GetPieceMap(dl.ID)
+		if err != nil {
+			torrentError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, pieceMap)
+	}
+}
+
+func getDownloadFiles(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dl, ok := ownedDownload(c, dm)
+		if !ok {
+			return
+		}
+
+		files, err := dm.GetFiles(dl.ID)
+		if err != nil {
+			torrentError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, files)
+	}
+}
+
+// streamDownloadFile отдает файл загрузки с поддержкой Range. Недостающие части
+// скачиваются в первую очередь, запрос ждет их появления.
+func streamDownloadFile(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dl, ok := ownedDownload(c, dm)
+		if !ok {
+			return
+		}
+		index, err := strconv.Atoi(c.Param("index"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file index"})
+			return
+		}
+
+		file, err := dm.OpenFile(c.Request.Context(), dl.ID, index)
+		if err != nil {
+			switch {
+			case errors.Is(err, torrent.ErrFileNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, torrent.ErrInfoNotReady):
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			default:
+				torrentError(c, err)
+			}
+			return
+		}
+		defer file.Close()
+
+		name := path.Base(file.Path)
+		c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": name}))
+		http.ServeContent(c.Writer, c.Request, name, time.Time{}, file)
+	}
+}
+
+func setDownloadSequential(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dl, ok := ownedDownload(c, dm)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Enabled *bool `json:"enabled" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := dm.SetSequential(dl.ID, *req.Enabled); err != nil {
+			torrentError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"sequential": *req.Enabled})
+	}
+}
+
+// Content handlers
+
+// ownedDownload загружает загрузку из параметра :id и проверяет, что она принадлежит
+// пользователю (администратору доступны все загрузки). При ошибке ответ уже отправлен.
+func ownedDownload(c *gin.Context, dm *download.Manager) (*models.Download, bool) {
+	userID, _, role, ok := middleware.GetUserFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		return nil, false
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid download ID"})
+		return nil, false
+	}
+
+	dl, err := dm.GetDownload(id)
+	if err != nil || (dl.UserID != userID && role != "admin") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Download not found"})
+		return nil, false
+	}
+	return dl, true
+}
+
+// contentRoot возвращает путь к файлам завершенной загрузки. При ошибке ответ уже отправлен.
+func contentRoot(c *gin.Context, dl *models.Download) (string, bool) {
+	root, err := download.ContentRoot(dl)
+	if err != nil {
+		if errors.Is(err, download.ErrContentNotReady) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		}
+		return "", false
+	}
+	return root, true
+}
+
+func getDownloadContent(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dl, ok := ownedDownload(c, dm)
+		if !ok {
+			return
+		}
+		root, ok := contentRoot(c, dl)
+		if !ok {
+			return
+		}
+
+		tree, err := download.ListContent(root)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, tree)
+	}
+}
+
+// getDownloadContentFile отдает файл завершенной загрузки с поддержкой Range и ETag
+func getDownloadContentFile(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dl, ok := ownedDownload(c, dm)
+		if !ok {
+			return
+		}
+		root, ok := contentRoot(c, dl)
+		if !ok {
+			return
+		}
+
+		name := c.Query("path")
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "path query parameter is required"})
+			return
+		}
+
+		file, info, err := download.OpenContentFile(root, name)
+		if err != nil {
+			if errors.Is(err, download.ErrContentNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		defer file.Close()
+
+		// ServeContent сам обрабатывает If-None-Match, If-Range и Range
+		c.Header("ETag", download.ContentETag(info))
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": info.Name()}))
+		http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), file)
+	}
+}
+
+// getDownloadArchive отдает всю игру одним zip или tar архивом, собранным на лету
+func getDownloadArchive(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dl, ok := ownedDownload(c, dm)
+		if !ok {
+			return
+		}
+
+		format := c.DefaultQuery("format", download.ArchiveZip)
+		contentType := map[string]string{
+			download.ArchiveZip: "application/zip",
+			download.ArchiveTar: "application/x-tar",
+		}[format]
+		if contentType == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format: expected zip or tar"})
+			return
+		}
+
+		root, ok := contentRoot(c, dl)
+		if !ok {
+			return
+		}
+
+		name := dl.Game.Title
+		if name == "" {
+			name = filepath.Base(root)
+		}
+		name = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`/\:*?"<>|`, r) {
+				return '_'
+			}
+			return r
+		}, name)
+
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + "." + format}))
+		c.Status(http.StatusOK)
+
+		// Размер архива заранее неизвестен; после начала ответа ошибку можно только залогировать
+		if err := download.WriteArchive(c.Request.Context(), c.Writer, root, format, name); err != nil {
+			log.Printf("Failed to stream %s archive for download %s: %v", format, dl.ID, err)
+		}
+	}
+}
+
+// Peer handlers
+func getDownloadPeers(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dl, ok := ownedDownload(c, dm)
+		if !ok {
+			return
+		}
+
+		peers, err := dm.GetPeers(dl.ID)
+		if err != nil {
+			torrentError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, peers)
+	}
+}
+
+func getDownloadPeerBans(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dl, ok := ownedDownload(c, dm)
+		if !ok {
+			return
+		}
+
+		bans, err := dm.GetPeerBans(dl.ID)
+		if err != nil {
+			torrentError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, bans)
+	}
+}
+
+func banDownloadPeer(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, username, role, ok := middleware.GetUserFromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+			return
+		}
+
+		dl, ok := ownedDownload(c, dm)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			IP     string `json:"ip" binding:"required"`
+			Global bool   `json:"global"` // бан для всех торрентов
+			Reason string `json:"reason"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Глобальный бан затрагивает загрузки всех пользователей
+		if req.Global && role != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can ban peers globally"})
+			return
+		}
+
+		ban, err := dm.BanPeer(dl.ID, req.IP, req.Global, req.Reason, username)
+		if err != nil {
+			switch {
+			case errors.Is(err, torrent.ErrInvalidPeerIP):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case errors.Is(err, download.ErrBanExists):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				torrentError(c, err)
+			}
+			return
+		}
+
+		c.JSON(http.StatusCreated, ban)
+	}
+}
+
+func unbanDownloadPeer(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, _, role, ok := middleware.GetUserFromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+			return
+		}
+
+		dl, ok := ownedDownload(c, dm)
+		if !ok {
+			return
+		}
+		banID, err := uuid.Parse(c.Param("banId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ban ID"})
+			return
+		}
+
+		ban, err := dm.GetPeerBan(banID)
+		if err != nil || (ban.InfoHash != "" && ban.InfoHash != dl.InfoHash) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Ban not found"})
+			return
+		}
+		if ban.InfoHash == "" && role != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can remove global bans"})
 			return
 		}
 
-		// Возвращаем download с включенной информацией об игре
-		if err := db.Preload("Game").First(&download, "id = ?", download.ID).Error; err != nil {
-			log.Printf("Failed to reload download with game info: %v", err)
+		if err := dm.UnbanPeer(ban); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
 
-		c.JSON(http.StatusCreated, download)
+		c.JSON(http.StatusOK, gin.H{"message": "Peer unbanned"})
 	}
 }
 
-func pauseDownload(dm *download.Manager) gin.HandlerFunc {
+func getBlocklists(dm *download.Manager) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id, err := uuid.Parse(c.Param("id"))
+		status, err := dm.GetBlocklistStatus()
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid download ID"})
-			return
-		}
-
-		if err := dm.PauseDownload(id); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			blocklistError(c, err)
 			return
 		}
-
-		c.JSON(http.StatusOK, gin.H{"message": "Download paused"})
+		c.JSON(http.StatusOK, status)
 	}
 }
 
-func resumeDownload(dm *download.Manager) gin.HandlerFunc {
+func uploadBlocklist(dm *download.Manager) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id, err := uuid.Parse(c.Param("id"))
+		file, err := c.FormFile("blocklist")
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid download ID"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No blocklist file provided"})
 			return
 		}
 
-		if err := dm.ResumeDownload(id); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		src, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open blocklist file"})
 			return
 		}
+		defer src.Close()
+
+		// Имя можно задать явно, чтобы заменить ранее загруженный список
+		name := c.PostForm("name")
+		if name == "" {
+			name = file.Filename
+		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Download resumed"})
+		status, err := dm.UploadBlocklist(name, src)
+		if err != nil {
+			blocklistError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, status)
 	}
 }
 
-func getDownloadProgress(dm *download.Manager) gin.HandlerFunc {
+func reloadBlocklists(dm *download.Manager) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID, _, _, ok := middleware.GetUserFromContext(c)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		status, err := dm.ReloadBlocklists()
+		if err != nil {
+			blocklistError(c, err)
 			return
 		}
+		c.JSON(http.StatusOK, status)
+	}
+}
 
-		// Получаем все активные загрузки
-		activeDownloads := dm.GetActiveDownloads()
-
-		// Фильтруем по пользователю и формируем ответ
-		var progressList []gin.H
-		for _, job := range activeDownloads {
-			if job.Download.UserID == userID {
-				progressInfo := gin.H{
-					"id":               job.Download.ID,
-					"game_id":          job.Download.GameID,
-					"game_title":       job.Download.Game.Title,
-					"status":           job.Download.Status,
-					"progress":         job.Download.Progress,
-					"downloaded_bytes": job.Download.DownloadedBytes,
-					"total_bytes":      job.Download.TotalBytes,
-					"download_speed":   job.Download.DownloadSpeed,
-					"upload_speed":     job.Download.UploadSpeed,
-					"eta":              job.Download.ETA,
-					"peers_connected":  job.Download.PeersConnected,
-					"seeds_connected":  job.Download.SeedsConnected,
-				}
-				progressList = append(progressList, progressInfo)
-			}
+func deleteBlocklist(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, err := dm.DeleteBlocklist(c.Param("name"))
+		if err != nil {
+			blocklistError(c, err)
+			return
 		}
+		c.JSON(http.StatusOK, status)
+	}
+}
 
-		c.JSON(http.StatusOK, gin.H{
-			"active_downloads": progressList,
-			"total_active":     len(progressList),
-		})
+func blocklistError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, download.ErrNotSupported):
+		c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+	case errors.Is(err, torrent.ErrInvalidBlocklist):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, torrent.ErrBlocklistNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 	}
 }
 
-func cancelDownload(db *gorm.DB, dm *download.Manager) gin.HandlerFunc {
+func getPeerBans(dm *download.Manager) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id, err := uuid.Parse(c.Param("id"))
+		bans, err := dm.GetAllPeerBans()
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid download ID"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		c.JSON(http.StatusOK, bans)
+	}
+}
 
-		userID, _, _, ok := middleware.GetUserFromContext(c)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+func deletePeerBan(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		banID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ban ID"})
 			return
 		}
 
-		// Отменяем загрузку в download manager
-		if err := dm.CancelDownload(id); err != nil {
-			log.Printf("Failed to cancel download in manager: %v", err)
-		}
-
-		// Удаляем запись из базы данных
-		result := db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Download{})
-		if result.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		ban, err := dm.GetPeerBan(banID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Ban not found"})
 			return
 		}
 
-		if result.RowsAffected == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Download not found"})
+		if err := dm.UnbanPeer(ban); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Download cancelled and removed"})
+		c.JSON(http.StatusOK, gin.H{"message": "Peer unbanned"})
 	}
 }
 
@@ -436,6 +1332,27 @@ func createDownloadFromTorrentFile(db *gorm.DB, dm *download.Manager) gin.Handle
 			return
 		}
 
+		storageBackend := c.PostForm("storage_backend")
+		if !torrent.ValidStorage(storageBackend) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid storage_backend: expected file, mmap or piece"})
+			return
+		}
+
+		sequential := false
+		if value := c.PostForm("sequential"); value != "" {
+			if sequential, err = strconv.ParseBool(value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sequential value"})
+				return
+			}
+		}
+
+		// Веб-сиды передаются повторяющимся полем web_seeds
+		webSeeds := c.PostFormArray("web_seeds")
+		if err := torrent.ValidateWebSeeds(webSeeds); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		// Проверяем существование игры
 		var game models.Game
 		if err := db.First(&game, "id = ? AND user_id = ?", gameID, userID).Error; err != nil {
@@ -457,11 +1374,14 @@ func createDownloadFromTorrentFile(db *gorm.DB, dm *download.Manager) gin.Handle
 
 		// Создаем download объект
 		download := models.Download{
-			UserID:     userID,
-			GameID:     gameID,
-			TorrentURL: file.Filename,
-			Status:     "queued",
-			Progress:   0.0,
+			UserID:         userID,
+			GameID:         gameID,
+			TorrentURL:     file.Filename,
+			StorageBackend: storageBackend,
+			Sequential:     sequential,
+			WebSeeds:       webSeeds,
+			Status:         "queued",
+			Progress:       0.0,
 		}
 
 		// Добавляем через новый метод для торрент-файлов
@@ -522,33 +1442,87 @@ func getStats(db *gorm.DB, dm *download.Manager) gin.HandlerFunc {
 			return
 		}
 
-		// Получаем общий размер загруженных данных
-		var totalDownloadedSize int64
+		// Объемы переданных данных: за все время и с момента запуска сервера, а также
+		// текущие скорости
+		var totals struct {
+			Downloaded        int64
+			Uploaded          int64
+			SessionDownloaded int64
+			SessionUploaded   int64
+			DownloadSpeed     int64
+			UploadSpeed       int64
+		}
 		if err := db.Model(&models.Download{}).
-			Where("user_id = ? AND status = ?", userID, "completed").
-			Select("COALESCE(SUM(downloaded_size), 0)").
-			Scan(&totalDownloadedSize).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate downloaded size"})
+			Where("user_id = ?", userID).
+			Select("COALESCE(SUM(downloaded_bytes), 0) AS downloaded, " +
+				"COALESCE(SUM(uploaded_bytes), 0) AS uploaded, " +
+				"COALESCE(SUM(session_downloaded), 0) AS session_downloaded, " +
+				"COALESCE(SUM(session_uploaded), 0) AS session_uploaded, " +
+				"COALESCE(SUM(download_speed), 0) AS download_speed, " +
+				"COALESCE(SUM(upload_speed), 0) AS upload_speed").
+			Scan(&totals).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate transfer totals"})
 			return
 		}
 
-		// Получаем общий размер отданных данных (upload)
-		var totalUploadSize int64
-		// Пока просто возвращаем 0, так как в модели нет поля для upload
-		// TODO: Добавить поле uploaded_size в модель Download
-
 		stats := gin.H{
-			"total_games":           totalGames,
-			"active_downloads":      activeDownloads,
-			"completed_downloads":   completedDownloads,
-			"total_downloaded_size": totalDownloadedSize,
-			"total_upload_size":     totalUploadSize,
+			"total_games":             totalGames,
+			"active_downloads":        activeDownloads,
+			"completed_downloads":     completedDownloads,
+			"total_downloaded_size":   totals.Downloaded,
+			"total_upload_size":       totals.Uploaded,
+			"session_downloaded_size": totals.SessionDownloaded,
+			"session_upload_size":     totals.SessionUploaded,
+			"download_rate":           totals.DownloadSpeed,
+			"upload_rate":             totals.UploadSpeed,
 		}
 
 		c.JSON(http.StatusOK, stats)
 	}
 }
 
+func getStatsTimeseries(dm *download.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, _, ok := middleware.GetUserFromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+			return
+		}
+
+		rng, err := download.ParseTimeseriesDuration(c.DefaultQuery("range", "24h"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		step, err := download.ParseTimeseriesDuration(c.Query("step"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Без download_id возвращается сумма по всем загрузкам пользователя
+		downloadID := uuid.Nil
+		if value := c.Query("download_id"); value != "" {
+			downloadID, err = uuid.Parse(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid download ID"})
+				return
+			}
+		}
+
+		series, err := dm.GetTimeseries(userID, downloadID, download.ParseTimeseriesMetrics(c.Query("metric")), rng, step)
+		if err != nil {
+			if errors.Is(err, download.ErrInvalidTimeseries) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, series)
+	}
+}
+
 // Settings handlers
 func getUserSettings(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -682,3 +1656,229 @@ func getLibrary(db *gorm.DB, downloadManager *download.Manager) gin.HandlerFunc
 		c.JSON(http.StatusOK, enrichedGames)
 	}
 }
+
+// Hook handlers (только для администраторов)
+type hookRequest struct {
+	Name       string   `json:"name" binding:"required"`
+	Events     []string `json:"events" binding:"required"`
+	Type       string   `json:"type" binding:"required"`
+	Command    string   `json:"command"`
+	URL        string   `json:"url"`
+	Secret     *string  `json:"secret"`
+	Timeout    *int     `json:"timeout"`
+	MaxRetries *int     `json:"max_retries"`
+	Enabled    *bool    `json:"enabled"`
+}
+
+// hookResponse скрывает ключ подписи, сообщая только о его наличии
+type hookResponse struct {
+	models.Hook
+	HasSecret bool `json:"has_secret"`
+}
+
+func newHookResponse(hook models.Hook) hookResponse {
+	return hookResponse{Hook: hook, HasSecret: hook.Secret != ""}
+}
+
+// apply проверяет запрос и переносит его в хук
+func (r *hookRequest) apply(hook *models.Hook) error {
+	if len(r.Events) == 0 {
+		return errors.New("at least one event is required")
+	}
+	for _, event := range r.Events {
+		if !hooks.ValidEvent(event) {
+			return fmt.Errorf("unknown event %q: expected queued, started, completed, failed or cancelled", event)
+		}
+	}
+
+	switch r.Type {
+	case hooks.TypeCommand:
+		if strings.TrimSpace(r.Command) == "" {
+			return errors.New("command is required for command hooks")
+		}
+	case hooks.TypeWebhook:
+		if !strings.HasPrefix(r.URL, "http://") && !strings.HasPrefix(r.URL, "https://") {
+			return errors.New("url must be an http(s) URL for webhook hooks")
+		}
+	default:
+		return fmt.Errorf("unknown hook type %q: expected command or webhook", r.Type)
+	}
+
+	hook.Name = r.Name
+	hook.Events = r.Events
+	hook.Type = r.Type
+	hook.Command = r.Command
+	hook.URL = r.URL
+	if r.Secret != nil {
+		hook.Secret = *r.Secret
+	}
+	if r.Timeout != nil {
+		if *r.Timeout < 1 || *r.Timeout > 3600 {
+			return errors.New("timeout must be between 1 and 3600 seconds")
+		}
+		hook.Timeout = *r.Timeout
+	}
+	if r.MaxRetries != nil {
+		if *r.MaxRetries < 0 || *r.MaxRetries > 10 {
+			return errors.New("max_retries must be between 0 and 10")
+		}
+		hook.MaxRetries = *r.MaxRetries
+	}
+	if r.Enabled != nil {
+		hook.Enabled = *r.Enabled
+	}
+	return nil
+}
+
+func getHooks(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var list []models.Hook
+		if err := db.Order("created_at").Find(&list).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		response := make([]hookResponse, 0, len(list))
+		for _, hook := range list {
+			response = append(response, newHookResponse(hook))
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+func getHook(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var hook models.Hook
+		if err := db.First(&hook, "id = ?", c.Param("id")).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Hook not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, newHookResponse(hook))
+	}
+}
+
+func createHook(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req hookRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		hook := models.Hook{
+			Timeout:    hooks.DefaultTimeout,
+			MaxRetries: hooks.DefaultMaxRetries,
+			Enabled:    true,
+		}
+		if err := req.apply(&hook); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := db.Create(&hook).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, newHookResponse(hook))
+	}
+}
+
+func updateHook(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var hook models.Hook
+		if err := db.First(&hook, "id = ?", c.Param("id")).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Hook not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var req hookRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := req.apply(&hook); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := db.Save(&hook).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, newHookResponse(hook))
+	}
+}
+
+func deleteHook(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hook ID"})
+			return
+		}
+
+		result := db.Delete(&models.Hook{}, "id = ?", id)
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Hook not found"})
+			return
+		}
+
+		// Журнал удаленного хука больше не нужен
+		db.Where("hook_id = ?", id).Delete(&models.HookExecution{})
+
+		c.JSON(http.StatusOK, gin.H{"message": "Hook deleted"})
+	}
+}
+
+// getHookExecutions возвращает журнал выполнения хуков, новые записи первыми.
+// Фильтры: hook_id (или :id в пути), download_id, event, limit (по умолчанию 50, максимум 500).
+func getHookExecutions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Order("created_at DESC")
+
+		hookID := c.Param("id")
+		if hookID == "" {
+			hookID = c.Query("hook_id")
+		}
+		if hookID != "" {
+			query = query.Where("hook_id = ?", hookID)
+		}
+		if downloadID := c.Query("download_id"); downloadID != "" {
+			query = query.Where("download_id = ?", downloadID)
+		}
+		if event := c.Query("event"); event != "" {
+			query = query.Where("event = ?", event)
+		}
+
+		limit := 50
+		if value, err := strconv.Atoi(c.Query("limit")); err == nil && value > 0 {
+			limit = value
+		}
+		if limit > 500 {
+			limit = 500
+		}
+
+		var executions []models.HookExecution
+		if err := query.Limit(limit).Find(&executions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, executions)
+	}
+}
@@ -37,7 +37,7 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, downloadManager *download.Mana
 	{
 		// WebSocket endpoint для real-time обновлений
 		api.GET("/ws", wsHub.HandleWebSocket)
-		
+
 		// Games routes
 		games := api.Group("/games")
 		{
@@ -59,11 +59,84 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, downloadManager *download.Mana
 			downloads.GET("/progress", getDownloadProgress(downloadManager))
 			downloads.POST("", createDownload(db, downloadManager))
 			downloads.POST("/torrent", createDownloadFromTorrentFile(db, downloadManager))
+			downloads.POST("/import", importDownload(downloadManager))
 			downloads.PUT("/:id/pause", pauseDownload(downloadManager))
 			downloads.PUT("/:id/resume", resumeDownload(downloadManager))
+			downloads.PUT("/:id/retry", retryDownload(downloadManager))
+			downloads.GET("/:id/trackers", getDownloadTrackers(downloadManager))
+			downloads.POST("/:id/trackers", addDownloadTracker(downloadManager))
+			downloads.DELETE("/:id/trackers", removeDownloadTracker(downloadManager))
+			downloads.POST("/:id/reannounce", reannounceDownload(downloadManager))
+			downloads.GET("/:id/webseeds", getDownloadWebSeeds(downloadManager))
+			downloads.POST("/:id/webseeds", addDownloadWebSeeds(downloadManager))
+			downloads.GET("/:id/peers", getDownloadPeers(downloadManager))
+			downloads.GET("/:id/pieces", getDownloadPieces(downloadManager))
+			downloads.GET("/:id/files", getDownloadFiles(downloadManager))
+			downloads.GET("/:id/files/:index/stream", streamDownloadFile(downloadManager))
+			downloads.PUT("/:id/sequential", setDownloadSequential(downloadManager))
+			downloads.GET("/:id/content", getDownloadContent(downloadManager))
+			downloads.GET("/:id/content/file", getDownloadContentFile(downloadManager))
+			downloads.GET("/:id/content/archive", getDownloadArchive(downloadManager))
+			downloads.GET("/:id/torrent", getDownloadTorrentFile(downloadManager))
+			downloads.GET("/:id/bans", getDownloadPeerBans(downloadManager))
+			downloads.POST("/:id/bans", banDownloadPeer(downloadManager))
+			downloads.DELETE("/:id/bans/:banId", unbanDownloadPeer(downloadManager))
 			downloads.DELETE("/:id", cancelDownload(db, downloadManager))
 		}
 
+		// Torrent routes
+		torrents := api.Group("/torrents")
+		{
+			torrents.POST("/inspect", inspectTorrent(downloadManager))
+		}
+
+		// Создание торрентов из каталогов сервера (администраторы): раздача открывает
+		// содержимое каталога через эндпоинты файлов загрузки
+		torrentsAdmin := api.Group("/torrents")
+		torrentsAdmin.Use(middleware.RequireRole("admin"))
+		{
+			torrentsAdmin.POST("/create", createTorrent(downloadManager))
+		}
+
+		// Трекеры по умолчанию для magnet-ссылок (администрирование)
+		trackers := api.Group("/trackers")
+		trackers.Use(middleware.RequireRole("admin"))
+		{
+			trackers.GET("/defaults", getDefaultTrackers(downloadManager))
+			trackers.PUT("/defaults", updateDefaultTrackers(downloadManager))
+		}
+
+		// Баны пиров по всем загрузкам (администрирование)
+		peers := api.Group("/peers")
+		peers.Use(middleware.RequireRole("admin"))
+		{
+			peers.GET("/bans", getPeerBans(downloadManager))
+			peers.DELETE("/bans/:id", deletePeerBan(downloadManager))
+		}
+
+		// Блоклисты IP (администрирование)
+		blocklists := api.Group("/blocklists")
+		blocklists.Use(middleware.RequireRole("admin"))
+		{
+			blocklists.GET("", getBlocklists(downloadManager))
+			blocklists.POST("", uploadBlocklist(downloadManager))
+			blocklists.POST("/reload", reloadBlocklists(downloadManager))
+			blocklists.DELETE("/:name", deleteBlocklist(downloadManager))
+		}
+
+		// Hook routes (администрирование)
+		hooksGroup := api.Group("/hooks")
+		hooksGroup.Use(middleware.RequireRole("admin"))
+		{
+			hooksGroup.GET("", getHooks(db))
+			hooksGroup.POST("", createHook(db))
+			hooksGroup.GET("/executions", getHookExecutions(db))
+			hooksGroup.GET("/:id", getHook(db))
+			hooksGroup.PUT("/:id", updateHook(db))
+			hooksGroup.DELETE("/:id", deleteHook(db))
+			hooksGroup.GET("/:id/executions", getHookExecutions(db))
+		}
+
 		// Search routes
 		search := api.Group("/search")
 		{
@@ -73,7 +146,8 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, downloadManager *download.Mana
 
 		// Statistics route
 		api.GET("/stats", getStats(db, downloadManager))
-		
+		api.GET("/stats/timeseries", getStatsTimeseries(downloadManager))
+
 		// Settings routes
 		settings := api.Group("/settings")
 		{
@@ -2,19 +2,118 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	Port           string
-	DatabasePath   string
-	TorrentConfig  TorrentConfig
-	JWTSecret      string
-	SteamGridDBKey string
+	Port         string
+	DatabasePath string
+	// Сколько ждать корректной остановки по SIGINT/SIGTERM до принудительного выхода
+	ShutdownTimeout time.Duration
+	TorrentConfig   TorrentConfig
+	Transmission    TransmissionConfig
+	Direct          DirectConfig
+	PostProcess     PostProcessConfig
+	JWTSecret       string
+	SteamGridDBKey  string
 }
 
 type TorrentConfig struct {
+	// Клиент, выполняющий загрузки торрентов: embedded (встроенный) или transmission.
+	// С transmission трекеры, пиры, карта частей, потоковое чтение, веб-сиды, создание и
+	// импорт торрентов и блоклисты недоступны: API отвечает на них 501.
+	Backend     string
 	DownloadDir string
-	MaxPeers    int
+	// Директория для состояния торрент-клиента (piece completion, кэш метаданных, узлы DHT)
+	StateDir string
+	// Бэкенд хранения данных торрентов: file, mmap или piece
+	Storage  string
+	MaxPeers int
+	// Полуоткрытые (устанавливаемые) соединения: на торрент и всего
+	HalfOpenPerTorrent int
+	MaxHalfOpen        int
+	// Таймаут рукопожатия с пиром
+	HandshakeTimeout time.Duration
+	// Порт для входящих соединений (TCP и uTP); 0 - случайный
+	ListenPort int
+	EnableIPv4 bool
+	EnableIPv6 bool
+	EnableTCP  bool
+	EnableUTP  bool
+	EnableDHT  bool
+	EnablePEX  bool
+	// Способы проброса порта на роутере: upnp и natpmp; пусто - без проброса
+	PortForwarding []string
+	// Шифрование соединений с пирами: required, preferred или disabled
+	Encryption string
+	// Префикс peer ID в стиле BEP 20 (например, -GC0001-); пусто - по умолчанию библиотеки
+	PeerIDPrefix string
+	// Начальные узлы DHT (host:port); пусто - публичные узлы по умолчанию
+	DHTBootstrapNodes []string
+	// Минимальный запас свободного места (в байтах), ниже которого загрузки приостанавливаются
+	MinFreeSpace int64
+	// Как часто проверять свободное место на диске во время загрузок
+	DiskCheckInterval time.Duration
+	// Сколько ждать метаданные торрента (magnet-ссылки) до признания попытки неудачной
+	MetadataTimeout time.Duration
+	// Сколько раз автоматически повторять загрузку после временной ошибки
+	MaxRetries int
+	// Начальная и максимальная задержка экспоненциального backoff между повторами
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// Каталоги сервера, из которых можно создавать торренты и импортировать игры; пусто - отключено
+	AllowedBasePaths []string
+	// Каталог, из которого автоматически импортируются .torrent и .magnet файлы; пусто - отключено
+	WatchDir string
+	// Пользователь (ID или имя), которому принадлежат загрузки из WatchDir
+	WatchUser string
+	// Как часто проверять WatchDir
+	WatchInterval time.Duration
+	// Прокси для трафика торрентов: socks5://[user:pass@]host:port или http://[user:pass@]host:port
+	ProxyURL string
+	// Не пропускать трафик в обход прокси, даже если он недоступен
+	ProxyFailClosed bool
+	// Файлы блоклистов IP в формате PeerGuardian P2P или eMule DAT (можно сжатые gzip)
+	BlocklistPaths []string
+}
+
+// TransmissionConfig описывает подключение к демону Transmission (TORRENT_BACKEND=transmission)
+type TransmissionConfig struct {
+	// Адрес RPC, например http://localhost:9091/transmission/rpc
+	URL      string
+	Username string
+	Password string
+	// Директория для данных на стороне демона; пусто - директория по умолчанию демона
+	DownloadDir string
+	// Где данные демона доступны этому серверу (общий диск); пусто - по тому же пути
+	LocalDir string
+	// Как часто запрашивать прогресс загрузок
+	PollInterval time.Duration
+}
+
+// DirectConfig описывает прямые загрузки по HTTP(S)
+type DirectConfig struct {
+	// Директория для файлов; каждая загрузка скачивается в свою поддиректорию
+	DownloadDir string
+	// Сколько соединений открывать на одну загрузку
+	Connections int
+	// Минимальный размер сегмента (в байтах): маленькие файлы качаются меньшим числом соединений
+	MinSegmentSize int64
+	// Сколько раз повторять запрос сегмента после сетевой ошибки до признания попытки неудачной
+	SegmentRetries int
+}
+
+// PostProcessConfig описывает обработку завершенных загрузок
+type PostProcessConfig struct {
+	// Шаги по порядку: verify, extract, install, cleanup. Пустой список - обработка отключена
+	Steps []string
+	// Директория установки игр; каждая игра устанавливается в поддиректорию по названию
+	InstallDir string
+	// copy - данные торрента остаются для раздачи, move - переносятся в InstallDir
+	Mode string
 }
 
 func Load() *Config {
@@ -26,11 +125,61 @@ func Load() *Config {
 	}
 
 	return &Config{
-		Port:         getEnv("PORT", "8080"),
-		DatabasePath: getEnv("DATABASE_PATH", "./gamecloud.db"),
+		Port:            getEnv("PORT", "8080"),
+		DatabasePath:    getEnv("DATABASE_PATH", "./gamecloud.db"),
+		ShutdownTimeout: time.Duration(getEnvInt64("SHUTDOWN_TIMEOUT", 30)) * time.Second,
 		TorrentConfig: TorrentConfig{
-			DownloadDir: getEnv("DOWNLOAD_DIR", "./downloads"),
-			MaxPeers:    50,
+			Backend:            getEnv("TORRENT_BACKEND", "embedded"),
+			DownloadDir:        getEnv("DOWNLOAD_DIR", "./downloads"),
+			StateDir:           getEnv("TORRENT_STATE_DIR", "./torrent-state"),
+			Storage:            getEnv("TORRENT_STORAGE", "file"),
+			MaxPeers:           int(getEnvInt64("TORRENT_MAX_PEERS", 30)),
+			HalfOpenPerTorrent: int(getEnvInt64("TORRENT_HALF_OPEN_PER_TORRENT", 15)),
+			MaxHalfOpen:        int(getEnvInt64("TORRENT_MAX_HALF_OPEN", 100)),
+			HandshakeTimeout:   time.Duration(getEnvInt64("TORRENT_HANDSHAKE_TIMEOUT", 20)) * time.Second,
+			ListenPort:         int(getEnvInt64("TORRENT_LISTEN_PORT", 42069)),
+			EnableIPv4:         getEnvBool("TORRENT_IPV4", true),
+			EnableIPv6:         getEnvBool("TORRENT_IPV6", true),
+			EnableTCP:          getEnvBool("TORRENT_TCP", true),
+			EnableUTP:          getEnvBool("TORRENT_UTP", true),
+			EnableDHT:          getEnvBool("TORRENT_DHT", true),
+			EnablePEX:          getEnvBool("TORRENT_PEX", true),
+			PortForwarding:     getEnvPortForwarding("TORRENT_PORT_FORWARDING"),
+			Encryption:         getEnv("TORRENT_ENCRYPTION", "preferred"),
+			PeerIDPrefix:       getEnv("TORRENT_PEER_ID_PREFIX", ""),
+			DHTBootstrapNodes:  getEnvList("TORRENT_DHT_BOOTSTRAP", ""),
+			MinFreeSpace:       getEnvInt64("MIN_FREE_SPACE_MB", 1024) << 20,
+			DiskCheckInterval:  time.Duration(getEnvInt64("DISK_CHECK_INTERVAL", 30)) * time.Second,
+			MetadataTimeout:    time.Duration(getEnvInt64("METADATA_TIMEOUT", 60)) * time.Second,
+			MaxRetries:         int(getEnvInt64("DOWNLOAD_MAX_RETRIES", 5)),
+			RetryBaseDelay:     time.Duration(getEnvInt64("DOWNLOAD_RETRY_BASE_DELAY", 30)) * time.Second,
+			RetryMaxDelay:      time.Duration(getEnvInt64("DOWNLOAD_RETRY_MAX_DELAY", 1800)) * time.Second,
+			AllowedBasePaths:   getEnvList("ALLOWED_BASE_PATHS", ""),
+			WatchDir:           getEnv("WATCH_DIR", ""),
+			WatchUser:          getEnv("WATCH_USER", ""),
+			WatchInterval:      time.Duration(getEnvInt64("WATCH_INTERVAL", 10)) * time.Second,
+			ProxyURL:           getEnv("TORRENT_PROXY", ""),
+			ProxyFailClosed:    getEnvBool("TORRENT_PROXY_FAIL_CLOSED", false),
+			BlocklistPaths:     getEnvList("BLOCKLIST_PATHS", ""),
+		},
+		Transmission: TransmissionConfig{
+			URL:          getEnv("TRANSMISSION_URL", "http://localhost:9091/transmission/rpc"),
+			Username:     getEnv("TRANSMISSION_USERNAME", ""),
+			Password:     getEnv("TRANSMISSION_PASSWORD", ""),
+			DownloadDir:  getEnv("TRANSMISSION_DOWNLOAD_DIR", ""),
+			LocalDir:     getEnv("TRANSMISSION_LOCAL_DIR", ""),
+			PollInterval: time.Duration(getEnvInt64("TRANSMISSION_POLL_INTERVAL", 2)) * time.Second,
+		},
+		Direct: DirectConfig{
+			DownloadDir:    filepath.Join(getEnv("DOWNLOAD_DIR", "./downloads"), "direct"),
+			Connections:    int(getEnvInt64("DIRECT_CONNECTIONS", 4)),
+			MinSegmentSize: getEnvInt64("DIRECT_MIN_SEGMENT_MB", 4) << 20,
+			SegmentRetries: int(getEnvInt64("DIRECT_SEGMENT_RETRIES", 5)),
+		},
+		PostProcess: PostProcessConfig{
+			Steps:      getEnvList("POSTPROCESS_STEPS", ""),
+			InstallDir: getEnv("INSTALL_DIR", "./games"),
+			Mode:       getEnv("POSTPROCESS_MODE", "copy"),
 		},
 		JWTSecret:      jwtSecret,
 		SteamGridDBKey: getEnv("STEAMGRIDDB_API_KEY", ""),
@@ -43,3 +192,43 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt64(key string, defaultValue int64) int64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// getEnvPortForwarding читает способы проброса порта. true и false из прежнего булева
+// формата означают все способы и отключение проброса.
+func getEnvPortForwarding(key string) []string {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(key))) {
+	case "", "true", "1":
+		return []string{"upnp", "natpmp"}
+	case "false", "0", "none":
+		return nil
+	}
+	return getEnvList(key, "")
+}
+
+func getEnvList(key, defaultValue string) []string {
+	var list []string
+	for _, item := range strings.Split(getEnv(key, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
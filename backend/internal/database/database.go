@@ -19,6 +19,11 @@ func Initialize(dbPath string) (*gorm.DB, error) {
 		&models.Download{},
 		&models.User{},
 		&models.UserSettings{},
+		&models.Hook{},
+		&models.HookExecution{},
+		&models.DefaultTracker{},
+		&models.PeerBan{},
+		&models.MetricSample{},
 	)
 	if err != nil {
 		return nil, err
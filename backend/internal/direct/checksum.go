@@ -0,0 +1,115 @@
+package direct
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+var (
+	// ErrInvalidChecksum - контрольная сумма задана в неизвестном формате
+	ErrInvalidChecksum = errors.New("invalid checksum")
+	// ErrChecksumMismatch - скачанный файл не совпал с контрольной суммой
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// checksum - ожидаемая контрольная сумма файла
+type checksum struct {
+	algorithm string
+	sum       []byte
+}
+
+// Алгоритмы по длине hex-строки, если он не указан явно
+var checksumLengths = map[int]string{
+	32:  "md5",
+	40:  "sha1",
+	64:  "sha256",
+	128: "sha512",
+}
+
+// parseChecksum разбирает "алгоритм:hex" или просто hex (алгоритм определяется по длине).
+// Пустая строка - проверка не нужна, возвращается nil.
+func parseChecksum(s string) (*checksum, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	algorithm, value, ok := strings.Cut(s, ":")
+	if !ok {
+		value = s
+		algorithm = checksumLengths[len(value)]
+	}
+	algorithm = strings.ToLower(algorithm)
+
+	sum, err := hex.DecodeString(value)
+	if err != nil || newHash(algorithm) == nil || len(sum) != newHash(algorithm).Size() {
+		return nil, fmt.Errorf("%w: expected md5, sha1, sha256 or sha512 as algorithm:hex", ErrInvalidChecksum)
+	}
+	return &checksum{algorithm: algorithm, sum: sum}, nil
+}
+
+// ValidateChecksum проверяет формат контрольной суммы
+func ValidateChecksum(s string) error {
+	_, err := parseChecksum(s)
+	return err
+}
+
+func newHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case "md5":
+		return md5.New()
+	case "sha1":
+		return sha1.New()
+	case "sha256":
+		return sha256.New()
+	case "sha512":
+		return sha512.New()
+	}
+	return nil
+}
+
+// verify считает контрольную сумму файла. progress вызывается с числом прочитанных байт.
+func (s *checksum) verify(ctx context.Context, path string, progress func(done int64)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := newHash(s.algorithm)
+	buf := make([]byte, 1<<20)
+	var done int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := f.Read(buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			done += int64(n)
+			progress(done)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if got := h.Sum(nil); !bytes.Equal(got, s.sum) {
+		return fmt.Errorf("%w: %s expected %x, got %x", ErrChecksumMismatch, s.algorithm, s.sum, got)
+	}
+	return nil
+}
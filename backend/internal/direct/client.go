@@ -0,0 +1,200 @@
+// Package direct скачивает файлы по прямым HTTP(S) ссылкам: в несколько соединений,
+// с продолжением после перезапуска и проверкой контрольной суммы. Прогресс передается
+// теми же torrent.ProgressUpdate, что и у торрентов, поэтому менеджер загрузок
+// обрабатывает такие задачи так же.
+package direct
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gamecloud/internal/config"
+	"gamecloud/internal/torrent"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidURL - ссылка не является абсолютным HTTP(S) URL
+	ErrInvalidURL = errors.New("invalid download URL")
+	// ErrContentChanged - файл на сервере изменился во время загрузки
+	ErrContentChanged = errors.New("remote file changed during download")
+)
+
+// HTTPStatusError возвращается, если сервер ответил неуспешным статусом
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("failed to download file: HTTP %d", e.StatusCode)
+}
+
+// AdmissionFunc решает, можно ли начинать загрузку, когда стал известен размер файла.
+// dir - директория файла, size - количество байт, которое еще предстоит скачать.
+type AdmissionFunc func(downloadID, dir string, size int64) error
+
+// Options задает параметры загрузки
+type Options struct {
+	// Директория для файла; пусто - DownloadDir из конфигурации. Недокачанный файл и
+	// состояние сегментов лежат там же, по ним загрузка продолжается после перезапуска.
+	DownloadDir string
+	// Имя файла; пусто - из Content-Disposition или пути URL
+	FileName string
+	// Контрольная сумма "алгоритм:hex" (md5, sha1, sha256, sha512); пусто - без проверки
+	Checksum string
+}
+
+type Client struct {
+	config     *config.DirectConfig
+	httpClient *http.Client
+	mu         sync.RWMutex
+	jobs       map[string]*job
+	admission  AdmissionFunc
+	wg         sync.WaitGroup
+}
+
+// NewClient создает клиент прямых загрузок. httpClient - клиент для исходящих запросов
+// (например, через прокси); nil - http.DefaultClient.
+func NewClient(cfg *config.DirectConfig, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		config:     cfg,
+		httpClient: httpClient,
+		jobs:       make(map[string]*job),
+	}
+}
+
+// SetAdmissionCheck устанавливает проверку, выполняемую перед стартом каждой загрузки
+func (c *Client) SetAdmissionCheck(fn AdmissionFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.admission = fn
+}
+
+// ValidURL проверяет, что ссылка - абсолютный HTTP(S) URL
+func ValidURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return u.Scheme == "http" || u.Scheme == "https"
+}
+
+// Add начинает загрузку файла и возвращает ID задачи и канал прогресса. Канал закрывается,
+// когда загрузка завершена, отменена или завершилась ошибкой.
+func (c *Client) Add(rawURL string, opts Options) (string, chan torrent.ProgressUpdate, error) {
+	if !ValidURL(rawURL) {
+		return "", nil, fmt.Errorf("%w: %s", ErrInvalidURL, rawURL)
+	}
+	if _, err := parseChecksum(opts.Checksum); err != nil {
+		return "", nil, err
+	}
+	if opts.DownloadDir == "" {
+		opts.DownloadDir = c.config.DownloadDir
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		id:       uuid.New().String(),
+		url:      rawURL,
+		opts:     opts,
+		progress: make(chan torrent.ProgressUpdate, 100),
+		resumed:  make(chan struct{}, 1),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+
+	c.mu.Lock()
+	c.jobs[j.id] = j
+	c.mu.Unlock()
+
+	c.wg.Add(1)
+	go c.run(j)
+
+	return j.id, j.progress, nil
+}
+
+func (c *Client) job(downloadID string) (*job, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	j, ok := c.jobs[downloadID]
+	if !ok {
+		return nil, fmt.Errorf("download not found: %s", downloadID)
+	}
+	return j, nil
+}
+
+// PauseDownload останавливает соединения загрузки; скачанное сохраняется
+func (c *Client) PauseDownload(downloadID string) error {
+	j, err := c.job(downloadID)
+	if err != nil {
+		return err
+	}
+	j.pause()
+	return nil
+}
+
+// ResumeDownload продолжает приостановленную загрузку
+func (c *Client) ResumeDownload(downloadID string) error {
+	j, err := c.job(downloadID)
+	if err != nil {
+		return err
+	}
+	j.resume()
+	return nil
+}
+
+// CancelDownload отменяет загрузку. Недокачанный файл остается на диске, как и данные
+// отмененного торрента.
+func (c *Client) CancelDownload(downloadID string) error {
+	j, err := c.job(downloadID)
+	if err != nil {
+		return err
+	}
+	j.cancel()
+	return nil
+}
+
+// ContentPath возвращает путь к скачанному файлу
+func (c *Client) ContentPath(downloadID string) (string, error) {
+	j, err := c.job(downloadID)
+	if err != nil {
+		return "", err
+	}
+	path := j.contentPath()
+	if path == "" {
+		return "", fmt.Errorf("download is not completed: %s", downloadID)
+	}
+	return path, nil
+}
+
+// ReleaseJob прекращает отслеживание завершенной загрузки
+func (c *Client) ReleaseJob(downloadID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if j, ok := c.jobs[downloadID]; ok {
+		j.cancel()
+		delete(c.jobs, downloadID)
+	}
+}
+
+// Close останавливает все загрузки и дожидается сохранения их состояния
+func (c *Client) Close() error {
+	c.mu.Lock()
+	for _, j := range c.jobs {
+		j.cancel()
+	}
+	c.mu.Unlock()
+
+	c.wg.Wait()
+	log.Printf("Direct download client stopped")
+	return nil
+}
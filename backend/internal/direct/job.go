@@ -0,0 +1,649 @@
+package direct
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gamecloud/internal/torrent"
+	"io"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Суффиксы недокачанного файла и состояния его сегментов
+	partSuffix  = ".part"
+	stateSuffix = ".state"
+	// Как часто отправлять прогресс и сохранять состояние сегментов
+	progressInterval = 2 * time.Second
+	// Постоянная времени сглаживания скорости, как у торрентов
+	rateSmoothing = 10 * time.Second
+	// Максимальная пауза между повторами запроса сегмента
+	maxRetryDelay  = 30 * time.Second
+	readBufferSize = 64 << 10
+)
+
+// job - задача прямой загрузки
+type job struct {
+	id       string
+	url      string
+	opts     Options
+	progress chan torrent.ProgressUpdate
+	resumed  chan struct{}
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	mu      sync.Mutex
+	paused  bool
+	stop    context.CancelFunc // останавливает текущие соединения (пауза)
+	name    string
+	path    string // итоговый путь к файлу
+	size    int64  // -1 - сервер не сообщил размер
+	status  string
+	checked int64 // байт, проверенных контрольной суммой
+	done    bool
+	state   *transferState
+	stateMu sync.Mutex // сериализует сохранение состояния
+
+	conns int32 // открытые соединения
+}
+
+func (j *job) pause() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.paused = true
+	if j.stop != nil {
+		j.stop()
+	}
+}
+
+func (j *job) resume() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.paused {
+		return
+	}
+	j.paused = false
+	select {
+	case j.resumed <- struct{}{}:
+	default:
+	}
+}
+
+func (j *job) isPaused() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.paused
+}
+
+// waitResumed ждет снятия паузы; false - загрузка отменена
+func (j *job) waitResumed() bool {
+	for j.isPaused() {
+		select {
+		case <-j.resumed:
+		case <-j.ctx.Done():
+			return false
+		}
+	}
+	return j.ctx.Err() == nil
+}
+
+// setStop запоминает отмену текущего прохода. Если пауза поставлена раньше, проход
+// останавливается сразу.
+func (j *job) setStop(stop context.CancelFunc) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.stop = stop
+	if j.paused {
+		stop()
+	}
+}
+
+func (j *job) setStatus(status string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status = status
+}
+
+func (j *job) contentPath() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.done {
+		return ""
+	}
+	return j.path
+}
+
+// downloaded возвращает число скачанных байт
+func (j *job) downloaded() int64 {
+	j.mu.Lock()
+	state := j.state
+	j.mu.Unlock()
+	if state == nil {
+		return 0
+	}
+	return state.downloaded()
+}
+
+// update собирает текущий прогресс загрузки
+func (j *job) update(rate float64) torrent.ProgressUpdate {
+	downloaded := j.downloaded()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	update := newUpdate(j.id, j.name, j.size)
+	update.Downloaded = downloaded
+	update.DownloadRate = rate
+	update.Status = j.status
+	update.Peers = int(atomic.LoadInt32(&j.conns))
+	if j.size > 0 {
+		update.Progress = float64(downloaded) / float64(j.size) * 100
+		update.ETA = etaSeconds(j.size-downloaded, rate)
+		if j.status == "checking" {
+			update.Checked = float64(j.checked) / float64(j.size) * 100
+		}
+	}
+	if j.paused && j.status == "downloading" {
+		update.Status = "paused"
+	}
+	return update
+}
+
+// newUpdate заполняет общие поля прогресса прямой загрузки
+func newUpdate(id, name string, size int64) torrent.ProgressUpdate {
+	if size < 0 {
+		size = 0
+	}
+	return torrent.ProgressUpdate{
+		ID:        id,
+		Name:      name,
+		Size:      size,
+		UpdatedAt: time.Now(),
+	}
+}
+
+// remoteFile - сведения о файле на сервере
+type remoteFile struct {
+	size         int64 // -1 - неизвестен
+	ranges       bool  // сервер отдает части файла (Range)
+	etag         string
+	lastModified string
+	name         string
+}
+
+// probe запрашивает первый байт файла: так сразу видно и размер, и поддержку Range
+func (c *Client) probe(ctx context.Context, rawURL string) (*remoteFile, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidURL, err)
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	remote := &remoteFile{
+		size:         -1,
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// Content-Range: bytes 0-0/12345
+		if _, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/"); ok {
+			if size, err := strconv.ParseInt(total, 10, 64); err == nil {
+				remote.size = size
+				remote.ranges = true
+			}
+		}
+	case http.StatusOK:
+		// Range не поддерживается - качаем одним потоком
+		remote.size = resp.ContentLength
+	default:
+		return nil, &HTTPStatusError{URL: rawURL, StatusCode: resp.StatusCode}
+	}
+
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		remote.name = params["filename"]
+	}
+	if remote.name == "" {
+		// Имя из пути после редиректов
+		remote.name = path.Base(resp.Request.URL.Path)
+	}
+	return remote, nil
+}
+
+// safeFileName оставляет от имени только последний элемент пути
+func safeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == ".." || name == "/" || name == "" {
+		return "download"
+	}
+	return name
+}
+
+// run выполняет загрузку: запрос сведений о файле, скачивание сегментов, проверку суммы
+func (c *Client) run(j *job) {
+	defer c.wg.Done()
+	defer close(j.progress)
+
+	completed := false
+	defer func() {
+		// Завершенная загрузка остается до ReleaseJob: менеджеру еще нужен путь к файлу
+		if !completed {
+			c.mu.Lock()
+			delete(c.jobs, j.id)
+			c.mu.Unlock()
+		}
+	}()
+
+	j.setStatus("waiting")
+	remote, err := c.probe(j.ctx, j.url)
+	if err != nil {
+		c.failJob(j, err)
+		return
+	}
+
+	name := j.opts.FileName
+	if name == "" {
+		name = remote.name
+	}
+	name = safeFileName(name)
+	if err := os.MkdirAll(j.opts.DownloadDir, 0755); err != nil {
+		c.failJob(j, fmt.Errorf("failed to create download directory: %w", err))
+		return
+	}
+	j.mu.Lock()
+	j.name = name
+	j.path = filepath.Join(j.opts.DownloadDir, name)
+	j.size = remote.size
+	j.mu.Unlock()
+
+	// Прогресс отправляем, пока идут загрузка и проверка
+	monitorDone := make(chan struct{})
+	monitorStopped := make(chan struct{})
+	go c.monitor(j, monitorDone, monitorStopped)
+	stopMonitor := func() {
+		close(monitorDone)
+		<-monitorStopped
+	}
+
+	err = c.download(j, remote)
+	if err == nil {
+		err = c.verify(j)
+		if errors.Is(err, ErrChecksumMismatch) {
+			// Иначе повторная попытка снова найдет тот же поврежденный файл
+			os.Remove(j.path)
+		}
+	}
+	stopMonitor()
+
+	if err != nil {
+		if j.ctx.Err() != nil {
+			log.Printf("Direct download cancelled: %s", j.url)
+			return
+		}
+		log.Printf("Direct download failed: %s: %v", j.url, err)
+		c.failJob(j, err)
+		return
+	}
+
+	j.mu.Lock()
+	j.done = true
+	j.status = "completed"
+	j.mu.Unlock()
+	log.Printf("Direct download completed: %s", j.path)
+
+	update := j.update(0)
+	update.Downloaded = update.Size
+	update.Progress = 100
+	select {
+	case j.progress <- update:
+		completed = true
+	case <-j.ctx.Done():
+	}
+}
+
+// failJob сообщает об ошибке загрузки
+func (c *Client) failJob(j *job, err error) {
+	j.mu.Lock()
+	update := newUpdate(j.id, j.name, j.size)
+	j.mu.Unlock()
+	update.Downloaded = j.downloaded()
+	update.Status = "failed"
+	update.Error = err.Error()
+	update.Err = err
+
+	select {
+	case j.progress <- update:
+	case <-j.ctx.Done():
+	}
+}
+
+// download скачивает файл в j.path. Если файл уже скачан прошлой попыткой, ничего не делает.
+func (c *Client) download(j *job, remote *remoteFile) error {
+	partPath := j.path + partSuffix
+	statePath := partPath + stateSuffix
+
+	if info, err := os.Stat(j.path); err == nil && !info.IsDir() {
+		if _, err := os.Stat(partPath); os.IsNotExist(err) && (remote.size < 0 || info.Size() == remote.size) {
+			log.Printf("Direct download already present: %s", j.path)
+			j.mu.Lock()
+			j.state = completeState(info.Size())
+			j.mu.Unlock()
+			return nil
+		}
+	}
+
+	state := c.loadState(j, remote, partPath, statePath)
+	j.mu.Lock()
+	j.state = state
+	j.mu.Unlock()
+
+	if remote.size >= 0 {
+		c.mu.RLock()
+		admission := c.admission
+		c.mu.RUnlock()
+		if admission != nil {
+			if err := admission(j.id, j.opts.DownloadDir, remote.size-state.downloaded()); err != nil {
+				return err
+			}
+		}
+	}
+
+	flags := os.O_RDWR | os.O_CREATE
+	if !state.Ranges {
+		// Без Range продолжить нельзя - начинаем заново
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	if state.Size >= 0 {
+		if err := f.Truncate(state.Size); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to allocate file: %w", err)
+		}
+	}
+
+	j.setStatus("downloading")
+	err = c.transfer(j, state, f)
+	c.saveState(j, statePath)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	// Состояние больше не сохраняем - файл готов
+	j.stateMu.Lock()
+	defer j.stateMu.Unlock()
+	if err := os.Rename(partPath, j.path); err != nil {
+		return fmt.Errorf("failed to finalize file: %w", err)
+	}
+	os.Remove(statePath)
+	j.mu.Lock()
+	j.state = completeState(state.downloaded())
+	j.mu.Unlock()
+	return nil
+}
+
+// transfer качает недостающие сегменты, пока они не закончатся. Пауза останавливает
+// соединения, после нее проход начинается заново с сохраненных смещений.
+func (c *Client) transfer(j *job, state *transferState, f *os.File) error {
+	for {
+		if !j.waitResumed() {
+			return j.ctx.Err()
+		}
+
+		ctx, stop := context.WithCancel(j.ctx)
+		j.setStop(stop)
+		err := c.fetchSegments(ctx, j, state, f)
+		stop()
+
+		if err == nil {
+			return nil
+		}
+		if j.ctx.Err() != nil {
+			return j.ctx.Err()
+		}
+		if j.isPaused() {
+			continue
+		}
+		return err
+	}
+}
+
+// fetchSegments качает все незавершенные сегменты параллельно; первая ошибка
+// останавливает остальные соединения
+func (c *Client) fetchSegments(ctx context.Context, j *job, state *transferState, f *os.File) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for _, seg := range state.Segments {
+		if seg.complete() {
+			continue
+		}
+		wg.Add(1)
+		go func(seg *segment) {
+			defer wg.Done()
+			if err := c.fetchSegment(ctx, j, state, seg, f); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(seg)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// fetchSegment качает сегмент, повторяя запрос после сетевых ошибок
+func (c *Client) fetchSegment(ctx context.Context, j *job, state *transferState, seg *segment, f *os.File) error {
+	for attempt := 0; ; attempt++ {
+		err := c.fetchRange(ctx, j, state, seg, f)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !retryable(err) || attempt >= c.config.SegmentRetries {
+			return err
+		}
+
+		delay := time.Second << attempt
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+		log.Printf("Direct download segment at %d failed, retrying in %s: %v", seg.Start, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// retryable сообщает, имеет ли смысл повторить запрос сегмента
+func retryable(err error) bool {
+	var statusErr *HTTPStatusError
+	switch {
+	case errors.Is(err, ErrContentChanged):
+		return false
+	case errors.As(err, &statusErr):
+		return statusErr.StatusCode >= 500 ||
+			statusErr.StatusCode == http.StatusRequestTimeout ||
+			statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// fetchRange качает оставшуюся часть сегмента одним запросом
+func (c *Client) fetchRange(ctx context.Context, j *job, state *transferState, seg *segment, f *os.File) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return err
+	}
+	if state.Ranges {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", seg.offset(), seg.End-1))
+		// Если файл на сервере изменился, сервер отдаст его целиком, а не часть
+		if state.ETag != "" {
+			req.Header.Set("If-Range", state.ETag)
+		} else if state.LastModified != "" {
+			req.Header.Set("If-Range", state.LastModified)
+		}
+	} else {
+		atomic.StoreInt64(&seg.Done, 0)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case state.Ranges && resp.StatusCode == http.StatusPartialContent:
+	case state.Ranges && resp.StatusCode == http.StatusOK:
+		return ErrContentChanged
+	case !state.Ranges && resp.StatusCode == http.StatusOK:
+	default:
+		return &HTTPStatusError{URL: j.url, StatusCode: resp.StatusCode}
+	}
+
+	atomic.AddInt32(&j.conns, 1)
+	defer atomic.AddInt32(&j.conns, -1)
+
+	buf := make([]byte, readBufferSize)
+	for {
+		limit := int64(len(buf))
+		if seg.End >= 0 {
+			remaining := seg.End - seg.offset()
+			if remaining <= 0 {
+				return nil
+			}
+			if remaining < limit {
+				limit = remaining
+			}
+		}
+
+		n, err := resp.Body.Read(buf[:limit])
+		if n > 0 {
+			if _, werr := f.WriteAt(buf[:n], seg.offset()); werr != nil {
+				return fmt.Errorf("failed to write file: %w", werr)
+			}
+			atomic.AddInt64(&seg.Done, int64(n))
+		}
+		if err == io.EOF {
+			if seg.End < 0 {
+				// Размер не был известен - файл закончился вместе с ответом
+				seg.End = seg.offset()
+				return nil
+			}
+			if seg.offset() < seg.End {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// verify проверяет контрольную сумму скачанного файла
+func (c *Client) verify(j *job) error {
+	sum, err := parseChecksum(j.opts.Checksum)
+	if err != nil || sum == nil {
+		return err
+	}
+
+	j.setStatus("checking")
+	return sum.verify(j.ctx, j.path, func(done int64) {
+		j.mu.Lock()
+		j.checked = done
+		j.mu.Unlock()
+	})
+}
+
+// monitor периодически отправляет прогресс и сохраняет состояние сегментов
+func (c *Client) monitor(j *job, done <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	statePath := j.path + partSuffix + stateSuffix
+	var meter rateMeter
+	for {
+		select {
+		case now := <-ticker.C:
+			c.saveState(j, statePath)
+
+			rate := meter.sample(j.downloaded(), now)
+			select {
+			case j.progress <- j.update(rate):
+			default:
+				// Канал заполнен, пропускаем обновление
+			}
+		case <-done:
+			return
+		case <-j.ctx.Done():
+			return
+		}
+	}
+}
+
+// rateMeter сглаживает скорость экспоненциальным скользящим средним
+type rateMeter struct {
+	total     int64
+	sampledAt time.Time
+	rate      float64
+}
+
+func (r *rateMeter) sample(total int64, now time.Time) float64 {
+	if r.sampledAt.IsZero() || total < r.total {
+		r.total, r.sampledAt = total, now
+		return r.rate
+	}
+	dt := now.Sub(r.sampledAt).Seconds()
+	if dt <= 0 {
+		return r.rate
+	}
+	alpha := 1 - math.Exp(-dt/rateSmoothing.Seconds())
+	r.rate += alpha * (float64(total-r.total)/dt - r.rate)
+	r.total, r.sampledAt = total, now
+	return r.rate
+}
+
+// etaSeconds оценивает оставшееся время; 0 - неизвестно
+func etaSeconds(remaining int64, rate float64) int64 {
+	if remaining <= 0 || rate < 1 {
+		return 0
+	}
+	return int64(math.Ceil(float64(remaining) / rate))
+}
@@ -0,0 +1,138 @@
+package direct
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync/atomic"
+)
+
+// transferState - разбиение файла на сегменты и скачанное в каждом. Сохраняется рядом
+// с недокачанным файлом, чтобы после перезапуска докачать только недостающее.
+type transferState struct {
+	URL          string     `json:"url"`
+	Size         int64      `json:"size"`
+	Ranges       bool       `json:"ranges"`
+	ETag         string     `json:"etag,omitempty"`
+	LastModified string     `json:"last_modified,omitempty"`
+	Segments     []*segment `json:"segments"`
+}
+
+// segment - диапазон байт [Start, End), из которого скачано Done байт с начала
+type segment struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"` // -1 - до конца файла неизвестного размера
+	Done  int64 `json:"done"`
+}
+
+func (s *segment) offset() int64 {
+	return s.Start + atomic.LoadInt64(&s.Done)
+}
+
+func (s *segment) complete() bool {
+	return s.End >= 0 && s.offset() >= s.End
+}
+
+func (s *transferState) downloaded() int64 {
+	var total int64
+	for _, seg := range s.Segments {
+		total += atomic.LoadInt64(&seg.Done)
+	}
+	return total
+}
+
+// completeState описывает уже скачанный файл
+func completeState(size int64) *transferState {
+	return &transferState{Size: size, Segments: []*segment{{Start: 0, End: size, Done: size}}}
+}
+
+// newState делит файл на сегменты по числу соединений, но не мельче MinSegmentSize
+func (c *Client) newState(rawURL string, remote *remoteFile) *transferState {
+	state := &transferState{
+		URL:          rawURL,
+		Size:         remote.size,
+		Ranges:       remote.ranges && remote.size > 0,
+		ETag:         remote.etag,
+		LastModified: remote.lastModified,
+	}
+	if !state.Ranges {
+		state.Segments = []*segment{{Start: 0, End: remote.size}}
+		return state
+	}
+
+	count := int64(c.config.Connections)
+	if c.config.MinSegmentSize > 0 {
+		if limit := remote.size / c.config.MinSegmentSize; limit < count {
+			count = limit
+		}
+	}
+	if count < 1 {
+		count = 1
+	}
+	step := remote.size / count
+	for i := int64(0); i < count; i++ {
+		end := (i + 1) * step
+		if i == count-1 {
+			end = remote.size
+		}
+		state.Segments = append(state.Segments, &segment{Start: i * step, End: end})
+	}
+	return state
+}
+
+// loadState продолжает загрузку с сохраненного состояния, если файл на сервере не изменился,
+// иначе начинает заново
+func (c *Client) loadState(j *job, remote *remoteFile, partPath, statePath string) *transferState {
+	if remote.ranges {
+		if data, err := os.ReadFile(statePath); err == nil {
+			var saved transferState
+			if err := json.Unmarshal(data, &saved); err == nil &&
+				saved.URL == j.url && saved.Size == remote.size && saved.Ranges &&
+				saved.ETag == remote.etag && saved.LastModified == remote.lastModified {
+				if info, err := os.Stat(partPath); err == nil && info.Size() == saved.Size {
+					log.Printf("Resuming direct download from %d of %d bytes: %s", saved.downloaded(), saved.Size, j.url)
+					return &saved
+				}
+			} else {
+				log.Printf("Remote file changed, restarting direct download: %s", j.url)
+			}
+		}
+	}
+
+	os.Remove(partPath)
+	os.Remove(statePath)
+	return c.newState(j.url, remote)
+}
+
+// saveState записывает состояние сегментов через временный файл. Загрузку без Range
+// продолжить нельзя, ее состояние не сохраняется.
+func (c *Client) saveState(j *job, statePath string) {
+	j.stateMu.Lock()
+	defer j.stateMu.Unlock()
+
+	j.mu.Lock()
+	state := j.state
+	j.mu.Unlock()
+	if state == nil || !state.Ranges {
+		return
+	}
+
+	snapshot := *state
+	snapshot.Segments = make([]*segment, len(state.Segments))
+	for i, seg := range state.Segments {
+		snapshot.Segments[i] = &segment{Start: seg.Start, End: seg.End, Done: atomic.LoadInt64(&seg.Done)}
+	}
+
+	data, err := json.Marshal(&snapshot)
+	if err != nil {
+		return
+	}
+	tmp := statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("Failed to save direct download state: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, statePath); err != nil {
+		log.Printf("Failed to save direct download state: %v", err)
+	}
+}
@@ -0,0 +1,450 @@
+package download
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Форматы архивов. Образы ISO распаковываются своим читателем ISO 9660 (см. iso.go).
+const (
+	archiveZip    = "zip"
+	archiveTar    = "tar"
+	archiveTarGz  = "tar.gz"
+	archiveTarBz2 = "tar.bz2"
+	archiveISO    = "iso"
+
+	// RAR и 7z распознаются, но не распаковываются
+	archiveRar = "rar"
+	archive7z  = "7z"
+)
+
+// ErrUnsupportedArchive - данные загрузки состоят только из архивов, которые не умеем распаковывать
+var ErrUnsupportedArchive = errors.New("unsupported archive format")
+
+var (
+	// splitPartPattern - части разбитого архива: game.zip.001, game.zip.002, ...
+	splitPartPattern = regexp.MustCompile(`^(.+)\.(\d{3})$`)
+	// rarVolumePattern - тома RAR в старой нумерации: game.r00, game.r01, ...
+	rarVolumePattern = regexp.MustCompile(`(?i)\.r\d{2}$`)
+)
+
+// archive - архив в данных загрузки; разбитый архив состоит из нескольких частей
+type archive struct {
+	Name  string // имя без номера части
+	Kind  string
+	Parts []string // абсолютные пути частей по порядку
+	Size  int64
+}
+
+// supported сообщает, умеем ли распаковывать архив
+func (a *archive) supported() bool {
+	return a.Kind != archiveRar && a.Kind != archive7z
+}
+
+// findArchives ищет поддерживаемые архивы в файле или директории root
+func findArchives(root string) ([]*archive, error) {
+	split := make(map[string]*archive)
+	var archives []*archive
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if m := splitPartPattern.FindStringSubmatch(path); m != nil {
+			a, ok := split[m[1]]
+			if !ok {
+				a = &archive{Name: filepath.Base(m[1]), Kind: archiveKindByName(m[1])}
+				split[m[1]] = a
+			}
+			a.Parts = append(a.Parts, path)
+			a.Size += info.Size()
+			return nil
+		}
+
+		if kind := archiveKindByName(path); kind != "" {
+			archives = append(archives, &archive{
+				Name:  filepath.Base(path),
+				Kind:  kind,
+				Parts: []string{path},
+				Size:  info.Size(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for base, a := range split {
+		sort.Strings(a.Parts)
+		// Нумерация должна начинаться с .001, иначе это не разбитый архив
+		if !strings.HasSuffix(a.Parts[0], ".001") {
+			continue
+		}
+		if a.Kind == "" {
+			kind, err := sniffArchiveKind(a.Parts[0])
+			if err != nil || kind == "" {
+				log.Printf("Skipping unknown split archive: %s", base)
+				continue
+			}
+			a.Kind = kind
+		}
+		archives = append(archives, a)
+	}
+
+	sort.Slice(archives, func(i, j int) bool { return archives[i].Parts[0] < archives[j].Parts[0] })
+	return archives, nil
+}
+
+func archiveKindByName(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return archiveZip
+	case strings.HasSuffix(lower, ".tar"):
+		return archiveTar
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return archiveTarGz
+	case strings.HasSuffix(lower, ".tar.bz2"), strings.HasSuffix(lower, ".tbz2"):
+		return archiveTarBz2
+	case strings.HasSuffix(lower, ".iso"):
+		return archiveISO
+	case strings.HasSuffix(lower, ".rar"), rarVolumePattern.MatchString(lower):
+		return archiveRar
+	case strings.HasSuffix(lower, ".7z"):
+		return archive7z
+	}
+	return ""
+}
+
+// sniffArchiveKind определяет формат по сигнатуре в начале файла
+func sniffArchiveKind(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")):
+		return archiveZip, nil
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return archiveTarGz, nil
+	case bytes.HasPrefix(header, []byte("BZh")):
+		return archiveTarBz2, nil
+	case len(header) >= 262 && string(header[257:262]) == "ustar":
+		return archiveTar, nil
+	case bytes.HasPrefix(header, []byte("Rar!\x1a\x07")):
+		return archiveRar, nil
+	case bytes.HasPrefix(header, []byte("7z\xbc\xaf\x27\x1c")):
+		return archive7z, nil
+	case isISOImage(f):
+		return archiveISO, nil
+	}
+	return "", nil
+}
+
+// splitUnsupported отделяет архивы, которые не умеем распаковывать. Если кроме них в
+// данных нет ничего полезного (только списки сумм и описания), установить нечего -
+// возвращается ErrUnsupportedArchive; иначе такие архивы устанавливаются как есть.
+func splitUnsupported(root string, archives []*archive) ([]*archive, error) {
+	var supported, unsupported []*archive
+	parts := make(map[string]bool)
+	for _, a := range archives {
+		if a.supported() {
+			supported = append(supported, a)
+			continue
+		}
+		unsupported = append(unsupported, a)
+		for _, part := range a.Parts {
+			parts[part] = true
+		}
+	}
+	if len(unsupported) == 0 {
+		return supported, nil
+	}
+
+	names := make([]string, len(unsupported))
+	for i, a := range unsupported {
+		names[i] = a.Name
+	}
+
+	payload := len(supported) > 0
+	if !payload {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || parts[path] || isAuxiliaryFile(path) {
+				return err
+			}
+			payload = true
+			return filepath.SkipAll
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !payload {
+		return nil, fmt.Errorf("%w: %s (RAR and 7z archives can't be extracted)", ErrUnsupportedArchive, strings.Join(names, ", "))
+	}
+
+	log.Printf("Skipping archives that can't be extracted, they are installed as is: %s", strings.Join(names, ", "))
+	return supported, nil
+}
+
+// isAuxiliaryFile сообщает, что файл раздачи - не данные игры: список контрольных сумм,
+// описание или ссылка
+func isAuxiliaryFile(path string) bool {
+	if isChecksumManifest(path) {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".nfo", ".diz", ".txt", ".url", ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// extractArchive распаковывает архив в dest. onRead получает число прочитанных байт архива.
+func extractArchive(ctx context.Context, a *archive, dest string, onRead func(int64)) error {
+	switch a.Kind {
+	case archiveZip:
+		return extractZip(ctx, a, dest, onRead)
+	case archiveTar, archiveTarGz, archiveTarBz2:
+		return extractTar(ctx, a, dest, onRead)
+	case archiveISO:
+		return extractISO(ctx, a, dest, onRead)
+	}
+	return fmt.Errorf("%w: %s", ErrUnsupportedArchive, a.Name)
+}
+
+func extractZip(ctx context.Context, a *archive, dest string, onRead func(int64)) error {
+	ra, err := openParts(a.Parts)
+	if err != nil {
+		return err
+	}
+	defer ra.Close()
+
+	zr, err := zip.NewReader(ra, ra.size)
+	if err != nil {
+		return fmt.Errorf("failed to open zip archive %s: %w", a.Name, err)
+	}
+
+	for _, entry := range zr.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		path, err := safeJoin(dest, entry.Name)
+		if err != nil {
+			return err
+		}
+
+		if entry.FileInfo().IsDir() {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !entry.Mode().IsRegular() {
+			log.Printf("Skipping non-regular file in archive %s: %s", a.Name, entry.Name)
+			continue
+		}
+
+		rc, err := entry.Open()
+		if err != nil {
+			return fmt.Errorf("failed to read %s from %s: %w", entry.Name, a.Name, err)
+		}
+		err = writeFile(path, rc, entry.Mode().Perm())
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		onRead(int64(entry.CompressedSize64))
+	}
+	return nil
+}
+
+func extractTar(ctx context.Context, a *archive, dest string, onRead func(int64)) error {
+	ra, err := openParts(a.Parts)
+	if err != nil {
+		return err
+	}
+	defer ra.Close()
+
+	var r io.Reader = bufio.NewReaderSize(&countingReader{r: io.NewSectionReader(ra, 0, ra.size), onRead: onRead}, 1<<20)
+	switch a.Kind {
+	case archiveTarGz:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("failed to open gzip archive %s: %w", a.Name, err)
+		}
+		defer gz.Close()
+		r = gz
+	case archiveTarBz2:
+		r = bzip2.NewReader(r)
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar archive %s: %w", a.Name, err)
+		}
+
+		path, err := safeJoin(dest, header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeFile(path, tr, fs.FileMode(header.Mode).Perm()); err != nil {
+				return err
+			}
+		default:
+			// Ссылки и специальные файлы не распаковываем, чтобы не выйти за пределы dest
+			log.Printf("Skipping non-regular file in archive %s: %s", a.Name, header.Name)
+		}
+	}
+}
+
+// safeJoin соединяет путь из архива с dest, запрещая выход за пределы dest
+func safeJoin(dest, name string) (string, error) {
+	path := filepath.Join(dest, filepath.FromSlash(name))
+	rel, err := filepath.Rel(dest, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("archive entry escapes destination: %s", name)
+	}
+	return path, nil
+}
+
+func writeFile(path string, r io.Reader, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if perm == 0 {
+		perm = 0644
+	}
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm|0200)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// multiPartReaderAt представляет части разбитого архива как один файл
+type multiPartReaderAt struct {
+	files   []*os.File
+	offsets []int64 // смещение начала каждой части
+	size    int64
+}
+
+func openParts(paths []string) (*multiPartReaderAt, error) {
+	ra := &multiPartReaderAt{}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			ra.Close()
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			ra.Close()
+			return nil, err
+		}
+		ra.files = append(ra.files, f)
+		ra.offsets = append(ra.offsets, ra.size)
+		ra.size += info.Size()
+	}
+	return ra, nil
+}
+
+func (m *multiPartReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= m.size {
+		return 0, io.EOF
+	}
+
+	// Находим часть, в которую попадает смещение
+	i := sort.Search(len(m.offsets), func(i int) bool { return m.offsets[i] > off }) - 1
+
+	read := 0
+	for read < len(p) && i < len(m.files) {
+		n, err := m.files[i].ReadAt(p[read:], off-m.offsets[i])
+		read += n
+		off += int64(n)
+		if err == io.EOF {
+			i++
+			continue
+		}
+		if err != nil {
+			return read, err
+		}
+	}
+	if read < len(p) {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+func (m *multiPartReaderAt) Close() error {
+	for _, f := range m.files {
+		f.Close()
+	}
+	return nil
+}
+
+// countingReader сообщает о каждом прочитанном блоке
+type countingReader struct {
+	r      io.Reader
+	onRead func(int64)
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.onRead(int64(n))
+	}
+	return n, err
+}
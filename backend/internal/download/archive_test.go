@@ -0,0 +1,432 @@
+package download
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// gameFiles - содержимое тестовой игры внутри архивов
+var gameFiles = map[string]string{
+	"game.exe":            strings.Repeat("MZ game binary ", 300),
+	"data/level1.pak":     strings.Repeat("level one ", 1000),
+	"data/sub/config.ini": "[video]\nwidth=1920\n",
+}
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range sortedNames(files) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(files[name]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarArchive(t *testing.T, files map[string]string, gz bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var gzw *gzip.Writer
+	tw := tar.NewWriter(&buf)
+	if gz {
+		gzw = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gzw)
+	}
+	for _, name := range sortedNames(files) {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(files[name]))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gzw != nil {
+		if err := gzw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// isoImage собирает минимальный образ ISO 9660. С joliet имена записываются в
+// дополнительный том Joliet (UCS-2), иначе - в основной том в виде NAME;1.
+func isoImage(t *testing.T, files map[string]string, joliet bool) []byte {
+	t.Helper()
+
+	type node struct {
+		name     string
+		data     []byte
+		dir      bool
+		children []*node
+		lba      int
+	}
+	root := &node{dir: true}
+	dirs := map[string]*node{"": root}
+	var mkdir func(p string) *node
+	mkdir = func(p string) *node {
+		if n, ok := dirs[p]; ok {
+			return n
+		}
+		parent := root
+		if d := path.Dir(p); d != "." {
+			parent = mkdir(d)
+		}
+		n := &node{name: path.Base(p), dir: true}
+		parent.children = append(parent.children, n)
+		dirs[p] = n
+		return n
+	}
+	for _, name := range sortedNames(files) {
+		parent := root
+		if d := path.Dir(name); d != "." {
+			parent = mkdir(d)
+		}
+		parent.children = append(parent.children, &node{name: path.Base(name), data: []byte(files[name])})
+	}
+
+	// Секторы: 16 пустых, дескрипторы, каталоги, данные файлов
+	descriptors := 2
+	if joliet {
+		descriptors = 3
+	}
+	next := isoDescriptorStart + descriptors
+	var all []*node
+	var walk func(n *node)
+	walk = func(n *node) {
+		all = append(all, n)
+		for _, c := range n.children {
+			walk(c)
+		}
+	}
+	walk(root)
+	for _, n := range all {
+		if n.dir {
+			n.lba = next
+			next++
+		}
+	}
+	for _, n := range all {
+		if !n.dir {
+			n.lba = next
+			next += (len(n.data) + isoSectorSize - 1) / isoSectorSize
+		}
+	}
+
+	img := make([]byte, next*isoSectorSize)
+	encodeName := func(n *node) []byte {
+		if joliet {
+			var b []byte
+			for _, u := range utf16.Encode([]rune(n.name)) {
+				b = binary.BigEndian.AppendUint16(b, u)
+			}
+			return b
+		}
+		if n.dir {
+			return []byte(strings.ToUpper(n.name))
+		}
+		return []byte(strings.ToUpper(n.name) + ";1")
+	}
+	record := func(name []byte, lba, size int, dir bool) []byte {
+		length := 33 + len(name)
+		if length%2 == 1 {
+			length++
+		}
+		r := make([]byte, length)
+		r[0] = byte(length)
+		binary.LittleEndian.PutUint32(r[2:], uint32(lba))
+		binary.BigEndian.PutUint32(r[6:], uint32(lba))
+		binary.LittleEndian.PutUint32(r[10:], uint32(size))
+		binary.BigEndian.PutUint32(r[14:], uint32(size))
+		if dir {
+			r[25] = isoFlagDirectory
+		}
+		r[32] = byte(len(name))
+		copy(r[33:], name)
+		return r
+	}
+
+	parents := map[*node]*node{root: root}
+	for _, n := range all {
+		for _, c := range n.children {
+			parents[c] = n
+		}
+	}
+	for _, n := range all {
+		if !n.dir {
+			copy(img[n.lba*isoSectorSize:], n.data)
+			continue
+		}
+		var dir []byte
+		dir = append(dir, record([]byte{0}, n.lba, isoSectorSize, true)...)
+		dir = append(dir, record([]byte{1}, parents[n].lba, isoSectorSize, true)...)
+		for _, c := range n.children {
+			size := isoSectorSize
+			if !c.dir {
+				size = len(c.data)
+			}
+			dir = append(dir, record(encodeName(c), c.lba, size, c.dir)...)
+		}
+		if len(dir) > isoSectorSize {
+			t.Fatal("test directory does not fit into a sector")
+		}
+		copy(img[n.lba*isoSectorSize:], dir)
+	}
+
+	descriptor := func(i int, kind byte, escape string) {
+		d := img[(isoDescriptorStart+i)*isoSectorSize:]
+		d[0] = kind
+		copy(d[1:], "CD001")
+		d[6] = 1
+		copy(d[88:], escape)
+		copy(d[156:], record([]byte{0}, root.lba, isoSectorSize, true))
+	}
+	descriptor(0, isoDescriptorPrimary, "")
+	if joliet {
+		descriptor(1, isoDescriptorSupplementary, "%/E")
+	}
+	terminator := img[(isoDescriptorStart+descriptors-1)*isoSectorSize:]
+	terminator[0] = isoDescriptorTerminator
+	copy(terminator[1:], "CD001")
+	return img
+}
+
+func sortedNames(files map[string]string) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeParts записывает data частями name.001, name.002, ... по size байт
+func writeParts(t *testing.T, dir, name string, data []byte, size int) {
+	t.Helper()
+	for i := 0; len(data) > 0; i++ {
+		n := min(size, len(data))
+		writeTestFile(t, filepath.Join(dir, fmt.Sprintf("%s.%03d", name, i+1)), data[:n])
+		data = data[n:]
+	}
+}
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTree возвращает все файлы каталога с путями через "/"
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestExtractArchives(t *testing.T) {
+	upper := make(map[string]string)
+	for name, data := range gameFiles {
+		upper[strings.ToUpper(name)] = data
+	}
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, src string)
+		want  map[string]string
+	}{
+		{"zip", func(t *testing.T, src string) {
+			writeTestFile(t, filepath.Join(src, "game.zip"), zipArchive(t, gameFiles))
+		}, gameFiles},
+		{"tar", func(t *testing.T, src string) {
+			writeTestFile(t, filepath.Join(src, "game.tar"), tarArchive(t, gameFiles, false))
+		}, gameFiles},
+		{"tar.gz", func(t *testing.T, src string) {
+			writeTestFile(t, filepath.Join(src, "game.tgz"), tarArchive(t, gameFiles, true))
+		}, gameFiles},
+		{"split zip", func(t *testing.T, src string) {
+			writeParts(t, src, "game.zip", zipArchive(t, gameFiles), 1000)
+		}, gameFiles},
+		{"split tar.gz without extension", func(t *testing.T, src string) {
+			// Формат частей game.001, game.002 определяется по сигнатуре
+			writeParts(t, src, "game", tarArchive(t, gameFiles, true), 500)
+		}, gameFiles},
+		{"archive in subdirectory", func(t *testing.T, src string) {
+			writeTestFile(t, filepath.Join(src, "disc1", "game.zip"), zipArchive(t, gameFiles))
+		}, prefixed("disc1/", gameFiles)},
+		{"iso joliet", func(t *testing.T, src string) {
+			writeTestFile(t, filepath.Join(src, "game.iso"), isoImage(t, gameFiles, true))
+		}, gameFiles},
+		{"iso 9660", func(t *testing.T, src string) {
+			writeTestFile(t, filepath.Join(src, "GAME.ISO"), isoImage(t, gameFiles, false))
+		}, upper},
+		{"split iso", func(t *testing.T, src string) {
+			writeParts(t, src, "game.iso", isoImage(t, gameFiles, true), 10000)
+		}, gameFiles},
+		{"rar next to game files", func(t *testing.T, src string) {
+			writeTestFile(t, filepath.Join(src, "bonus.rar"), []byte("Rar!\x1a\x07\x00"))
+			writeTestFile(t, filepath.Join(src, "game.zip"), zipArchive(t, gameFiles))
+		}, gameFiles},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, dest := t.TempDir(), t.TempDir()
+			tt.setup(t, src)
+
+			archives, err := findArchives(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			archives, err = splitUnsupported(src, archives)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(archives) != 1 {
+				t.Fatalf("found %d archives, want 1", len(archives))
+			}
+
+			a := archives[0]
+			target := dest
+			if rel, _ := filepath.Rel(src, filepath.Dir(a.Parts[0])); rel != "." {
+				target = filepath.Join(dest, rel)
+			}
+			var read int64
+			if err := extractArchive(context.Background(), a, target, func(n int64) { read += n }); err != nil {
+				t.Fatal(err)
+			}
+			if read == 0 {
+				t.Error("no extraction progress reported")
+			}
+
+			got := readTree(t, dest)
+			if len(got) != len(tt.want) {
+				t.Fatalf("extracted %v, want %v", sortedNames(got), sortedNames(tt.want))
+			}
+			for name, data := range tt.want {
+				if got[name] != data {
+					t.Errorf("%s: content mismatch", name)
+				}
+			}
+		})
+	}
+}
+
+func prefixed(prefix string, files map[string]string) map[string]string {
+	out := make(map[string]string, len(files))
+	for name, data := range files {
+		out[prefix+name] = data
+	}
+	return out
+}
+
+func TestExtractRejectsEscapingEntries(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(src, "evil.zip"), zipArchive(t, map[string]string{"../outside.txt": "x"}))
+
+	archives, err := findArchives(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = extractArchive(context.Background(), archives[0], dest, func(int64) {})
+	if err == nil || !strings.Contains(err.Error(), "escapes destination") {
+		t.Fatalf("err = %v, want escape error", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dest), "outside.txt")); err == nil {
+		t.Fatal("file written outside destination")
+	}
+}
+
+func TestSplitUnsupported(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr bool
+	}{
+		{"only rar", map[string]string{"game.rar": "Rar!\x1a\x07\x00", "game.nfo": "info"}, true},
+		{"rar volumes", map[string]string{"game.rar": "Rar!", "game.r00": "x", "game.r01": "x", "game.sfv": "x"}, true},
+		{"split 7z", map[string]string{"game.7z.001": "7z\xbc\xaf\x27\x1c", "game.7z.002": "x"}, true},
+		{"rar with game files", map[string]string{"game.rar": "Rar!", "setup.exe": "MZ"}, false},
+		{"no archives", map[string]string{"setup.exe": "MZ"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := t.TempDir()
+			for name, data := range tt.files {
+				writeTestFile(t, filepath.Join(src, name), []byte(data))
+			}
+			archives, err := findArchives(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			supported, err := splitUnsupported(src, archives)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnsupportedArchive) {
+					t.Fatalf("err = %v, want ErrUnsupportedArchive", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(supported) != 0 {
+				t.Fatalf("got %d supported archives, want 0", len(supported))
+			}
+		})
+	}
+}
+
+func TestUDFOnlyImageFails(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	img := make([]byte, 20*isoSectorSize)
+	copy(img[isoDescriptorStart*isoSectorSize+1:], "BEA01")
+	writeTestFile(t, filepath.Join(src, "game.iso"), img)
+
+	archives, err := findArchives(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = extractArchive(context.Background(), archives[0], dest, func(int64) {})
+	if !errors.Is(err, ErrUnsupportedImage) {
+		t.Fatalf("err = %v, want ErrUnsupportedImage", err)
+	}
+}
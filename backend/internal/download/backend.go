@@ -0,0 +1,46 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"gamecloud/internal/torrent"
+	"io"
+)
+
+// Backend - торрент-клиент, выполняющий загрузки: встроенный (torrent.Client) или внешний
+// демон (transmission.Client). Прогресс каждой загрузки приходит в канал, возвращаемый при
+// добавлении; канал закрывается, когда загрузка завершена, отменена или завершилась ошибкой.
+// Возможности, которые есть только у встроенного клиента (трекеры, пиры, карта частей,
+// потоковое чтение, создание торрентов), менеджер использует напрямую через torrentClient;
+// с внешним демоном они возвращают ErrNotSupported.
+type Backend interface {
+	AddMagnet(magnetLink string, opts torrent.AddOptions) (string, chan torrent.ProgressUpdate, error)
+	AddTorrentURL(torrentURL string, opts torrent.AddOptions) (string, chan torrent.ProgressUpdate, error)
+	AddTorrentFile(torrentFile io.Reader, opts torrent.AddOptions) (string, chan torrent.ProgressUpdate, error)
+	// InfoHash возвращает info hash торрента активной загрузки
+	InfoHash(downloadID string) (string, error)
+
+	PauseDownload(downloadID string) error
+	ResumeDownload(downloadID string) error
+	CancelDownload(downloadID string) error
+
+	// ContentPath возвращает путь к данным завершенной загрузки; ReleaseJob после этого
+	// прекращает ее отслеживание, оставляя торрент раздаваться
+	ContentPath(downloadID string) (string, error)
+	ReleaseJob(downloadID string)
+	// DropTorrent снимает владельца с торрента и удаляет торрент, если владельцев не осталось
+	DropTorrent(infoHash, owner string) bool
+
+	// SetAdmissionCheck задает проверку перед стартом загрузки (место на диске)
+	SetAdmissionCheck(fn torrent.AdmissionFunc)
+
+	InspectTorrentFile(torrentFile io.Reader) (*torrent.TorrentPreview, error)
+	InspectTorrentURL(ctx context.Context, torrentURL string) (*torrent.TorrentPreview, error)
+	InspectMagnet(ctx context.Context, magnetLink string) (*torrent.TorrentPreview, error)
+
+	Close() error
+}
+
+// ErrNotSupported - возможность есть только у встроенного торрент-клиента, а загрузки
+// выполняет внешний демон (TORRENT_BACKEND=transmission)
+var ErrNotSupported = errors.New("not supported by the transmission backend, requires TORRENT_BACKEND=embedded")
@@ -0,0 +1,39 @@
+package download
+
+import (
+	"gamecloud/internal/torrent"
+	"io"
+)
+
+// GetBlocklistStatus возвращает загруженные блоклисты и число отклоненных пиров
+func (m *Manager) GetBlocklistStatus() (*torrent.BlocklistStatus, error) {
+	if m.torrentClient == nil {
+		return nil, ErrNotSupported
+	}
+	return m.torrentClient.BlocklistStatus(), nil
+}
+
+// ReloadBlocklists перечитывает блоклисты с диска, например после обновления файлов
+// из BLOCKLIST_PATHS
+func (m *Manager) ReloadBlocklists() (*torrent.BlocklistStatus, error) {
+	if m.torrentClient == nil {
+		return nil, ErrNotSupported
+	}
+	return m.torrentClient.ReloadBlocklists(), nil
+}
+
+// UploadBlocklist сохраняет блоклист, загруженный администратором, и сразу применяет его
+func (m *Manager) UploadBlocklist(name string, r io.Reader) (*torrent.BlocklistStatus, error) {
+	if m.torrentClient == nil {
+		return nil, ErrNotSupported
+	}
+	return m.torrentClient.AddBlocklist(name, r)
+}
+
+// DeleteBlocklist удаляет загруженный администратором блоклист
+func (m *Manager) DeleteBlocklist(name string) (*torrent.BlocklistStatus, error) {
+	if m.torrentClient == nil {
+		return nil, ErrNotSupported
+	}
+	return m.torrentClient.RemoveBlocklist(name)
+}
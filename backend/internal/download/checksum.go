@@ -0,0 +1,200 @@
+package download
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ErrChecksumMismatch - файл не совпадает с контрольной суммой из раздачи
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// checksumEntry - ожидаемая контрольная сумма файла
+type checksumEntry struct {
+	Path string
+	Algo string // md5, sha1, sha256, crc32
+	Sum  string
+}
+
+// bsdChecksumLine - формат "SHA256 (file) = hash"
+var bsdChecksumLine = regexp.MustCompile(`^(MD5|SHA1|SHA256) \((.+)\) = ([0-9a-fA-F]+)$`)
+
+// isChecksumManifest сообщает, является ли файл списком контрольных сумм
+func isChecksumManifest(name string) bool {
+	lower := strings.ToLower(filepath.Base(name))
+	switch lower {
+	case "md5sums", "sha1sums", "sha256sums":
+		return true
+	}
+	switch filepath.Ext(lower) {
+	case ".md5", ".sha1", ".sha256", ".sfv":
+		return true
+	}
+	return false
+}
+
+// findChecksums собирает контрольные суммы из всех списков в root
+func findChecksums(root string) ([]checksumEntry, error) {
+	var entries []checksumEntry
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isChecksumManifest(path) {
+			return err
+		}
+		parsed, err := parseChecksumFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read checksum file %s: %w", filepath.Base(path), err)
+		}
+		entries = append(entries, parsed...)
+		return nil
+	})
+	return entries, err
+}
+
+func parseChecksumFile(manifest string) ([]checksumEntry, error) {
+	f, err := os.Open(manifest)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dir := filepath.Dir(manifest)
+	isSFV := strings.EqualFold(filepath.Ext(manifest), ".sfv")
+
+	var entries []checksumEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var name, sum, algo string
+		switch {
+		case isSFV:
+			// SFV: "имя_файла crc32"
+			i := strings.LastIndexByte(line, ' ')
+			if i < 0 {
+				continue
+			}
+			name, sum, algo = strings.TrimSpace(line[:i]), line[i+1:], "crc32"
+		case bsdChecksumLine.MatchString(line):
+			m := bsdChecksumLine.FindStringSubmatch(line)
+			name, sum, algo = m[2], m[3], strings.ToLower(m[1])
+		default:
+			// GNU: "hash  имя_файла" или "hash *имя_файла"; в game.iso.sha256 может быть только hash
+			fields := strings.SplitN(line, " ", 2)
+			sum = fields[0]
+			if len(fields) == 2 {
+				name = strings.TrimPrefix(strings.TrimSpace(fields[1]), "*")
+			} else {
+				name = strings.TrimSuffix(filepath.Base(manifest), filepath.Ext(manifest))
+			}
+			algo = algoByLength(sum)
+		}
+
+		if algo == "" || name == "" {
+			continue
+		}
+		entries = append(entries, checksumEntry{
+			Path: filepath.Join(dir, filepath.FromSlash(name)),
+			Algo: algo,
+			Sum:  strings.ToLower(sum),
+		})
+	}
+	return entries, scanner.Err()
+}
+
+func algoByLength(sum string) string {
+	if _, err := hex.DecodeString(sum); err != nil {
+		return ""
+	}
+	switch len(sum) {
+	case 32:
+		return "md5"
+	case 40:
+		return "sha1"
+	case 64:
+		return "sha256"
+	}
+	return ""
+}
+
+func newHash(algo string) hash.Hash {
+	switch algo {
+	case "md5":
+		return md5.New()
+	case "sha1":
+		return sha1.New()
+	case "sha256":
+		return sha256.New()
+	case "crc32":
+		return crc32.NewIEEE()
+	}
+	return nil
+}
+
+// verifyChecksums проверяет файлы по спискам контрольных сумм из раздачи.
+// Возвращает число проверенных файлов; если списков нет - 0 и nil.
+func verifyChecksums(ctx context.Context, root string, onRead func(done, total int64)) (int, error) {
+	entries, err := findChecksums(root)
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+
+	var total int64
+	for _, entry := range entries {
+		if info, err := os.Stat(entry.Path); err == nil {
+			total += info.Size()
+		}
+	}
+
+	var done int64
+	var failed []string
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		rel, _ := filepath.Rel(root, entry.Path)
+		f, err := os.Open(entry.Path)
+		if err != nil {
+			failed = append(failed, rel+" (missing)")
+			continue
+		}
+
+		h := newHash(entry.Algo)
+		_, err = io.Copy(h, &countingReader{r: f, onRead: func(n int64) {
+			done += n
+			onRead(done, total)
+		}})
+		f.Close()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %w", rel, err)
+		}
+
+		if hex.EncodeToString(h.Sum(nil)) != entry.Sum {
+			failed = append(failed, rel)
+		}
+	}
+
+	if len(failed) > 0 {
+		if len(failed) > 5 {
+			failed = append(failed[:5], fmt.Sprintf("and %d more", len(failed)-5))
+		}
+		return 0, fmt.Errorf("%w: %s", ErrChecksumMismatch, strings.Join(failed, ", "))
+	}
+	return len(entries), nil
+}
@@ -0,0 +1,83 @@
+package download
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyChecksums(t *testing.T) {
+	exe := gameFiles["game.exe"]
+	pak := gameFiles["data/level1.pak"]
+	crc := fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(exe)))
+	md5sum := fmt.Sprintf("%x", md5.Sum([]byte(exe)))
+	sha1sum := fmt.Sprintf("%x", sha1.Sum([]byte(pak)))
+	sha256sum := fmt.Sprintf("%x", sha256.Sum256([]byte(pak)))
+	bad := strings.Repeat("0", 64)
+
+	tests := []struct {
+		name      string
+		manifests map[string]string
+		want      int
+		wantErr   string // подстрока ошибки ErrChecksumMismatch
+	}{
+		{"no manifests", nil, 0, ""},
+		{"sfv", map[string]string{"game.sfv": "; comment\ngame.exe " + strings.ToUpper(crc) + "\n"}, 1, ""},
+		{"gnu md5sums", map[string]string{"MD5SUMS": md5sum + "  game.exe\n" + fmt.Sprintf("%x", md5.Sum([]byte(pak))) + " *data/level1.pak\n"}, 2, ""},
+		{"bsd sha256", map[string]string{"game.sha256": "SHA256 (data/level1.pak) = " + sha256sum + "\n"}, 1, ""},
+		{"sha1 in subdirectory", map[string]string{"data/level1.pak.sha1": sha1sum + "\n"}, 1, ""},
+		{"several manifests", map[string]string{"game.sfv": "game.exe " + crc, "SHA256SUMS": sha256sum + "  data/level1.pak"}, 2, ""},
+		{"mismatch", map[string]string{"SHA256SUMS": bad + "  data/level1.pak"}, 0, "data/level1.pak"},
+		{"sfv mismatch", map[string]string{"game.sfv": "game.exe deadbeef"}, 0, "game.exe"},
+		{"missing file", map[string]string{"MD5SUMS": md5sum + "  setup.exe"}, 0, "setup.exe (missing)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for name, data := range gameFiles {
+				writeTestFile(t, filepath.Join(root, filepath.FromSlash(name)), []byte(data))
+			}
+			for name, data := range tt.manifests {
+				writeTestFile(t, filepath.Join(root, filepath.FromSlash(name)), []byte(data))
+			}
+
+			var done, total int64
+			n, err := verifyChecksums(context.Background(), root, func(d, tot int64) { done, total = d, tot })
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrChecksumMismatch) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want checksum mismatch for %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != tt.want {
+				t.Fatalf("verified %d files, want %d", n, tt.want)
+			}
+			if n > 0 && (done == 0 || done != total) {
+				t.Errorf("progress %d/%d, want all bytes read", done, total)
+			}
+		})
+	}
+}
+
+func TestVerifyChecksumsCanceled(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "game.exe"), []byte(gameFiles["game.exe"]))
+	writeTestFile(t, filepath.Join(root, "game.sfv"), []byte("game.exe 00000000"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := verifyChecksums(ctx, root, func(int64, int64) {}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+}
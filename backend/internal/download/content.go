@@ -0,0 +1,209 @@
+package download
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"gamecloud/internal/models"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrContentNotReady - загрузка еще не завершена
+	ErrContentNotReady = errors.New("download is not completed")
+	// ErrContentUnavailable - файлов загрузки нет на диске
+	ErrContentUnavailable = errors.New("download content is not available on disk")
+	// ErrContentNotFound - запрошенного файла нет в загрузке
+	ErrContentNotFound = errors.New("file not found in download")
+)
+
+// Форматы архива для выгрузки игры целиком
+const (
+	ArchiveZip = "zip"
+	ArchiveTar = "tar"
+)
+
+// ContentEntry - файл завершенной загрузки
+type ContentEntry struct {
+	Path     string    `json:"path"` // относительно корня загрузки, через "/"
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// ContentTree - файлы завершенной загрузки
+type ContentTree struct {
+	Name      string         `json:"name"`
+	TotalSize int64          `json:"total_size"`
+	Files     []ContentEntry `json:"files"`
+}
+
+// ContentRoot возвращает путь к файлам завершенной загрузки: каталог или один файл
+func ContentRoot(download *models.Download) (string, error) {
+	if download.Status != "completed" && download.Status != "seeding" {
+		return "", ErrContentNotReady
+	}
+
+	root := download.InstallPath
+	if root == "" {
+		root = download.Game.FilePath
+	}
+	if root == "" {
+		return "", ErrContentUnavailable
+	}
+	if _, err := os.Stat(root); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrContentUnavailable, err)
+	}
+	return root, nil
+}
+
+// walkContent обходит обычные файлы загрузки; для загрузки из одного файла - только его.
+// Символические ссылки пропускаются, чтобы не выдать файлы вне каталога игры.
+func walkContent(root string, fn func(path, rel string, info fs.FileInfo) error) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel := filepath.Base(path)
+		if path != root {
+			if rel, err = filepath.Rel(root, path); err != nil {
+				return err
+			}
+		}
+		return fn(path, filepath.ToSlash(rel), info)
+	})
+}
+
+// ListContent возвращает все файлы завершенной загрузки
+func ListContent(root string) (*ContentTree, error) {
+	tree := &ContentTree{Name: filepath.Base(root), Files: []ContentEntry{}}
+	err := walkContent(root, func(_, rel string, info fs.FileInfo) error {
+		tree.Files = append(tree.Files, ContentEntry{
+			Path:     rel,
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+		})
+		tree.TotalSize += info.Size()
+		return nil
+	})
+	return tree, err
+}
+
+// OpenContentFile открывает файл загрузки по относительному пути
+func OpenContentFile(root, name string) (*os.File, fs.FileInfo, error) {
+	var path string
+	if info, err := os.Stat(root); err == nil && !info.IsDir() {
+		// Загрузка из одного файла
+		if strings.Trim(name, "/") != filepath.Base(root) {
+			return nil, nil, ErrContentNotFound
+		}
+		path = root
+	} else {
+		var err error
+		if path, err = safeJoin(root, strings.TrimPrefix(name, "/")); err != nil {
+			return nil, nil, ErrContentNotFound
+		}
+	}
+
+	// Ссылка не должна вести за пределы каталога игры
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, nil, ErrContentNotFound
+	}
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resolved != resolvedRoot && !strings.HasPrefix(resolved, resolvedRoot+string(filepath.Separator)) {
+		return nil, nil, ErrContentNotFound
+	}
+
+	f, err := os.Open(resolved)
+	if err != nil {
+		return nil, nil, ErrContentNotFound
+	}
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		f.Close()
+		return nil, nil, ErrContentNotFound
+	}
+	return f, info, nil
+}
+
+// ContentETag - ETag файла по размеру и времени изменения
+func ContentETag(info fs.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano())
+}
+
+// WriteArchive пишет все файлы загрузки в w в формате zip или tar. Архив собирается на
+// лету, без временных файлов; файлы внутри лежат в каталоге с именем игры.
+func WriteArchive(ctx context.Context, w io.Writer, root, format, name string) error {
+	switch format {
+	case ArchiveZip:
+		zw := zip.NewWriter(w)
+		err := walkContent(root, func(path, rel string, info fs.FileInfo) error {
+			header, err := zip.FileInfoHeader(info)
+			if err != nil {
+				return err
+			}
+			header.Name = name + "/" + rel
+			// Игры обычно уже сжаты - не тратим CPU на повторное сжатие
+			header.Method = zip.Store
+			entry, err := zw.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			return copyContentFile(ctx, entry, path)
+		})
+		if err != nil {
+			return err
+		}
+		return zw.Close()
+
+	case ArchiveTar:
+		tw := tar.NewWriter(w)
+		err := walkContent(root, func(path, rel string, info fs.FileInfo) error {
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			header.Name = name + "/" + rel
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			return copyContentFile(ctx, tw, path)
+		})
+		if err != nil {
+			return err
+		}
+		return tw.Close()
+	}
+	return fmt.Errorf("unsupported archive format %q", format)
+}
+
+func copyContentFile(ctx context.Context, w io.Writer, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
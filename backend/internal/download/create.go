@@ -0,0 +1,307 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gamecloud/internal/models"
+	"gamecloud/internal/torrent"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrPathNotAllowed - каталог вне разрешенных ALLOWED_BASE_PATHS
+var ErrPathNotAllowed = errors.New("path is outside of allowed base paths")
+
+// Как часто сохранять и рассылать прогресс хеширования
+const createProgressInterval = time.Second
+
+// CreateTorrentRequest - параметры создания торрента из каталога сервера
+type CreateTorrentRequest struct {
+	Path string `json:"path" binding:"required"`
+	// Существующая игра пользователя; если не указана, создается новая
+	GameID   *uuid.UUID `json:"game_id"`
+	Title    string     `json:"title"`
+	Trackers []string   `json:"trackers"`
+	Private  bool       `json:"private"`
+	Comment  string     `json:"comment"`
+}
+
+// ResolveAllowedPath приводит путь к абсолютному без символических ссылок и проверяет,
+// что он лежит внутри одного из ALLOWED_BASE_PATHS
+func (m *Manager) ResolveAllowedPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", err
+	}
+
+	for _, base := range m.cfg.TorrentConfig.AllowedBasePaths {
+		baseAbs, err := filepath.Abs(base)
+		if err != nil {
+			continue
+		}
+		if baseResolved, err := filepath.EvalSymlinks(baseAbs); err == nil {
+			baseAbs = baseResolved
+		}
+		rel, err := filepath.Rel(baseAbs, resolved)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrPathNotAllowed, path)
+}
+
+// CreateTorrent создает загрузку для торрента из каталога сервера. Части хешируются в
+// фоне (статус creating), после чего торрент сразу начинает раздаваться (статус seeding).
+func (m *Manager) CreateTorrent(userID string, req CreateTorrentRequest) (*models.Download, error) {
+	if m.torrentClient == nil {
+		return nil, ErrNotSupported
+	}
+	for _, u := range req.Trackers {
+		if !torrent.ValidTrackerURL(u) {
+			return nil, fmt.Errorf("%w: %s", torrent.ErrInvalidTracker, u)
+		}
+	}
+
+	path, err := m.ResolveAllowedPath(req.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var game models.Game
+	if req.GameID != nil {
+		if err := m.db.First(&game, "id = ? AND user_id = ?", *req.GameID, userID).Error; err != nil {
+			return nil, err
+		}
+	} else {
+		title := strings.TrimSpace(req.Title)
+		if title == "" {
+			title = filepath.Base(path)
+		}
+		game = models.Game{UserID: userID, Title: title, Status: "not_available"}
+		if err := m.db.Create(&game).Error; err != nil {
+			return nil, fmt.Errorf("failed to create game: %w", err)
+		}
+	}
+
+	started := time.Now()
+	download := &models.Download{
+		UserID:      userID,
+		GameID:      game.ID,
+		Game:        game,
+		Status:      "creating",
+		InstallPath: path,
+		StartedAt:   &started,
+	}
+	if err := m.db.Create(download).Error; err != nil {
+		return nil, fmt.Errorf("failed to save download to database: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.mu.Lock()
+	m.creating[download.ID] = cancel
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go m.runCreateTorrent(ctx, download, torrent.CreateOptions{
+		Path:     path,
+		Trackers: req.Trackers,
+		Private:  req.Private,
+		Comment:  req.Comment,
+	})
+
+	log.Printf("Creating torrent from %s for %s", path, game.Title)
+	return download, nil
+}
+
+func (m *Manager) runCreateTorrent(ctx context.Context, download *models.Download, opts torrent.CreateOptions) {
+	defer m.wg.Done()
+	defer func() {
+		m.mu.Lock()
+		if cancel, ok := m.creating[download.ID]; ok {
+			cancel()
+			delete(m.creating, download.ID)
+		}
+		m.mu.Unlock()
+	}()
+
+	var lastUpdate time.Time
+	mi, err := torrent.CreateTorrent(ctx, opts, func(done, total int64) {
+		if time.Since(lastUpdate) < createProgressInterval && done < total {
+			return
+		}
+		lastUpdate = time.Now()
+
+		download.TotalBytes = total
+		download.DownloadedBytes = done
+		download.Progress = float64(done) / float64(total) * 100
+		m.db.Model(download).Updates(map[string]interface{}{
+			"total_bytes":      download.TotalBytes,
+			"downloaded_bytes": download.DownloadedBytes,
+			"progress":         download.Progress,
+		})
+		m.broadcastCreateProgress(download)
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			// Загрузку удалили или сервер останавливается
+			log.Printf("Torrent creation cancelled: %s", download.Game.Title)
+			return
+		}
+		m.failCreate(download, err)
+		return
+	}
+
+	infoHash := mi.HashInfoBytes().HexString()
+
+	// Сохраняем .torrent рядом с загруженными торрент-файлами
+	torrentName := filepath.Join("created", infoHash+".torrent")
+	torrentPath := filepath.Join(m.cfg.TorrentConfig.DownloadDir, torrentName)
+	if err := os.MkdirAll(filepath.Dir(torrentPath), 0755); err != nil {
+		log.Printf("Failed to create torrent directory: %v", err)
+	}
+	if f, err := os.Create(torrentPath); err != nil {
+		log.Printf("Failed to save created torrent file: %v", err)
+	} else {
+		if err := mi.Write(f); err != nil {
+			log.Printf("Failed to save created torrent file: %v", err)
+		}
+		f.Close()
+		download.TorrentURL = torrentName
+	}
+
+	magnet, err := torrent.MagnetLink(mi)
+	if err != nil {
+		m.failCreate(download, err)
+		return
+	}
+	if _, err := m.torrentClient.Seed(mi, opts.Path, download.ID.String(), true); err != nil {
+		m.failCreate(download, fmt.Errorf("failed to start seeding: %w", err))
+		return
+	}
+
+	completed := time.Now()
+	download.InfoHash = infoHash
+	download.MagnetURL = magnet
+	download.Status = "seeding"
+	download.Progress = 100
+	download.DownloadedBytes = download.TotalBytes
+	download.CompletedAt = &completed
+	download.Error = ""
+	if err := m.db.Save(download).Error; err != nil {
+		log.Printf("Failed to save created torrent download: %v", err)
+	}
+
+	m.db.Model(&models.Game{}).Where("id = ?", download.GameID).Updates(map[string]interface{}{
+		"status":    "available",
+		"file_path": opts.Path,
+		"size":      download.TotalBytes,
+	})
+
+	m.broadcastCreateProgress(download)
+	log.Printf("Created torrent %s for %s, seeding", infoHash, download.Game.Title)
+}
+
+// failCreate отмечает создание торрента неудачным; повторять его автоматически незачем
+func (m *Manager) failCreate(download *models.Download, err error) {
+	log.Printf("Failed to create torrent for %s: %v", download.Game.Title, err)
+	download.Status = "failed"
+	download.Error = err.Error()
+	download.ErrorKind = ErrorKindPermanent
+	if dbErr := m.db.Save(download).Error; dbErr != nil {
+		log.Printf("Failed to save failed download %s: %v", download.ID, dbErr)
+	}
+	m.broadcastCreateProgress(download)
+}
+
+func (m *Manager) broadcastCreateProgress(download *models.Download) {
+	if m.wsHub == nil {
+		return
+	}
+	m.wsHub.BroadcastProgress(download.UserID, torrent.ProgressUpdate{
+		ID:         download.ID.String(),
+		InfoHash:   download.InfoHash,
+		Name:       download.Game.Title,
+		Size:       download.TotalBytes,
+		Downloaded: download.DownloadedBytes,
+		Progress:   download.Progress,
+		Status:     download.Status,
+		Error:      download.Error,
+		UpdatedAt:  time.Now(),
+	})
+}
+
+// cancelCreate прерывает хеширование создаваемого торрента. Вызывается с захваченным m.mu.
+func (m *Manager) cancelCreate(id uuid.UUID) bool {
+	cancel, ok := m.creating[id]
+	if ok {
+		cancel()
+		delete(m.creating, id)
+	}
+	return ok
+}
+
+// resumeSeeding возобновляет раздачу созданных торрентов после перезапуска. Прерванное
+// хеширование не возобновляется: параметры создания не сохраняются.
+func (m *Manager) resumeSeeding() {
+	if m.torrentClient == nil {
+		return
+	}
+
+	var interrupted []models.Download
+	m.db.Where("status = ?", "creating").Find(&interrupted)
+	for i := range interrupted {
+		interrupted[i].Status = "failed"
+		interrupted[i].Error = "Torrent creation was interrupted by server restart"
+		interrupted[i].ErrorKind = ErrorKindPermanent
+		m.db.Save(&interrupted[i])
+	}
+
+	var downloads []models.Download
+	m.db.Preload("Game").Where("status = ? AND info_hash <> ''", "seeding").Find(&downloads)
+	for _, download := range downloads {
+		mi, err := m.torrentClient.LoadCachedMetainfo(download.InfoHash)
+		if err != nil {
+			log.Printf("No cached metainfo for seeding %s: %v", download.Game.Title, err)
+			continue
+		}
+		if _, err := m.torrentClient.Seed(mi, download.InstallPath, download.ID.String(), false); err != nil {
+			log.Printf("Failed to resume seeding %s: %v", download.Game.Title, err)
+			continue
+		}
+		log.Printf("Resumed seeding: %s", download.Game.Title)
+	}
+}
+
+// GetTorrentFile возвращает .torrent файл загрузки: сохраненный на диске, если торрент
+// создан или загружен файлом, иначе собранный из кэша метаданных
+func (m *Manager) GetTorrentFile(download *models.Download) ([]byte, error) {
+	if download.TorrentURL != "" && !strings.Contains(download.TorrentURL, "://") {
+		path, err := safeJoin(m.cfg.TorrentConfig.DownloadDir, download.TorrentURL)
+		if err == nil {
+			if data, err := os.ReadFile(path); err == nil {
+				return data, nil
+			}
+		}
+	}
+	if m.torrentClient == nil {
+		return nil, ErrNotSupported
+	}
+	if download.InfoHash == "" {
+		return nil, torrent.ErrTorrentNotFound
+	}
+	data, err := m.torrentClient.MetainfoBytes(download.InfoHash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", torrent.ErrTorrentNotFound, download.InfoHash)
+	}
+	return data, nil
+}
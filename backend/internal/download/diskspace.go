@@ -0,0 +1,265 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Alert описывает системное уведомление, отправляемое пользователю через WebSocket
+type Alert struct {
+	Level      string    `json:"level"` // info, warning, error
+	Code       string    `json:"code"`
+	Message    string    `json:"message"`
+	DownloadID string    `json:"download_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+const lowDiskSpaceError = "Paused: low disk space"
+
+// ErrInsufficientDiskSpace - торрент не помещается на диск с учетом других загрузок
+var ErrInsufficientDiskSpace = errors.New("insufficient disk space")
+
+// checkDiskSpace проверяет, поместится ли загрузка на диск с учетом остальных активных
+// загрузок на той же файловой системе. Вызывается клиентом загрузки, как только становится
+// известен размер данных; dir - директория, в которую клиент будет их записывать.
+func (m *Manager) checkDiskSpace(downloadID, dir string, size int64) error {
+	m.mu.Lock()
+	m.dataDirs[downloadID] = dir
+	m.mu.Unlock()
+
+	return m.ensureFreeSpace(dir, size, downloadID)
+}
+
+// ensureFreeSpace проверяет, что в dir можно записать size байт, не опустившись ниже
+// MinFreeSpace, с учетом того, что еще докачают другие загрузки на этой файловой системе.
+// Загрузка excludeID (и загрузки того же торрента) в резерв не входит.
+func (m *Manager) ensureFreeSpace(dir string, size int64, excludeID string) error {
+	dir = existingDir(dir)
+	free, err := freeDiskSpace(dir)
+	if err != nil {
+		// Не можем проверить - не блокируем загрузку
+		log.Printf("Failed to check free disk space: %v", err)
+		return nil
+	}
+
+	reserved := m.reservedBytes(excludeID, filesystemKey(dir))
+	available := free - reserved - m.cfg.TorrentConfig.MinFreeSpace
+	if size > available {
+		if available < 0 {
+			available = 0
+		}
+		return fmt.Errorf("%w: need %s in %s, available %s (%s free, %s reserved by other downloads, %s minimum free space)",
+			ErrInsufficientDiskSpace, formatBytes(size), dir, formatBytes(available), formatBytes(free),
+			formatBytes(reserved), formatBytes(m.cfg.TorrentConfig.MinFreeSpace))
+	}
+
+	return nil
+}
+
+// reservedBytes считает, сколько байт еще докачают остальные активные загрузки на файловой
+// системе fs. Общий торрент нескольких владельцев (одинаковый info hash) учитывается один раз.
+func (m *Manager) reservedBytes(excludeID, fs string) int64 {
+	type pending struct {
+		dir       string
+		infoHash  string
+		remaining int64
+	}
+
+	m.mu.RLock()
+	var excludeHash string
+	var jobs []pending
+	for _, job := range m.downloads {
+		if job.Download == nil {
+			continue
+		}
+		if job.TorrentID == excludeID {
+			excludeHash = job.Download.InfoHash
+			continue
+		}
+		if remaining := job.Download.TotalBytes - job.Download.DownloadedBytes; remaining > 0 {
+			jobs = append(jobs, pending{m.jobDir(job), job.Download.InfoHash, remaining})
+		}
+	}
+	m.mu.RUnlock()
+
+	var reserved int64
+	counted := make(map[string]bool)
+	for _, job := range jobs {
+		if job.infoHash != "" {
+			// Данные общего торрента скачиваются один раз
+			if job.infoHash == excludeHash || counted[job.infoHash] {
+				continue
+			}
+			counted[job.infoHash] = true
+		}
+		if filesystemKey(existingDir(job.dir)) == fs {
+			reserved += job.remaining
+		}
+	}
+	return reserved
+}
+
+// jobDir возвращает директорию, в которую пишет данные загрузка: ту, о которой сообщил
+// клиент при проверке места, а до нее - директорию по конфигурации.
+// Вызывается с захваченным m.mu.
+func (m *Manager) jobDir(job *DownloadJob) string {
+	if dir, ok := m.dataDirs[job.TorrentID]; ok {
+		return dir
+	}
+
+	download := job.Download
+	switch {
+	case job.direct:
+		return filepath.Join(m.cfg.Direct.DownloadDir, download.ID.String())
+	case download.DataPath != "":
+		return download.DataPath
+	case m.torrentClient == nil && m.cfg.Transmission.LocalDir != "":
+		return m.cfg.Transmission.LocalDir
+	}
+	return m.cfg.TorrentConfig.DownloadDir
+}
+
+// existingDir возвращает ближайший существующий путь: директория загрузки может быть еще
+// не создана, а место считается на файловой системе, где она появится
+func existingDir(path string) string {
+	path = filepath.Clean(path)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+// filesystemKey возвращает идентификатор файловой системы path. Если устройство узнать
+// не удалось, каждый путь считается отдельной файловой системой.
+func filesystemKey(path string) string {
+	if dev, err := diskDevice(path); err == nil {
+		return fmt.Sprintf("dev:%d", dev)
+	}
+	return "path:" + path
+}
+
+// diskWatchdog периодически проверяет свободное место и приостанавливает загрузки,
+// если его становится меньше заданного порога
+func (m *Manager) diskWatchdog() {
+	defer m.wg.Done()
+
+	interval := m.cfg.TorrentConfig.DiskCheckInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.checkLowDiskSpace()
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+// lowSpaceJob - загрузка, которую приостановит проверка места. Поля копируются под
+// m.mu, чтобы не читать job.Download без блокировки.
+type lowSpaceJob struct {
+	id     uuid.UUID
+	userID string
+}
+
+// checkLowDiskSpace проверяет каждую файловую систему, на которую пишут загрузки, и
+// приостанавливает загрузки той из них, где места меньше порога
+func (m *Manager) checkLowDiskSpace() {
+	type filesystem struct {
+		dir  string
+		jobs []lowSpaceJob
+	}
+
+	// Собираем загрузки, которые еще пишут на диск
+	m.mu.RLock()
+	dirs := make(map[lowSpaceJob]string)
+	for _, job := range m.downloads {
+		if job.Download == nil {
+			continue
+		}
+		switch job.Download.Status {
+		case "downloading", "pending", "waiting":
+			dirs[lowSpaceJob{job.Download.ID, job.Download.UserID}] = m.jobDir(job)
+		}
+	}
+	m.mu.RUnlock()
+
+	filesystems := make(map[string]*filesystem)
+	for job, dir := range dirs {
+		dir = existingDir(dir)
+		key := filesystemKey(dir)
+		if filesystems[key] == nil {
+			filesystems[key] = &filesystem{dir: dir}
+		}
+		filesystems[key].jobs = append(filesystems[key].jobs, job)
+	}
+
+	for _, fs := range filesystems {
+		free, err := freeDiskSpace(fs.dir)
+		if err != nil || free >= m.cfg.TorrentConfig.MinFreeSpace {
+			continue
+		}
+		m.pauseLowDiskSpace(fs.dir, free, fs.jobs)
+	}
+}
+
+// pauseLowDiskSpace приостанавливает загрузки, пишущие на заполненную файловую систему
+func (m *Manager) pauseLowDiskSpace(dir string, free int64, jobs []lowSpaceJob) {
+	log.Printf("Low disk space in %s: %s free (minimum %s), pausing %d downloads",
+		dir, formatBytes(free), formatBytes(m.cfg.TorrentConfig.MinFreeSpace), len(jobs))
+
+	for _, job := range jobs {
+		// Статус и ошибка меняются под m.mu, как при ручной паузе
+		if err := m.pauseDownload(job.id, lowDiskSpaceError); err != nil {
+			log.Printf("Failed to pause download %s on low disk space: %v", job.id, err)
+			continue
+		}
+
+		m.sendAlert(job.userID, Alert{
+			Level:      "error",
+			Code:       "low_disk_space",
+			Message:    fmt.Sprintf("Download paused: only %s of free disk space left", formatBytes(free)),
+			DownloadID: job.id.String(),
+			CreatedAt:  time.Now(),
+		})
+	}
+}
+
+// sendAlert отправляет уведомление пользователю, если подключен WebSocket hub
+func (m *Manager) sendAlert(userID string, alert Alert) {
+	if m.wsHub == nil {
+		return
+	}
+	m.wsHub.BroadcastMessage(userID, "alert", alert)
+}
+
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package download
+
+import "errors"
+
+// freeDiskSpace не поддерживается на этой платформе, проверки места отключаются
+func freeDiskSpace(path string) (int64, error) {
+	return 0, errors.New("free disk space check is not supported on this platform")
+}
+
+// diskDevice не поддерживается на этой платформе
+func diskDevice(path string) (uint64, error) {
+	return 0, errors.New("disk device lookup is not supported on this platform")
+}
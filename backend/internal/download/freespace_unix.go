@@ -0,0 +1,23 @@
+//go:build unix
+
+package download
+
+import "syscall"
+
+// freeDiskSpace возвращает количество свободных байт, доступных на файловой системе path
+func freeDiskSpace(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
+
+// diskDevice возвращает идентификатор устройства файловой системы, на которой лежит path
+func diskDevice(path string) (uint64, error) {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Dev), nil
+}
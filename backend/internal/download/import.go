@@ -0,0 +1,68 @@
+package download
+
+import (
+	"bytes"
+	"gamecloud/internal/models"
+	"log"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+// ImportRequest - подключение уже существующих данных игры к торренту
+type ImportRequest struct {
+	GameID uuid.UUID `json:"game_id" binding:"required"`
+	// Каталог многофайлового торрента или файл однофайлового; имя может отличаться от
+	// имени в торренте
+	Path       string `json:"path" binding:"required"`
+	MagnetURL  string `json:"magnet_url"`
+	TorrentURL string `json:"torrent_url"`
+}
+
+// ImportDownload создает загрузку поверх существующих данных: хеши всех частей
+// проверяются на месте, после чего докачиваются только недостающие и поврежденные
+// части. Подходит и для восстановления испорченной установки. torrentFile - содержимое
+// загруженного .torrent файла (nil, если используется magnet_url или torrent_url).
+func (m *Manager) ImportDownload(userID string, req ImportRequest, torrentFile []byte, torrentName string) (*models.Download, error) {
+	if m.torrentClient == nil {
+		return nil, ErrNotSupported
+	}
+	if torrentFile == nil && req.MagnetURL == "" && req.TorrentURL == "" {
+		return nil, errNoSource
+	}
+
+	path, err := m.ResolveAllowedPath(req.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var game models.Game
+	if err := m.db.First(&game, "id = ? AND user_id = ?", req.GameID, userID).Error; err != nil {
+		return nil, err
+	}
+
+	download := &models.Download{
+		UserID:     userID,
+		GameID:     game.ID,
+		Game:       game,
+		Status:     "queued",
+		MagnetURL:  req.MagnetURL,
+		TorrentURL: req.TorrentURL,
+		DataPath:   path,
+		VerifyData: true,
+	}
+
+	if torrentFile != nil {
+		download.MagnetURL = ""
+		download.TorrentURL = filepath.Join("import", filepath.Base(torrentName))
+		err = m.AddTorrentFile(download, bytes.NewReader(torrentFile))
+	} else {
+		err = m.AddDownload(download)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Importing existing data from %s for %s", path, game.Title)
+	return download, nil
+}
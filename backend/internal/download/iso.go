@@ -0,0 +1,292 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf16"
+)
+
+// Образы дисков ISO 9660 читаются напрямую: дерево каталогов берется из дополнительного
+// тома Joliet (длинные имена в UCS-2), а если его нет - из основного тома. Образы только
+// с UDF (без моста ISO 9660) не поддерживаются.
+
+const (
+	isoSectorSize = 2048
+	// Дескрипторы томов начинаются с 16-го сектора
+	isoDescriptorStart = 16
+
+	isoDescriptorPrimary       = 1
+	isoDescriptorSupplementary = 2
+	isoDescriptorTerminator    = 255
+
+	isoFlagDirectory   = 0x02
+	isoFlagMultiExtent = 0x80
+
+	// Защита от зацикленных и поврежденных образов
+	isoMaxDescriptors = 64
+	isoMaxDepth       = 64
+)
+
+// isoSignatureOffset - смещение сигнатуры CD001 первого дескриптора тома
+const isoSignatureOffset = isoDescriptorStart*isoSectorSize + 1
+
+// ErrUnsupportedImage - образ диска не содержит файловой системы ISO 9660
+var ErrUnsupportedImage = errors.New("unsupported disk image")
+
+// isoRecord - запись каталога: файл или подкаталог
+type isoRecord struct {
+	name    string
+	dir     bool
+	extents []isoExtent // у файлов больше 4 GiB несколько экстентов
+	// Файл продолжается в следующей записи с тем же именем
+	continued bool
+}
+
+type isoExtent struct {
+	lba  int64
+	size int64
+}
+
+func (r *isoRecord) size() int64 {
+	var size int64
+	for _, e := range r.extents {
+		size += e.size
+	}
+	return size
+}
+
+// isoVolume - файловая система образа
+type isoVolume struct {
+	r      io.ReaderAt
+	root   isoExtent
+	joliet bool
+}
+
+// openISOVolume читает дескрипторы томов и выбирает корневой каталог
+func openISOVolume(r io.ReaderAt) (*isoVolume, error) {
+	var primary, joliet *isoVolume
+	buf := make([]byte, isoSectorSize)
+
+	for i := 0; i < isoMaxDescriptors; i++ {
+		if _, err := r.ReadAt(buf, int64(isoDescriptorStart+i)*isoSectorSize); err != nil {
+			return nil, fmt.Errorf("%w: failed to read volume descriptor: %v", ErrUnsupportedImage, err)
+		}
+		if string(buf[1:6]) != "CD001" {
+			break
+		}
+
+		kind := buf[0]
+		if kind == isoDescriptorTerminator {
+			break
+		}
+		if kind != isoDescriptorPrimary && kind != isoDescriptorSupplementary {
+			continue
+		}
+
+		root, _, err := parseISORecord(buf[156:190], false)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+		}
+		vol := &isoVolume{r: r, root: root.extents[0]}
+		if kind == isoDescriptorPrimary && primary == nil {
+			primary = vol
+		}
+		// Joliet отличается escape-последовательностью UCS-2 уровней 1-3
+		escape := buf[88:91]
+		if kind == isoDescriptorSupplementary && escape[0] == '%' && escape[1] == '/' &&
+			(escape[2] == '@' || escape[2] == 'C' || escape[2] == 'E') {
+			vol.joliet = true
+			joliet = vol
+		}
+	}
+
+	if joliet != nil {
+		return joliet, nil
+	}
+	if primary != nil {
+		return primary, nil
+	}
+	return nil, fmt.Errorf("%w: no ISO 9660 volume (UDF-only images are not supported)", ErrUnsupportedImage)
+}
+
+// parseISORecord разбирает запись каталога. Возвращает запись и ее длину; длина 0 -
+// до конца сектора записей нет.
+func parseISORecord(b []byte, joliet bool) (*isoRecord, int, error) {
+	if len(b) == 0 || b[0] == 0 {
+		return nil, 0, nil
+	}
+	length := int(b[0])
+	if length < 34 || length > len(b) {
+		return nil, 0, errors.New("malformed directory record")
+	}
+	nameLen := int(b[32])
+	if 33+nameLen > length {
+		return nil, 0, errors.New("malformed directory record name")
+	}
+
+	rec := &isoRecord{
+		dir: b[25]&isoFlagDirectory != 0,
+		extents: []isoExtent{{
+			lba:  int64(binary.LittleEndian.Uint32(b[2:6])),
+			size: int64(binary.LittleEndian.Uint32(b[10:14])),
+		}},
+	}
+
+	name := b[33 : 33+nameLen]
+	switch {
+	case nameLen == 1 && (name[0] == 0 || name[0] == 1):
+		// Записи "." и ".."
+		rec.name = string(name)
+	case joliet:
+		u := make([]uint16, nameLen/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(name[2*i:])
+		}
+		rec.name = string(utf16.Decode(u))
+	default:
+		rec.name = string(name)
+	}
+	if !rec.dir {
+		// Номер версии файла (";1") и точка у имен без расширения не являются частью имени
+		if i := strings.LastIndexByte(rec.name, ';'); i >= 0 {
+			rec.name = rec.name[:i]
+		}
+		rec.name = strings.TrimSuffix(rec.name, ".")
+	}
+	rec.continued = b[25]&isoFlagMultiExtent != 0
+	return rec, length, nil
+}
+
+// readDir читает записи каталога, склеивая экстенты файлов больше 4 GiB
+func (v *isoVolume) readDir(dir isoExtent) ([]*isoRecord, error) {
+	data := make([]byte, dir.size)
+	if _, err := v.r.ReadAt(data, dir.lba*isoSectorSize); err != nil {
+		return nil, fmt.Errorf("failed to read ISO directory: %w", err)
+	}
+
+	var records []*isoRecord
+	var pending *isoRecord
+	for off := 0; off < len(data); {
+		rec, n, err := parseISORecord(data[off:], v.joliet)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			// Записи не пересекают границу сектора: переходим к следующему
+			off = (off/isoSectorSize + 1) * isoSectorSize
+			continue
+		}
+		off += n
+
+		if rec.name == "\x00" || rec.name == "\x01" {
+			continue
+		}
+
+		if pending != nil {
+			pending.extents = append(pending.extents, rec.extents[0])
+		} else {
+			pending = rec
+		}
+		if !rec.continued {
+			records = append(records, pending)
+			pending = nil
+		}
+	}
+	return records, nil
+}
+
+// walk обходит файлы образа; fn получает путь файла через "/" и его запись
+func (v *isoVolume) walk(ctx context.Context, fn func(name string, rec *isoRecord) error) error {
+	visited := make(map[int64]bool)
+	var walkDir func(dir isoExtent, prefix string, depth int) error
+	walkDir = func(dir isoExtent, prefix string, depth int) error {
+		if depth > isoMaxDepth || visited[dir.lba] {
+			return errors.New("ISO directory tree is too deep or contains a loop")
+		}
+		visited[dir.lba] = true
+
+		records, err := v.readDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, rec := range records {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			name := path.Join(prefix, rec.name)
+			if rec.dir {
+				if err := walkDir(rec.extents[0], name, depth+1); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := fn(name, rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walkDir(v.root, "", 0)
+}
+
+// open возвращает содержимое файла образа
+func (v *isoVolume) open(rec *isoRecord) io.Reader {
+	readers := make([]io.Reader, len(rec.extents))
+	for i, e := range rec.extents {
+		readers[i] = io.NewSectionReader(v.r, e.lba*isoSectorSize, e.size)
+	}
+	return io.MultiReader(readers...)
+}
+
+// isISOImage проверяет сигнатуру первого дескриптора тома
+func isISOImage(r io.ReaderAt) bool {
+	sig := make([]byte, 5)
+	_, err := r.ReadAt(sig, isoSignatureOffset)
+	return err == nil && bytes.Equal(sig, []byte("CD001"))
+}
+
+func extractISO(ctx context.Context, a *archive, dest string, onRead func(int64)) error {
+	ra, err := openParts(a.Parts)
+	if err != nil {
+		return err
+	}
+	defer ra.Close()
+
+	vol, err := openISOVolume(ra)
+	if err != nil {
+		return fmt.Errorf("failed to open disk image %s: %w", a.Name, err)
+	}
+
+	// Прогресс считается по размеру файлов: служебные секторы образа не распаковываются
+	var total int64
+	if err := vol.walk(ctx, func(_ string, rec *isoRecord) error {
+		total += rec.size()
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to read disk image %s: %w", a.Name, err)
+	}
+	scale := 1.0
+	if total > 0 {
+		scale = float64(a.Size) / float64(total)
+	}
+
+	return vol.walk(ctx, func(name string, rec *isoRecord) error {
+		target, err := safeJoin(dest, name)
+		if err != nil {
+			return err
+		}
+		r := &countingReader{r: vol.open(rec), onRead: func(n int64) {
+			onRead(int64(float64(n) * scale))
+		}}
+		if err := writeFile(target, r, 0644); err != nil {
+			return fmt.Errorf("failed to extract %s from %s: %w", name, a.Name, err)
+		}
+		return nil
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"gamecloud/internal/config"
+	"gamecloud/internal/direct"
+	"gamecloud/internal/hooks"
 	"gamecloud/internal/models"
 	"gamecloud/internal/torrent"
 	"io"
@@ -21,42 +23,81 @@ import (
 // WebSocketBroadcaster интерфейс для отправки WebSocket сообщений
 type WebSocketBroadcaster interface {
 	BroadcastProgress(userID string, progress torrent.ProgressUpdate)
+	BroadcastMessage(userID string, messageType string, payload interface{})
+}
+
+// HookDispatcher интерфейс для запуска хуков на события загрузки
+type HookDispatcher interface {
+	Fire(event string, download models.Download)
 }
 
 type Manager struct {
-	torrentClient *torrent.Client
+	backend       Backend         // клиент, выполняющий загрузки торрентов
+	torrentClient *torrent.Client // встроенный клиент; nil, если загрузки выполняет внешний демон
+	directClient  *direct.Client // прямые HTTP(S) загрузки
 	db            *gorm.DB
 	cfg           *config.Config
 	downloads     map[uuid.UUID]*DownloadJob
 	progressChans map[string]chan torrent.ProgressUpdate
+	dataDirs      map[string]string // директории данных загрузок клиентов (см. diskspace.go)
 	queue         chan *models.Download
 	workers       int
 	stopCh        chan struct{}
 	wg            sync.WaitGroup
+	monitors      sync.WaitGroup // горутины monitorDownloadProgress
 	mu            sync.RWMutex
 	wsHub         WebSocketBroadcaster // WebSocket hub для real-time обновлений
+	hooks         HookDispatcher
+	creating      map[uuid.UUID]context.CancelFunc // торренты, которые сейчас хешируются
+	transfers     map[uuid.UUID]*transferAccount   // учет переданных данных (см. transfers.go)
+	transfersMu   sync.Mutex
 }
 
 type DownloadJob struct {
 	Download        *models.Download
 	TorrentID       string
 	ProgressChan    chan torrent.ProgressUpdate
+	direct          bool // задача клиента прямых загрузок, а не торрент
 	ctx             context.Context
 	cancel          context.CancelFunc
 	mu              sync.RWMutex
 }
 
-func NewManager(torrentClient *torrent.Client, db *gorm.DB, cfg *config.Config) *Manager {
-	return &Manager{
-		torrentClient: torrentClient,
+// NewManager создает менеджер загрузок. backend может быть nil - тогда доступны только
+// прямые загрузки.
+func NewManager(backend Backend, db *gorm.DB, cfg *config.Config) *Manager {
+	m := &Manager{
+		backend:       backend,
 		db:            db,
 		cfg:           cfg,
 		downloads:     make(map[uuid.UUID]*DownloadJob),
 		progressChans: make(map[string]chan torrent.ProgressUpdate),
+		dataDirs:      make(map[string]string),
+		creating:      make(map[uuid.UUID]context.CancelFunc),
+		transfers:     make(map[uuid.UUID]*transferAccount),
 		queue:         make(chan *models.Download, 100),
 		workers:       5, // Увеличиваем количество воркеров для параллельной обработки
 		stopCh:        make(chan struct{}),
 	}
+
+	// Функции, которых нет у внешних клиентов, доступны только со встроенным
+	if torrentClient, ok := backend.(*torrent.Client); ok {
+		m.torrentClient = torrentClient
+	}
+
+	// Перед стартом каждого торрента проверяем, хватит ли места на диске
+	if backend != nil {
+		backend.SetAdmissionCheck(m.checkDiskSpace)
+	}
+
+	return m
+}
+
+// SetDirectClient подключает клиент прямых HTTP(S) загрузок
+func (m *Manager) SetDirectClient(directClient *direct.Client) {
+	m.directClient = directClient
+	// Место на диске проверяется так же, как для торрентов
+	directClient.SetAdmissionCheck(m.checkDiskSpace)
 }
 
 // SetWebSocketHub устанавливает WebSocket hub для real-time обновлений
@@ -64,8 +105,33 @@ func (m *Manager) SetWebSocketHub(hub WebSocketBroadcaster) {
 	m.wsHub = hub
 }
 
+// SetHookDispatcher подключает хуки на события загрузки
+func (m *Manager) SetHookDispatcher(hooks HookDispatcher) {
+	m.hooks = hooks
+}
+
+// fireHook запускает хуки события; передается копия загрузки, чтобы хуки не зависели
+// от ее дальнейших изменений
+func (m *Manager) fireHook(event string, download *models.Download) {
+	if m.hooks == nil || download == nil {
+		return
+	}
+
+	snapshot := *download
+	if snapshot.Game.ID == uuid.Nil {
+		// Загрузки из API создаются без игры - подгружаем ее для данных хука
+		m.db.First(&snapshot.Game, "id = ?", snapshot.GameID)
+	}
+	m.hooks.Fire(event, snapshot)
+}
+
 func (m *Manager) Start() {
 	log.Println("Starting download manager with enhanced multithreading")
+
+	// Трекеры по умолчанию нужны до возобновления загрузок
+	m.loadDefaultTrackers()
+	m.loadPeerBans()
+	m.resetSessionTotals()
 	
 	// Start workers для обработки очереди
 	for i := 0; i < m.workers; i++ {
@@ -77,24 +143,117 @@ func (m *Manager) Start() {
 	m.wg.Add(1)
 	go m.globalStatusUpdater()
 
+	// Следим за свободным местом на диске
+	m.wg.Add(1)
+	go m.diskWatchdog()
+
+	// Повторяем неудачные загрузки по расписанию
+	m.wg.Add(1)
+	go m.retryScheduler()
+
+	// Учет отданных и скачанных данных, в том числе для раздач
+	m.wg.Add(1)
+	go m.transferAccounting()
+
+	// Временные ряды скоростей и объемов для графиков
+	m.wg.Add(1)
+	go m.metricsRecorder()
+
+	// Импорт торрентов из наблюдаемого каталога
+	if m.cfg.TorrentConfig.WatchDir != "" {
+		m.wg.Add(1)
+		go m.watchFolder()
+	}
+
 	// Resume incomplete downloads
 	go m.resumeDownloads()
+	go m.resumeSeeding()
 }
 
 func (m *Manager) Stop() {
 	log.Println("Stopping download manager")
 	
-	// Останавливаем все активные загрузки
+	// Останавливаем все активные загрузки. Задачи запоминаем: мониторинг удаляет их
+	// из списка при выходе, а их прогресс нужно сохранить.
+	jobs := m.cancelJobs()
 	m.mu.Lock()
-	for _, job := range m.downloads {
-		if job.cancel != nil {
-			job.cancel()
-		}
+	for id := range m.creating {
+		m.cancelCreate(id)
 	}
 	m.mu.Unlock()
 	
 	close(m.stopCh)
 	m.wg.Wait()
+
+	// Воркеры могли успеть запустить загрузки, пока останавливались
+	jobs = append(jobs, m.cancelJobs()...)
+	m.monitors.Wait()
+	m.saveProgress(jobs)
+}
+
+// cancelJobs останавливает мониторинг всех активных загрузок и возвращает их задачи
+func (m *Manager) cancelJobs() []*DownloadJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := make([]*DownloadJob, 0, len(m.downloads))
+	for _, job := range m.downloads {
+		if job.cancel != nil {
+			job.cancel()
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+// saveProgress сохраняет последнее состояние загрузок при остановке сервера: мониторинг
+// мог не успеть прочитать обновления, оставшиеся в канале. Обновляются только поля
+// прогресса - запись загрузки, удаленной во время остановки, не создается заново.
+func (m *Manager) saveProgress(jobs []*DownloadJob) {
+	saved := make(map[uuid.UUID]bool)
+	for _, job := range jobs {
+		if job.Download == nil || saved[job.Download.ID] {
+			continue
+		}
+		saved[job.Download.ID] = true
+		download := job.Download
+
+	drain:
+		for {
+			select {
+			case update, ok := <-job.ProgressChan:
+				if !ok {
+					break drain
+				}
+				// Завершение и ошибки обработаются после перезапуска, когда торрент
+				// снова сообщит о них
+				if update.Status != "completed" && update.Status != "failed" {
+					download.Progress = update.Progress
+					download.DownloadedBytes = update.Downloaded
+					download.TotalBytes = update.Size
+				}
+			default:
+				break drain
+			}
+		}
+
+		// Скорости и пиры после перезапуска будут другими
+		download.DownloadSpeed = 0
+		download.UploadSpeed = 0
+		download.WebSeedSpeed = 0
+		download.PeersConnected = 0
+		download.SeedsConnected = 0
+		download.ETA = 0
+		m.applyTransfers(download)
+
+		if err := m.db.Model(download).Select(
+			"progress", "downloaded_bytes", "total_bytes", "uploaded_bytes",
+			"session_downloaded", "session_uploaded", "download_speed", "upload_speed",
+			"web_seed_speed", "peers_connected", "seeds_connected", "eta",
+		).Updates(download).Error; err != nil {
+			log.Printf("Failed to save progress for %s: %v", download.Game.Title, err)
+		}
+	}
+	log.Printf("Saved progress of %d downloads", len(saved))
 }
 
 func (m *Manager) AddDownload(download *models.Download) error {
@@ -102,6 +261,7 @@ func (m *Manager) AddDownload(download *models.Download) error {
 	if err := m.db.Create(download).Error; err != nil {
 		return fmt.Errorf("failed to save download to database: %w", err)
 	}
+	m.fireHook(hooks.EventQueued, download)
 
 	// Add to queue for processing
 	select {
@@ -118,7 +278,7 @@ func (m *Manager) AddDownload(download *models.Download) error {
 }
 
 func (m *Manager) AddTorrentFile(download *models.Download, torrentFile io.Reader) error {
-	if m.torrentClient == nil {
+	if m.backend == nil {
 		return fmt.Errorf("torrent client is not available")
 	}
 
@@ -126,6 +286,7 @@ func (m *Manager) AddTorrentFile(download *models.Download, torrentFile io.Reade
 	if err := m.db.Create(download).Error; err != nil {
 		return fmt.Errorf("failed to save download to database: %w", err)
 	}
+	m.fireHook(hooks.EventQueued, download)
 
 	// Сохраняем торрент-файл на диск для возможности перезапуска
 	torrentFilePath := filepath.Join(m.cfg.TorrentConfig.DownloadDir, download.TorrentURL)
@@ -154,12 +315,12 @@ func (m *Manager) AddTorrentFile(download *models.Download, torrentFile io.Reade
 	ctx, cancel := context.WithCancel(context.Background())
 	
 	// Запускаем торрент из данных в памяти
-	torrentID, progressChan, err := m.torrentClient.AddTorrentFile(strings.NewReader(string(data)), m.cfg.TorrentConfig.DownloadDir)
+	download.Attempts++
+	torrentID, progressChan, err := m.backend.AddTorrentFile(strings.NewReader(string(data)), m.addOptions(download))
 	if err != nil {
+		cancel()
 		// Обновляем статус ошибки в БД
-		download.Status = "failed"
-		download.Error = err.Error()
-		m.db.Save(download)
+		m.failDownload(download, err)
 		return fmt.Errorf("failed to start torrent: %w", err)
 	}
 
@@ -179,23 +340,21 @@ func (m *Manager) AddTorrentFile(download *models.Download, torrentFile io.Reade
 	m.mu.Unlock()
 
 	// Запускаем мониторинг в отдельной горутине
+	m.monitors.Add(1)
 	go m.monitorDownloadProgress(job)
 	
 	// Обновляем InfoHash в БД после успешного создания торрента
-	activeDownloads := m.torrentClient.GetActiveDownloads()
-	if jobFromClient, exists := activeDownloads[torrentID]; exists && jobFromClient.Torrent != nil {
-		infoHash := jobFromClient.Torrent.InfoHash().String()
-		if infoHash != "" {
-			download.InfoHash = infoHash
-			if err := m.db.Save(download).Error; err != nil {
-				log.Printf("Failed to save InfoHash to database: %v", err)
-			} else {
-				log.Printf("Saved InfoHash %s for torrent file download %s", infoHash, download.Game.Title)
-			}
+	if infoHash, err := m.backend.InfoHash(torrentID); err == nil && infoHash != "" {
+		download.InfoHash = infoHash
+		if err := m.db.Save(download).Error; err != nil {
+			log.Printf("Failed to save InfoHash to database: %v", err)
+		} else {
+			log.Printf("Saved InfoHash %s for torrent file download %s", infoHash, download.Game.Title)
 		}
 	}
 
 	log.Printf("Started torrent download from file: %s", download.Game.Title)
+	m.fireHook(hooks.EventStarted, download)
 	return nil
 }
 
@@ -212,42 +371,59 @@ func (m *Manager) GetAllDownloads() ([]models.Download, error) {
 }
 
 func (m *Manager) PauseDownload(id uuid.UUID) error {
-	if m.torrentClient == nil {
-		return fmt.Errorf("torrent client not available")
-	}
+	return m.pauseDownload(id, "")
+}
 
+// pauseDownload приостанавливает загрузку; непустой reason записывается как ее ошибка
+func (m *Manager) pauseDownload(id uuid.UUID, reason string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if job, exists := m.downloads[id]; exists {
-		// Приостанавливаем в торрент-клиенте
-		if err := m.torrentClient.PauseDownload(job.TorrentID); err != nil {
+		if job.direct {
+			if err := m.directClient.PauseDownload(job.TorrentID); err != nil {
+				return fmt.Errorf("failed to pause download: %w", err)
+			}
+		} else if m.backend == nil {
+			return fmt.Errorf("torrent client not available")
+		} else if err := m.backend.PauseDownload(job.TorrentID); err != nil {
+			// Приостанавливаем в торрент-клиенте
 			return fmt.Errorf("failed to pause torrent: %w", err)
 		}
 		
 		// Обновляем статус в БД
 		job.Download.Status = "paused"
-		return m.db.Save(job.Download).Error
+		columns := map[string]interface{}{"status": "paused"}
+		if reason != "" {
+			job.Download.Error = reason
+			columns["error"] = reason
+		}
+		return m.db.Model(job.Download).Updates(columns).Error
 	}
 	return fmt.Errorf("download not found: %s", id)
 }
 
 func (m *Manager) ResumeDownload(id uuid.UUID) error {
-	if m.torrentClient == nil {
-		return fmt.Errorf("torrent client not available")
-	}
-
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if job, exists := m.downloads[id]; exists {
-		// Возобновляем в торрент-клиенте
-		if err := m.torrentClient.ResumeDownload(job.TorrentID); err != nil {
+		if job.direct {
+			if err := m.directClient.ResumeDownload(job.TorrentID); err != nil {
+				return fmt.Errorf("failed to resume download: %w", err)
+			}
+		} else if m.backend == nil {
+			return fmt.Errorf("torrent client not available")
+		} else if err := m.backend.ResumeDownload(job.TorrentID); err != nil {
+			// Возобновляем в торрент-клиенте
 			return fmt.Errorf("failed to resume torrent: %w", err)
 		}
 		
 		// Обновляем статус в БД
 		job.Download.Status = "downloading"
+		if job.Download.Error == lowDiskSpaceError {
+			job.Download.Error = ""
+		}
 		return m.db.Save(job.Download).Error
 	}
 	
@@ -276,10 +452,33 @@ func (m *Manager) CancelDownload(id uuid.UUID) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if job, exists := m.downloads[id]; exists {
-		// Отменяем в торрент-клиенте (если доступен)
-		if m.torrentClient != nil {
-			if err := m.torrentClient.CancelDownload(job.TorrentID); err != nil {
+	job, exists := m.downloads[id]
+	if exists {
+		m.fireHook(hooks.EventCancelled, job.Download)
+	} else {
+		var download models.Download
+		if err := m.db.Preload("Game").First(&download, "id = ?", id).Error; err == nil {
+			if download.Status != "completed" {
+				m.fireHook(hooks.EventCancelled, &download)
+			}
+			// Созданные торренты хешируются или раздаются вне активных загрузок
+			m.cancelCreate(id)
+			// Завершенная загрузка продолжает раздаваться - отпускаем торрент; он удаляется
+			// из клиента, только если его не скачивают другие пользователи
+			if (download.Status == "seeding" || download.Status == "completed") && download.InfoHash != "" && m.backend != nil {
+				m.backend.DropTorrent(download.InfoHash, download.ID.String())
+			}
+		}
+	}
+
+	if exists {
+		// Отменяем в клиенте загрузки (если доступен)
+		if job.direct {
+			if err := m.directClient.CancelDownload(job.TorrentID); err != nil {
+				log.Printf("Failed to cancel direct download: %v", err)
+			}
+		} else if m.backend != nil {
+			if err := m.backend.CancelDownload(job.TorrentID); err != nil {
 				log.Printf("Failed to cancel torrent: %v", err)
 			}
 		}
@@ -292,8 +491,11 @@ func (m *Manager) CancelDownload(id uuid.UUID) error {
 		// Удаляем из активных загрузок
 		delete(m.downloads, id)
 		delete(m.progressChans, job.TorrentID)
+		delete(m.dataDirs, job.TorrentID)
 	}
 	
+	m.forgetTransfers(id)
+
 	// Не удаляем из БД - это должен делать вызывающий код
 	return nil
 }
@@ -320,8 +522,37 @@ func (m *Manager) worker(workerID int) {
 	}
 }
 
+// addOptions возвращает параметры торрент-клиента для загрузки
+func (m *Manager) addOptions(download *models.Download) torrent.AddOptions {
+	return torrent.AddOptions{
+		DownloadDir: m.cfg.TorrentConfig.DownloadDir,
+		Storage:     download.StorageBackend,
+		Sequential:  download.Sequential,
+		ContentPath: download.DataPath,
+		Verify:      download.VerifyData,
+		Owner:       download.ID.String(),
+		WebSeeds:    download.WebSeeds,
+	}
+}
+
+// addDirect запускает прямую загрузку. У каждой загрузки своя директория: одинаковые
+// имена файлов не конфликтуют, а недокачанный файл находится после перезапуска.
+func (m *Manager) addDirect(download *models.Download) (string, chan torrent.ProgressUpdate, error) {
+	return m.directClient.Add(download.DirectURL, direct.Options{
+		DownloadDir: filepath.Join(m.cfg.Direct.DownloadDir, download.ID.String()),
+		Checksum:    download.Checksum,
+	})
+}
+
 func (m *Manager) processDownload(download *models.Download, workerID int) {
-	if m.torrentClient == nil {
+	if download.DirectURL != "" && m.directClient == nil {
+		log.Printf("Worker %d: Direct download client not available", workerID)
+		download.Status = "failed"
+		download.Error = "Direct download client not available"
+		m.db.Save(download)
+		return
+	}
+	if download.DirectURL == "" && m.backend == nil {
 		log.Printf("Worker %d: Torrent client not available", workerID)
 		download.Status = "failed"
 		download.Error = "Torrent client not available"
@@ -334,10 +565,15 @@ func (m *Manager) processDownload(download *models.Download, workerID int) {
 	
 	// Обновляем статус на "загрузка"
 	download.Status = "downloading"
+	download.Error = ""
+	download.ErrorKind = ""
+	download.NextRetryAt = nil
+	download.Attempts++
 	now := time.Now()
 	download.StartedAt = &now
 	if err := m.db.Save(download).Error; err != nil {
 		log.Printf("Worker %d: Failed to update download status: %v", workerID, err)
+		cancel()
 		return
 	}
 
@@ -346,45 +582,48 @@ func (m *Manager) processDownload(download *models.Download, workerID int) {
 	var progressChan chan torrent.ProgressUpdate
 	var err error
 
-	if download.MagnetURL != "" {
+	if download.DirectURL != "" {
+		// Прямая ссылка на файл - торрент не нужен
+		torrentID, progressChan, err = m.addDirect(download)
+	} else if m.torrentClient != nil && m.torrentClient.HasCachedMetainfo(download.InfoHash) {
+		// Метаданные сохранены с прошлого запуска - продолжаем сразу, без их повторного получения
+		log.Printf("Worker %d: Resuming from cached metainfo: %s", workerID, download.InfoHash)
+		torrentID, progressChan, err = m.torrentClient.AddCachedTorrent(download.InfoHash, m.addOptions(download))
+	} else if download.MagnetURL != "" {
 		// Используем magnet ссылку
-		torrentID, progressChan, err = m.torrentClient.AddMagnet(download.MagnetURL, m.cfg.TorrentConfig.DownloadDir)
+		torrentID, progressChan, err = m.backend.AddMagnet(download.MagnetURL, m.addOptions(download))
 	} else if download.TorrentURL != "" {
 		// Проверяем, является ли TorrentURL действительным URL или именем файла
 		if strings.HasPrefix(download.TorrentURL, "http://") || strings.HasPrefix(download.TorrentURL, "https://") {
 			// Это URL - скачиваем торрент-файл
-			torrentID, progressChan, err = m.torrentClient.AddTorrentURL(download.TorrentURL, m.cfg.TorrentConfig.DownloadDir)
+			torrentID, progressChan, err = m.backend.AddTorrentURL(download.TorrentURL, m.addOptions(download))
 		} else {
 			// Это имя файла - торрент уже был загружен ранее, но задача потеряна
 			// Пытаемся найти файл в Downloads директории
 			torrentFilePath := filepath.Join(m.cfg.TorrentConfig.DownloadDir, download.TorrentURL)
 			log.Printf("Worker %d: Trying to load torrent file from: %s", workerID, torrentFilePath)
 			
-			if file, err := os.Open(torrentFilePath); err == nil {
-				defer file.Close()
-				torrentID, progressChan, err = m.torrentClient.AddTorrentFile(file, m.cfg.TorrentConfig.DownloadDir)
-			} else {
+			file, openErr := os.Open(torrentFilePath)
+			if openErr != nil {
 				log.Printf("Worker %d: Torrent file not found: %s", workerID, torrentFilePath)
-				download.Status = "failed"
-				download.Error = fmt.Sprintf("Torrent file not found: %s", download.TorrentURL)
-				m.db.Save(download)
+				m.failDownload(download, fmt.Errorf("torrent file not found: %s: %w", download.TorrentURL, openErr))
 				cancel()
 				return
 			}
+			defer file.Close()
+			torrentID, progressChan, err = m.backend.AddTorrentFile(file, m.addOptions(download))
 		}
 	} else {
 		log.Printf("Worker %d: No magnet URL or torrent URL provided", workerID)
-		download.Status = "failed"
-		download.Error = "No magnet URL or torrent URL provided"
-		m.db.Save(download)
+		m.failDownload(download, errNoSource)
+		cancel()
 		return
 	}
 
 	if err != nil {
 		log.Printf("Worker %d: Failed to start torrent: %v", workerID, err)
-		download.Status = "failed"
-		download.Error = err.Error()
-		m.db.Save(download)
+		m.failDownload(download, err)
+		cancel()
 		return
 	}
 
@@ -393,6 +632,7 @@ func (m *Manager) processDownload(download *models.Download, workerID int) {
 		Download:     download,
 		TorrentID:    torrentID,
 		ProgressChan: progressChan,
+		direct:       download.DirectURL != "",
 		ctx:          ctx,
 		cancel:       cancel,
 	}
@@ -404,27 +644,31 @@ func (m *Manager) processDownload(download *models.Download, workerID int) {
 	m.mu.Unlock()
 
 	// Запускаем мониторинг в отдельной горутине
+	m.monitors.Add(1)
 	go m.monitorDownloadProgress(job)
+
+	if job.direct {
+		log.Printf("Worker %d: Successfully started direct download: %s", workerID, download.Game.Title)
+		m.fireHook(hooks.EventStarted, download)
+		return
+	}
 	
 	// Обновляем InfoHash в БД после успешного создания торрента
-	// Получаем торрент из клиента по torrentID
-	activeDownloads := m.torrentClient.GetActiveDownloads()
-	if clientJob, exists := activeDownloads[torrentID]; exists && clientJob.Torrent != nil {
-		infoHash := clientJob.Torrent.InfoHash().String()
-		if infoHash != "" {
-			download.InfoHash = infoHash
-			if err := m.db.Save(download).Error; err != nil {
-				log.Printf("Worker %d: Failed to save InfoHash to database: %v", workerID, err)
-			} else {
-				log.Printf("Worker %d: Saved InfoHash %s for download %s", workerID, infoHash, download.Game.Title)
-			}
+	if infoHash, err := m.backend.InfoHash(torrentID); err == nil && infoHash != "" {
+		download.InfoHash = infoHash
+		if err := m.db.Save(download).Error; err != nil {
+			log.Printf("Worker %d: Failed to save InfoHash to database: %v", workerID, err)
+		} else {
+			log.Printf("Worker %d: Saved InfoHash %s for download %s", workerID, infoHash, download.Game.Title)
 		}
 	}
 
 	log.Printf("Worker %d: Successfully started download: %s", workerID, download.Game.Title)
+	m.fireHook(hooks.EventStarted, download)
 }
 
 func (m *Manager) monitorDownloadProgress(job *DownloadJob) {
+	defer m.monitors.Done()
 	// Добавляем защиту от panic
 	defer func() {
 		if r := recover(); r != nil {
@@ -437,6 +681,7 @@ func (m *Manager) monitorDownloadProgress(job *DownloadJob) {
 			delete(m.downloads, job.Download.ID)
 			if job.TorrentID != "" {
 				delete(m.progressChans, job.TorrentID)
+				delete(m.dataDirs, job.TorrentID)
 			}
 			m.mu.Unlock()
 		}
@@ -448,6 +693,10 @@ func (m *Manager) monitorDownloadProgress(job *DownloadJob) {
 		return
 	}
 
+	// Карту частей рассылаем реже, чем прогресс, и только изменения
+	var pieces *torrent.PieceSnapshot
+	var piecesSentAt time.Time
+
 	for {
 		select {
 		case update, ok := <-job.ProgressChan:
@@ -473,15 +722,34 @@ func (m *Manager) monitorDownloadProgress(job *DownloadJob) {
 			job.Download.ETA = update.ETA
 			job.Download.PeersConnected = update.Peers
 			job.Download.SeedsConnected = update.Seeds
+			job.Download.WebSeedSpeed = int64(update.WebSeedRate)
+			job.Download.WebSeedBytes = update.WebSeedDownloaded
+			if update.Error != "" {
+				job.Download.Error = update.Error
+			}
+			if job.Download.VerifyData && update.Status != "checking" {
+				// Проверка данных завершена - после перезапуска повторять ее не нужно
+				job.Download.VerifyData = false
+			}
+			if update.Status == "failed" && update.Err != nil {
+				// Решаем, повторять ли загрузку позже
+				m.applyFailure(job.Download, update.Err)
+			}
 
 			if update.Status == "completed" {
 				completed := time.Now()
 				job.Download.CompletedAt = &completed
+				// Загрузка считается завершенной после обработки (распаковка, установка)
+				job.Download.Status = "processing"
+				job.Download.PostProcessStep = ""
+				job.Download.PostProcessProgress = 0
+				job.Download.PostProcessError = ""
 				log.Printf("Download completed: %s", job.Download.Game.Title)
 			}
 
 			// Сохраняем в БД с обработкой ошибок
 			if m.db != nil && job.Download != nil {
+				m.applyTransfers(job.Download)
 				if err := m.db.Save(job.Download).Error; err != nil {
 					log.Printf("Failed to update download progress in DB: %v", err)
 				}
@@ -492,6 +760,7 @@ func (m *Manager) monitorDownloadProgress(job *DownloadJob) {
 				// Создаём расширенное обновление с информацией об игре
 				enhancedUpdate := update
 				enhancedUpdate.ID = job.Download.ID.String()
+				enhancedUpdate.Status = job.Download.Status
 				
 				m.wsHub.BroadcastProgress(job.Download.UserID, enhancedUpdate)
 				
@@ -504,6 +773,21 @@ func (m *Manager) monitorDownloadProgress(job *DownloadJob) {
 				
 				log.Printf("WebSocket progress sent for user %s: %.1f%% (%s)", 
 					job.Download.UserID, update.Progress, gameTitle)
+
+				if time.Since(piecesSentAt) >= pieceMapInterval || update.Status == "completed" {
+					pieces = m.broadcastPieceMap(job, update.InfoHash, pieces)
+					piecesSentAt = time.Now()
+				}
+			}
+
+			if update.Status == "completed" {
+				if job.ctx.Err() != nil {
+					// Сервер останавливается - обработка начнется после перезапуска
+					return
+				}
+				// Дальше загрузкой занимается обработка; мониторинг торрента больше не нужен
+				m.startPostProcess(job)
+				return
 			}
 
 		case <-job.ctx.Done():
@@ -551,13 +835,18 @@ func (m *Manager) updateGlobalStatus() {
 func (m *Manager) resumeDownloads() {
 	log.Println("Resuming incomplete downloads...")
 	
-	// Сначала получаем уже запущенные торренты из anacrolix/torrent клиента
-	existingTorrents := m.torrentClient.GetExistingTorrents()
+	// Сначала получаем уже запущенные торренты из anacrolix/torrent клиента. Внешний клиент
+	// подхватит свои торренты, когда загрузки из очереди добавят их снова.
+	var existingTorrents []*torrent.TorrentInfo
+	if m.torrentClient != nil {
+		existingTorrents = m.torrentClient.GetExistingTorrents()
+	}
 	log.Printf("Found %d existing torrents in torrent client", len(existingTorrents))
 	
 	// Получаем незавершенные загрузки из БД
 	var downloads []models.Download
-	m.db.Preload("Game").Where("status IN ?", []string{"downloading", "queued"}).Find(&downloads)
+	// Прерванная обработка начинается заново: торрент быстро проверит уже скачанные данные
+	m.db.Preload("Game").Where("status IN ?", []string{"downloading", "queued", "processing", "checking"}).Find(&downloads)
 	log.Printf("Found %d incomplete downloads in database", len(downloads))
 	
 	// Пытаемся сопоставить торренты из клиента с записями в БД по InfoHash
@@ -601,6 +890,7 @@ func (m *Manager) resumeDownloads() {
 				download.Status = "downloading"
 				m.db.Save(&download)
 				
+				m.monitors.Add(1)
 				go m.monitorDownloadProgress(job)
 				restored = true
 				break
@@ -647,3 +937,27 @@ func (m *Manager) GetDownloadProgress(id uuid.UUID) (*DownloadJob, bool) {
 	job, exists := m.downloads[id]
 	return job, exists
 }
+
+// InspectTorrentFile возвращает содержимое .torrent файла без создания загрузки
+func (m *Manager) InspectTorrentFile(torrentFile io.Reader) (*torrent.TorrentPreview, error) {
+	if m.backend == nil {
+		return nil, fmt.Errorf("torrent client not available")
+	}
+	return m.backend.InspectTorrentFile(torrentFile)
+}
+
+// InspectTorrentURL скачивает .torrent файл по URL и возвращает его содержимое
+func (m *Manager) InspectTorrentURL(ctx context.Context, torrentURL string) (*torrent.TorrentPreview, error) {
+	if m.backend == nil {
+		return nil, fmt.Errorf("torrent client not available")
+	}
+	return m.backend.InspectTorrentURL(ctx, torrentURL)
+}
+
+// InspectMagnet получает метаданные по magnet-ссылке, не начиная загрузку
+func (m *Manager) InspectMagnet(ctx context.Context, magnetLink string) (*torrent.TorrentPreview, error) {
+	if m.backend == nil {
+		return nil, fmt.Errorf("torrent client not available")
+	}
+	return m.backend.InspectMagnet(ctx, magnetLink)
+}
@@ -0,0 +1,442 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"gamecloud/internal/models"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidTimeseries - некорректный запрос временного ряда
+var ErrInvalidTimeseries = errors.New("invalid timeseries query")
+
+const (
+	// Как часто записывать сырые замеры
+	metricsSampleInterval = 10 * time.Second
+	// Как часто сворачивать замеры в более грубые точки и удалять устаревшие
+	metricsRollupInterval = 5 * time.Minute
+	// Максимум точек в одном ответе
+	maxTimeseriesPoints = 2000
+	// Сколько точек возвращать, если шаг не задан
+	defaultTimeseriesPoints = 300
+)
+
+// metricTier - разрешение временного ряда и срок хранения точек (0 - бессрочно).
+// Каждый уровень строится из предыдущего.
+type metricTier struct {
+	resolution time.Duration
+	retention  time.Duration
+}
+
+var metricTiers = []metricTier{
+	{resolution: metricsSampleInterval, retention: 24 * time.Hour},
+	{resolution: 5 * time.Minute, retention: 30 * 24 * time.Hour},
+	{resolution: 24 * time.Hour},
+}
+
+// Способ объединения точек метрики при укрупнении шага
+const (
+	aggregateAvg  = iota // среднее, взвешенное по числу замеров
+	aggregateSum         // сумма за интервал
+	aggregateLast        // значение на конец интервала
+)
+
+type timeseriesMetric struct {
+	value     func(s *models.MetricSample) float64
+	aggregate int
+}
+
+// Метрики, доступные в GET /stats/timeseries
+var timeseriesMetrics = map[string]timeseriesMetric{
+	"download_rate": {func(s *models.MetricSample) float64 { return s.DownloadRate }, aggregateAvg},
+	"upload_rate":   {func(s *models.MetricSample) float64 { return s.UploadRate }, aggregateAvg},
+	"peers":         {func(s *models.MetricSample) float64 { return s.Peers }, aggregateAvg},
+	"downloaded":    {func(s *models.MetricSample) float64 { return float64(s.Downloaded) }, aggregateSum},
+	"uploaded":      {func(s *models.MetricSample) float64 { return float64(s.Uploaded) }, aggregateSum},
+	"disk_usage":    {func(s *models.MetricSample) float64 { return float64(s.DiskUsage) }, aggregateLast},
+}
+
+// TimeseriesPoint - точка ряда; Time - начало интервала
+type TimeseriesPoint struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// Timeseries - ответ на запрос временных рядов
+type Timeseries struct {
+	From       time.Time                    `json:"from"`
+	To         time.Time                    `json:"to"`
+	Step       int64                        `json:"step"`       // секунды
+	Resolution int64                        `json:"resolution"` // разрешение исходных точек, секунды
+	Series     map[string][]TimeseriesPoint `json:"series"`
+}
+
+// transferCounters - сессионные объемы загрузки при прошлом замере
+type transferCounters struct {
+	down, up int64
+}
+
+// metricsRecorder записывает замеры каждые 10 секунд и периодически сворачивает их
+func (m *Manager) metricsRecorder() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(metricsSampleInterval)
+	defer ticker.Stop()
+
+	// Догоняем свертку, пропущенную, пока сервер не работал
+	m.rollupMetrics(time.Now().UTC())
+	lastRollup := time.Now()
+
+	prev := make(map[uuid.UUID]transferCounters)
+	for {
+		select {
+		case now := <-ticker.C:
+			m.recordMetrics(now.UTC(), prev)
+			if time.Since(lastRollup) >= metricsRollupInterval {
+				m.rollupMetrics(now.UTC())
+				lastRollup = time.Now()
+			}
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+// recordMetrics записывает сырой замер для каждой активной загрузки и суммарный -
+// для каждого пользователя
+func (m *Manager) recordMetrics(now time.Time, prev map[uuid.UUID]transferCounters) {
+	var downloads []models.Download
+	err := m.db.Select("id", "user_id", "status", "download_speed", "upload_speed", "peers_connected",
+		"downloaded_bytes", "session_downloaded", "session_uploaded").Find(&downloads).Error
+	if err != nil {
+		log.Printf("Failed to load downloads for metrics: %v", err)
+		return
+	}
+
+	ts := now.Truncate(metricsSampleInterval)
+	users := make(map[string]*models.MetricSample)
+	var samples []models.MetricSample
+	seen := make(map[uuid.UUID]bool, len(downloads))
+	for _, d := range downloads {
+		seen[d.ID] = true
+		// Сессионные объемы растут монотонно; приращение - переданное за интервал
+		last := prev[d.ID]
+		down, up := d.SessionDownloaded-last.down, d.SessionUploaded-last.up
+		if down < 0 || up < 0 {
+			down, up = d.SessionDownloaded, d.SessionUploaded
+		}
+		prev[d.ID] = transferCounters{down: d.SessionDownloaded, up: d.SessionUploaded}
+
+		sample := models.MetricSample{
+			UserID:       d.UserID,
+			DownloadID:   d.ID,
+			Resolution:   int(metricsSampleInterval / time.Second),
+			Timestamp:    ts,
+			DownloadRate: float64(d.DownloadSpeed),
+			UploadRate:   float64(d.UploadSpeed),
+			Peers:        float64(d.PeersConnected),
+			Downloaded:   down,
+			Uploaded:     up,
+			DiskUsage:    d.DownloadedBytes,
+			Samples:      1,
+		}
+
+		total, ok := users[d.UserID]
+		if !ok {
+			total = &models.MetricSample{
+				UserID:     d.UserID,
+				Resolution: sample.Resolution,
+				Timestamp:  ts,
+				Samples:    1,
+			}
+			users[d.UserID] = total
+		}
+		total.DownloadRate += sample.DownloadRate
+		total.UploadRate += sample.UploadRate
+		total.Peers += sample.Peers
+		total.Downloaded += sample.Downloaded
+		total.Uploaded += sample.Uploaded
+		total.DiskUsage += sample.DiskUsage
+
+		// Отдельный ряд пишем только для загрузок, с которыми что-то происходит
+		if metricsActive(d) || down > 0 || up > 0 {
+			samples = append(samples, sample)
+		}
+	}
+	for id := range prev {
+		if !seen[id] {
+			delete(prev, id)
+		}
+	}
+	for _, total := range users {
+		samples = append(samples, *total)
+	}
+
+	if len(samples) == 0 {
+		return
+	}
+	if err := m.db.CreateInBatches(samples, 100).Error; err != nil {
+		log.Printf("Failed to save metric samples: %v", err)
+	}
+}
+
+func metricsActive(d models.Download) bool {
+	switch d.Status {
+	case "downloading", "checking", "processing", "seeding":
+		return true
+	}
+	return d.DownloadSpeed > 0 || d.UploadSpeed > 0 || d.PeersConnected > 0
+}
+
+// rollupMetrics сворачивает завершенные интервалы каждого уровня в точки следующего и
+// удаляет точки с истекшим сроком хранения
+func (m *Manager) rollupMetrics(now time.Time) {
+	for i := 1; i < len(metricTiers); i++ {
+		src, dst := metricTiers[i-1], metricTiers[i]
+
+		from := m.tierWatermark(dst)
+		to := now.Truncate(dst.resolution)
+		if !from.Before(to) {
+			continue
+		}
+
+		var rows []models.MetricSample
+		err := m.db.Where("resolution = ? AND timestamp >= ? AND timestamp < ?", tierSeconds(src), from, to).
+			Order("timestamp").Find(&rows).Error
+		if err != nil {
+			log.Printf("Failed to load metric samples for rollup: %v", err)
+			return
+		}
+
+		rolled := rollupSamples(rows, dst.resolution)
+		if len(rolled) == 0 {
+			continue
+		}
+		if err := m.db.CreateInBatches(rolled, 100).Error; err != nil {
+			log.Printf("Failed to save rolled up metric samples: %v", err)
+			return
+		}
+	}
+
+	for _, tier := range metricTiers {
+		if tier.retention == 0 {
+			continue
+		}
+		err := m.db.Where("resolution = ? AND timestamp < ?", tierSeconds(tier), now.Add(-tier.retention)).
+			Delete(&models.MetricSample{}).Error
+		if err != nil {
+			log.Printf("Failed to delete expired metric samples: %v", err)
+		}
+	}
+}
+
+// tierWatermark возвращает конец последнего записанного интервала уровня
+func (m *Manager) tierWatermark(tier metricTier) time.Time {
+	var last models.MetricSample
+	m.db.Where("resolution = ?", tierSeconds(tier)).Order("timestamp DESC").Limit(1).Find(&last)
+	if last.ID == uuid.Nil {
+		return time.Time{}
+	}
+	return last.Timestamp.UTC().Add(tier.resolution)
+}
+
+func tierSeconds(tier metricTier) int {
+	return int(tier.resolution / time.Second)
+}
+
+// rollupSamples объединяет отсортированные по времени точки каждого ряда в интервалы
+// длиной resolution
+func rollupSamples(rows []models.MetricSample, resolution time.Duration) []models.MetricSample {
+	type seriesKey struct {
+		userID     string
+		downloadID uuid.UUID
+		bucket     time.Time
+	}
+	buckets := make(map[seriesKey]*models.MetricSample)
+	var order []seriesKey
+
+	for _, row := range rows {
+		key := seriesKey{row.UserID, row.DownloadID, row.Timestamp.UTC().Truncate(resolution)}
+		acc, ok := buckets[key]
+		if !ok {
+			acc = &models.MetricSample{
+				UserID:     row.UserID,
+				DownloadID: row.DownloadID,
+				Resolution: int(resolution / time.Second),
+				Timestamp:  key.bucket,
+			}
+			buckets[key] = acc
+			order = append(order, key)
+		}
+		weight := float64(row.Samples)
+		total := float64(acc.Samples) + weight
+		if total > 0 {
+			acc.DownloadRate += (row.DownloadRate - acc.DownloadRate) * weight / total
+			acc.UploadRate += (row.UploadRate - acc.UploadRate) * weight / total
+			acc.Peers += (row.Peers - acc.Peers) * weight / total
+		}
+		acc.Samples += row.Samples
+		acc.Downloaded += row.Downloaded
+		acc.Uploaded += row.Uploaded
+		acc.DiskUsage = row.DiskUsage
+	}
+
+	rolled := make([]models.MetricSample, 0, len(order))
+	for _, key := range order {
+		rolled = append(rolled, *buckets[key])
+	}
+	return rolled
+}
+
+// GetTimeseries возвращает ряды метрик пользователя за последние rng с шагом step
+// (0 - подобрать автоматически). downloadID = uuid.Nil - сумма по всем загрузкам.
+// Точки берутся с самого грубого уровня, который хранит весь интервал; еще не
+// свернутый хвост дополняется точками более подробных уровней.
+func (m *Manager) GetTimeseries(userID string, downloadID uuid.UUID, metrics []string, rng, step time.Duration) (*Timeseries, error) {
+	if len(metrics) == 0 {
+		return nil, fmt.Errorf("%w: metric is required", ErrInvalidTimeseries)
+	}
+	for _, name := range metrics {
+		if _, ok := timeseriesMetrics[name]; !ok {
+			return nil, fmt.Errorf("%w: unknown metric %q", ErrInvalidTimeseries, name)
+		}
+	}
+	if rng <= 0 {
+		return nil, fmt.Errorf("%w: range must be positive", ErrInvalidTimeseries)
+	}
+	if step < 0 {
+		return nil, fmt.Errorf("%w: step must be positive", ErrInvalidTimeseries)
+	}
+
+	tierIndex := len(metricTiers) - 1
+	for i, tier := range metricTiers {
+		if tier.retention == 0 || rng <= tier.retention {
+			tierIndex = i
+			break
+		}
+	}
+	resolution := metricTiers[tierIndex].resolution
+
+	if step == 0 {
+		step = rng / defaultTimeseriesPoints
+	}
+	// Шаг не мельче разрешения данных и кратен ему
+	if step < resolution {
+		step = resolution
+	}
+	step = step.Truncate(resolution)
+	if rng/step > maxTimeseriesPoints {
+		return nil, fmt.Errorf("%w: too many points, use a larger step", ErrInvalidTimeseries)
+	}
+
+	to := time.Now().UTC()
+	from := to.Add(-rng).Truncate(step)
+
+	var rows []models.MetricSample
+	cursor := from
+	for i := tierIndex; i >= 0 && cursor.Before(to); i-- {
+		end := to
+		if i > 0 {
+			end = m.tierWatermark(metricTiers[i])
+			if end.After(to) {
+				end = to
+			}
+		}
+		if !cursor.Before(end) {
+			continue
+		}
+
+		var tierRows []models.MetricSample
+		err := m.db.Where("user_id = ? AND download_id = ? AND resolution = ? AND timestamp >= ? AND timestamp < ?",
+			userID, downloadID, tierSeconds(metricTiers[i]), cursor, end).
+			Order("timestamp").Find(&tierRows).Error
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, tierRows...)
+		cursor = end
+	}
+
+	series := make(map[string][]TimeseriesPoint, len(metrics))
+	for _, name := range metrics {
+		series[name] = aggregateSeries(rows, timeseriesMetrics[name], step)
+	}
+
+	return &Timeseries{
+		From:       from,
+		To:         to,
+		Step:       int64(step / time.Second),
+		Resolution: int64(resolution / time.Second),
+		Series:     series,
+	}, nil
+}
+
+// aggregateSeries группирует отсортированные точки по интервалам длиной step
+func aggregateSeries(rows []models.MetricSample, metric timeseriesMetric, step time.Duration) []TimeseriesPoint {
+	points := []TimeseriesPoint{}
+	var weight float64
+	for i := range rows {
+		row := &rows[i]
+		bucket := row.Timestamp.UTC().Truncate(step)
+		value := metric.value(row)
+
+		n := len(points)
+		if n == 0 || !points[n-1].Time.Equal(bucket) {
+			points = append(points, TimeseriesPoint{Time: bucket, Value: value})
+			weight = float64(row.Samples)
+			continue
+		}
+
+		last := &points[n-1]
+		switch metric.aggregate {
+		case aggregateAvg:
+			w := float64(row.Samples)
+			if weight+w > 0 {
+				last.Value += (value - last.Value) * w / (weight + w)
+			}
+			weight += w
+		case aggregateSum:
+			last.Value += value
+		case aggregateLast:
+			last.Value = value
+		}
+	}
+	return points
+}
+
+// ParseTimeseriesMetrics разбирает список метрик через запятую
+func ParseTimeseriesMetrics(value string) []string {
+	var metrics []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			metrics = append(metrics, name)
+		}
+	}
+	return metrics
+}
+
+// ParseTimeseriesDuration разбирает длительность вида 90s, 15m, 24h, 7d или 2w
+func ParseTimeseriesDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	units := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	if unit, ok := units[value[len(value)-1]]; ok {
+		n, err := strconv.Atoi(value[:len(value)-1])
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("%w: bad duration %q", ErrInvalidTimeseries, value)
+		}
+		return time.Duration(n) * unit, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%w: bad duration %q", ErrInvalidTimeseries, value)
+	}
+	return d, nil
+}
@@ -0,0 +1,120 @@
+package download
+
+import (
+	"errors"
+	"gamecloud/internal/models"
+	"gamecloud/internal/torrent"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// ErrBanExists - такой бан уже есть
+var ErrBanExists = errors.New("peer is already banned")
+
+// GetPeers возвращает подключенных пиров загрузки
+func (m *Manager) GetPeers(id uuid.UUID) ([]torrent.PeerInfo, error) {
+	infoHash, err := m.activeInfoHash(id)
+	if err != nil {
+		return nil, err
+	}
+	return m.torrentClient.Peers(infoHash)
+}
+
+// BanPeer блокирует IP пира для загрузки или, если global, для всех торрентов
+func (m *Manager) BanPeer(id uuid.UUID, ip string, global bool, reason, createdBy string) (*models.PeerBan, error) {
+	if m.torrentClient == nil {
+		return nil, ErrNotSupported
+	}
+	download, err := m.GetDownload(id)
+	if err != nil {
+		return nil, err
+	}
+
+	infoHash := ""
+	if !global {
+		if download.InfoHash == "" {
+			return nil, torrent.ErrTorrentNotFound
+		}
+		infoHash = download.InfoHash
+	}
+
+	ip, err = torrent.NormalizePeerIP(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int64
+	m.db.Model(&models.PeerBan{}).Where("ip = ? AND info_hash = ?", ip, infoHash).Count(&count)
+	if count > 0 {
+		return nil, ErrBanExists
+	}
+
+	ban := models.PeerBan{IP: ip, InfoHash: infoHash, Reason: reason, CreatedBy: createdBy}
+	if err := m.db.Create(&ban).Error; err != nil {
+		return nil, err
+	}
+	if err := m.torrentClient.BanPeer(ip, infoHash); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Banned peer %s (info hash %q): %s", ip, infoHash, reason)
+	return &ban, nil
+}
+
+// GetPeerBans возвращает баны, действующие для загрузки: ее собственные и глобальные
+func (m *Manager) GetPeerBans(id uuid.UUID) ([]models.PeerBan, error) {
+	download, err := m.GetDownload(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var bans []models.PeerBan
+	err = m.db.Where("info_hash = '' OR info_hash = ?", download.InfoHash).
+		Order("created_at DESC").Find(&bans).Error
+	return bans, err
+}
+
+// GetAllPeerBans возвращает все баны
+func (m *Manager) GetAllPeerBans() ([]models.PeerBan, error) {
+	var bans []models.PeerBan
+	err := m.db.Order("created_at DESC").Find(&bans).Error
+	return bans, err
+}
+
+// GetPeerBan возвращает бан по ID
+func (m *Manager) GetPeerBan(banID uuid.UUID) (*models.PeerBan, error) {
+	var ban models.PeerBan
+	if err := m.db.First(&ban, "id = ?", banID).Error; err != nil {
+		return nil, err
+	}
+	return &ban, nil
+}
+
+// UnbanPeer снимает бан
+func (m *Manager) UnbanPeer(ban *models.PeerBan) error {
+	if err := m.db.Delete(ban).Error; err != nil {
+		return err
+	}
+	if m.torrentClient != nil {
+		return m.torrentClient.UnbanPeer(ban.IP, ban.InfoHash)
+	}
+	return nil
+}
+
+// loadPeerBans передает клиенту сохраненные баны
+func (m *Manager) loadPeerBans() {
+	if m.torrentClient == nil {
+		return
+	}
+	bans, err := m.GetAllPeerBans()
+	if err != nil {
+		log.Printf("Failed to load peer bans: %v", err)
+		return
+	}
+	for _, ban := range bans {
+		if err := m.torrentClient.BanPeer(ban.IP, ban.InfoHash); err != nil {
+			log.Printf("Failed to restore peer ban %s: %v", ban.IP, err)
+		}
+	}
+}
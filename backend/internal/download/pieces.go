@@ -0,0 +1,77 @@
+package download
+
+import (
+	"gamecloud/internal/torrent"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Как часто рассылать изменения карты частей
+const pieceMapInterval = 5 * time.Second
+
+// GetPieceMap возвращает карту скачанных частей и их доступности в рое
+func (m *Manager) GetPieceMap(id uuid.UUID) (*torrent.PieceMap, error) {
+	infoHash, err := m.activeInfoHash(id)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := m.torrentClient.PieceSnapshot(infoHash)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.Map(), nil
+}
+
+// PieceMapMessage - сообщение WebSocket "pieces" с полной картой частей
+type PieceMapMessage struct {
+	DownloadID string `json:"download_id"`
+	*torrent.PieceMap
+}
+
+// PieceMapDiffMessage - сообщение WebSocket "pieces_diff" с изменениями карты частей
+type PieceMapDiffMessage struct {
+	DownloadID string `json:"download_id"`
+	torrent.PieceMapDiff
+}
+
+// broadcastPieceMap отправляет изменения карты частей с прошлого снимка. Полная карта
+// уходит первой и тогда, когда изменений больше, чем весит сама карта.
+// Возвращает снимок, относительно которого считать следующие изменения.
+func (m *Manager) broadcastPieceMap(job *DownloadJob, infoHash string, prev *torrent.PieceSnapshot) *torrent.PieceSnapshot {
+	if m.wsHub == nil || m.torrentClient == nil || infoHash == "" {
+		return prev
+	}
+
+	snapshot, err := m.torrentClient.PieceSnapshot(infoHash)
+	if err != nil || snapshot.Empty() {
+		return prev
+	}
+
+	downloadID := job.Download.ID.String()
+	diff, ok := snapshot.Diff(prev)
+	if !ok {
+		m.wsHub.BroadcastMessage(job.Download.UserID, "pieces", PieceMapMessage{
+			DownloadID: downloadID,
+			PieceMap:   snapshot.Map(),
+		})
+		return snapshot
+	}
+
+	if diff.Size() == 0 {
+		return snapshot
+	}
+	if pieceMap := snapshot.Map(); diff.Size() > len(pieceMap.Availability)+pieceMap.NumPieces/8 {
+		m.wsHub.BroadcastMessage(job.Download.UserID, "pieces", PieceMapMessage{
+			DownloadID: downloadID,
+			PieceMap:   pieceMap,
+		})
+		return snapshot
+	}
+
+	m.wsHub.BroadcastMessage(job.Download.UserID, "pieces_diff", PieceMapDiffMessage{
+		DownloadID:   downloadID,
+		PieceMapDiff: diff,
+	})
+	return snapshot
+}
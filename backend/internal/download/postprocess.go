@@ -0,0 +1,556 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gamecloud/internal/hooks"
+	"gamecloud/internal/models"
+	"gamecloud/internal/torrent"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Шаги обработки завершенной загрузки (POSTPROCESS_STEPS)
+const (
+	StepVerify  = "verify"  // проверка контрольных сумм из раздачи (.sfv, .md5, .sha1, .sha256, *SUMS)
+	StepExtract = "extract" // распаковка zip, tar, tar.gz, tar.bz2, образов ISO и разбитых архивов (.001, .002, ...)
+	StepInstall = "install" // перенос или копирование в InstallDir
+	StepCleanup = "cleanup" // удаление временных файлов и распакованных архивов
+
+	// stepExport выполняется автоматически, если данные хранятся в бэкенде piece
+	stepExport = "export"
+)
+
+const (
+	postProcessCopy = "copy"
+	postProcessMove = "move"
+)
+
+// PostProcessUpdate - прогресс обработки, отправляемый через WebSocket
+type PostProcessUpdate struct {
+	DownloadID  string    `json:"download_id"`
+	GameID      string    `json:"game_id"`
+	Step        string    `json:"step"`
+	Progress    float64   `json:"progress"` // 0.0 to 100.0 в пределах шага
+	Status      string    `json:"status"`   // processing, completed, failed
+	Error       string    `json:"error,omitempty"`
+	InstallPath string    `json:"install_path,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// postProcessRun - состояние одного прогона обработки
+type postProcessRun struct {
+	m        *Manager
+	ctx      context.Context
+	download *models.Download
+
+	source    string          // скачанные данные: файл или директория
+	exported  bool            // source - временная выгрузка из бэкенда piece
+	workDir   string          // директория для распаковки
+	extracted bool            // в workDir есть распакованные архивы
+	archives  map[string]bool // части распакованных архивов
+	installed bool
+	shared    bool   // торрент скачивают и другие пользователи - его данные не трогаем
+	result    string // итоговый путь к игре
+
+	lastReport time.Time
+}
+
+// startPostProcess запускает обработку завершенной загрузки. Задача торрент-клиента
+// освобождается: торрент продолжает раздаваться, пока его не заберет шаг install в режиме move.
+func (m *Manager) startPostProcess(job *DownloadJob) {
+	download := job.Download
+
+	var contentPath string
+	var err error
+	if job.direct {
+		contentPath, err = m.directClient.ContentPath(job.TorrentID)
+		m.directClient.ReleaseJob(job.TorrentID)
+	} else {
+		contentPath, err = m.backend.ContentPath(job.TorrentID)
+		m.backend.ReleaseJob(job.TorrentID)
+	}
+	if err != nil {
+		m.finishPostProcess(&postProcessRun{m: m, download: download}, "prepare", err)
+		return
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-m.stopCh:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		m.runPostProcess(ctx, download, contentPath)
+	}()
+}
+
+func (m *Manager) runPostProcess(ctx context.Context, download *models.Download, contentPath string) {
+	run := &postProcessRun{
+		m:        m,
+		ctx:      ctx,
+		download: download,
+		source:   contentPath,
+		result:   contentPath,
+		archives: make(map[string]bool),
+	}
+
+	steps := m.cfg.PostProcess.Steps
+	if download.DataPath != "" {
+		// Импортированные данные уже лежат на своем месте - обрабатывать их не нужно
+		steps = nil
+	}
+	if len(steps) > 0 {
+		log.Printf("Post-processing %s: %s", download.Game.Title, strings.Join(steps, ", "))
+	}
+
+	root := m.cfg.TorrentConfig.DownloadDir
+	if containsStep(steps, StepInstall) {
+		root = m.cfg.PostProcess.InstallDir
+	}
+	run.workDir = filepath.Join(root, ".staging", download.ID.String())
+
+	// Данные в бэкенде piece сначала выгружаем в обычные файлы
+	if run.source == "" && len(steps) > 0 {
+		if err := run.export(); err != nil {
+			m.finishPostProcess(run, stepExport, err)
+			return
+		}
+	}
+
+	for _, step := range steps {
+		var err error
+		switch step {
+		case StepVerify:
+			err = run.verify()
+		case StepExtract:
+			err = run.extract()
+		case StepInstall:
+			err = run.install()
+		case StepCleanup:
+			err = run.cleanup()
+		default:
+			err = fmt.Errorf("unknown post-processing step %q", step)
+		}
+		if err != nil {
+			m.finishPostProcess(run, step, err)
+			return
+		}
+	}
+
+	m.finishPostProcess(run, "", nil)
+}
+
+func (r *postProcessRun) export() error {
+	r.report(stepExport, 0, true)
+	dest := filepath.Join(r.workDir, "source")
+	err := r.m.torrentClient.ExportFiles(r.ctx, r.download.InfoHash, dest, func(done, total int64) {
+		r.reportBytes(stepExport, done, total)
+	})
+	if err != nil {
+		return err
+	}
+	r.source = dest
+	r.result = dest
+	r.exported = true
+	return nil
+}
+
+func (r *postProcessRun) verify() error {
+	r.report(StepVerify, 0, true)
+	n, err := verifyChecksums(r.ctx, r.source, func(done, total int64) {
+		r.reportBytes(StepVerify, done, total)
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		log.Printf("No checksum files found for %s, skipping verification", r.download.Game.Title)
+	} else {
+		log.Printf("Verified %d files for %s", n, r.download.Game.Title)
+	}
+	r.report(StepVerify, 100, true)
+	return nil
+}
+
+func (r *postProcessRun) extract() error {
+	r.report(StepExtract, 0, true)
+	archives, err := findArchives(r.source)
+	if err != nil {
+		return err
+	}
+	archives, err = splitUnsupported(r.source, archives)
+	if err != nil {
+		return err
+	}
+	if len(archives) == 0 {
+		r.report(StepExtract, 100, true)
+		return nil
+	}
+
+	var total, done int64
+	for _, a := range archives {
+		total += a.Size
+	}
+
+	dest := filepath.Join(r.workDir, "extracted")
+	for _, a := range archives {
+		// Архив распаковывается в ту же относительную директорию, где он лежал
+		target := dest
+		if rel, err := filepath.Rel(r.source, filepath.Dir(a.Parts[0])); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			target = filepath.Join(dest, rel)
+		}
+
+		log.Printf("Extracting %s (%d parts)", a.Name, len(a.Parts))
+		err := extractArchive(r.ctx, a, target, func(n int64) {
+			done += n
+			r.reportBytes(StepExtract, done, total)
+		})
+		if err != nil {
+			return err
+		}
+		for _, part := range a.Parts {
+			r.archives[part] = true
+		}
+	}
+
+	r.extracted = true
+	r.result = dest
+	r.report(StepExtract, 100, true)
+	return nil
+}
+
+func (r *postProcessRun) install() error {
+	r.report(StepInstall, 0, true)
+	installDir := r.m.cfg.PostProcess.InstallDir
+	if installDir == "" {
+		return errors.New("install directory is not configured")
+	}
+	mode := r.m.cfg.PostProcess.Mode
+	if mode != postProcessCopy && mode != postProcessMove {
+		return fmt.Errorf("unknown post-processing mode %q", mode)
+	}
+
+	target := filepath.Join(installDir, installDirName(r.download))
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+
+	// После переноса раздавать нечего - убираем торрент, чтобы он не держал файлы.
+	// Если торрент нужен другим владельцам, данные копируются.
+	move := mode == postProcessMove || r.exported
+	if mode == postProcessMove && !r.releaseData() {
+		r.shared = true
+		move = r.exported
+	}
+
+	type transfer struct {
+		src, dst string
+		move     bool
+	}
+	var transfers []transfer
+	if r.extracted {
+		transfers = append(transfers, transfer{filepath.Join(r.workDir, "extracted"), target, true})
+	}
+	if info, err := os.Stat(r.source); err != nil {
+		return err
+	} else if info.IsDir() {
+		transfers = append(transfers, transfer{r.source, target, move})
+	} else {
+		transfers = append(transfers, transfer{r.source, filepath.Join(target, info.Name()), move})
+	}
+
+	// Распакованные архивы не копируем - в установке уже лежит их содержимое
+	skip := func(path string) bool { return r.archives[path] }
+
+	// Копия и перенос на другую файловую систему занимают место в InstallDir
+	var total, done, needed int64
+	for _, t := range transfers {
+		size := treeSize(t.src, skip)
+		total += size
+		if !t.move || filesystemKey(existingDir(t.src)) != filesystemKey(target) {
+			needed += size
+		}
+	}
+	if err := r.m.ensureFreeSpace(target, needed, ""); err != nil {
+		return err
+	}
+	for _, t := range transfers {
+		err := transferTree(r.ctx, t.src, t.dst, t.move, skip, func(n int64) {
+			done += n
+			r.reportBytes(StepInstall, done, total)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	r.installed = true
+	r.result = target
+	r.report(StepInstall, 100, true)
+	return nil
+}
+
+func (r *postProcessRun) cleanup() error {
+	r.report(StepCleanup, 0, true)
+	move := r.m.cfg.PostProcess.Mode == postProcessMove && !r.shared
+
+	if r.exported {
+		if err := os.RemoveAll(filepath.Join(r.workDir, "source")); err != nil {
+			return err
+		}
+	}
+
+	if r.installed {
+		if err := os.RemoveAll(r.workDir); err != nil {
+			return err
+		}
+		// В режиме move в данных загрузки остались только распакованные архивы и списки сумм
+		if move && !r.exported {
+			if err := os.RemoveAll(r.source); err != nil {
+				return err
+			}
+		}
+	} else if r.extracted && move {
+		// Без установки оставляем распакованные файлы, а сами архивы удаляем, если
+		// торрент не нужен другим владельцам
+		if r.releaseData() {
+			for part := range r.archives {
+				if err := os.Remove(part); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+		}
+	}
+
+	// Удаляем общую директорию .staging, если она опустела
+	os.Remove(filepath.Dir(r.workDir))
+
+	r.report(StepCleanup, 100, true)
+	return nil
+}
+
+// releaseData отпускает торрент загрузки, чтобы ее данные можно было переносить и удалять.
+// false - торрент нужен другим владельцам. У прямых загрузок торрента нет.
+func (r *postProcessRun) releaseData() bool {
+	if r.download.InfoHash == "" {
+		return true
+	}
+	return r.m.backend.DropTorrent(r.download.InfoHash, r.download.ID.String())
+}
+
+// reportBytes сообщает прогресс шага по числу обработанных байт
+func (r *postProcessRun) reportBytes(step string, done, total int64) {
+	progress := 100.0
+	if total > 0 {
+		progress = float64(done) / float64(total) * 100
+	}
+	r.report(step, progress, false)
+}
+
+// report обновляет прогресс шага в БД и отправляет его через WebSocket. Промежуточные
+// обновления отправляются не чаще раза в секунду.
+func (r *postProcessRun) report(step string, progress float64, force bool) {
+	now := time.Now()
+	if !force && now.Sub(r.lastReport) < time.Second {
+		return
+	}
+	r.lastReport = now
+
+	r.download.PostProcessStep = step
+	r.download.PostProcessProgress = progress
+	r.m.applyTransfers(r.download)
+	if err := r.m.db.Save(r.download).Error; err != nil {
+		log.Printf("Failed to save post-processing progress: %v", err)
+	}
+
+	r.m.broadcastPostProcess(r.download, "processing")
+}
+
+// finishPostProcess сохраняет результат обработки и обновляет игру
+func (m *Manager) finishPostProcess(run *postProcessRun, step string, err error) {
+	download := run.download
+
+	if err != nil && run.ctx != nil && run.ctx.Err() != nil {
+		// Сервер останавливается - обработка начнется заново после перезапуска
+		log.Printf("Post-processing interrupted: %s", download.Game.Title)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Post-processing failed for %s at %s: %v", download.Game.Title, step, err)
+		download.Status = "failed"
+		download.Error = fmt.Sprintf("Post-processing failed at %s: %v", step, err)
+		download.ErrorKind = ErrorKindPermanent
+		download.PostProcessError = err.Error()
+	} else {
+		log.Printf("Post-processing completed: %s -> %s", download.Game.Title, run.result)
+		download.Status = "completed"
+		download.PostProcessStep = ""
+		download.PostProcessProgress = 100
+		download.PostProcessError = ""
+		download.InstallPath = run.result
+
+		if dbErr := m.db.Model(&models.Game{}).Where("id = ?", download.GameID).Updates(map[string]interface{}{
+			"status":    "available",
+			"file_path": run.result,
+		}).Error; dbErr != nil {
+			log.Printf("Failed to update game after post-processing: %v", dbErr)
+		}
+		download.Game.Status = "available"
+		download.Game.FilePath = run.result
+	}
+
+	m.applyTransfers(download)
+	if dbErr := m.db.Save(download).Error; dbErr != nil {
+		log.Printf("Failed to save post-processing result: %v", dbErr)
+	}
+
+	if err != nil {
+		m.fireHook(hooks.EventFailed, download)
+	} else {
+		m.fireHook(hooks.EventCompleted, download)
+	}
+
+	m.broadcastPostProcess(download, download.Status)
+	if m.wsHub != nil {
+		m.wsHub.BroadcastProgress(download.UserID, torrent.ProgressUpdate{
+			ID:         download.ID.String(),
+			InfoHash:   download.InfoHash,
+			Name:       download.Game.Title,
+			Size:       download.TotalBytes,
+			Downloaded: download.DownloadedBytes,
+			Progress:   download.Progress,
+			Status:     download.Status,
+			Error:      download.Error,
+			UpdatedAt:  time.Now(),
+		})
+	}
+}
+
+func (m *Manager) broadcastPostProcess(download *models.Download, status string) {
+	if m.wsHub == nil {
+		return
+	}
+	m.wsHub.BroadcastMessage(download.UserID, "postprocess", PostProcessUpdate{
+		DownloadID:  download.ID.String(),
+		GameID:      download.GameID.String(),
+		Step:        download.PostProcessStep,
+		Progress:    download.PostProcessProgress,
+		Status:      status,
+		Error:       download.PostProcessError,
+		InstallPath: download.InstallPath,
+		UpdatedAt:   time.Now(),
+	})
+}
+
+func containsStep(steps []string, step string) bool {
+	for _, s := range steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// installDirName возвращает имя директории установки по названию игры
+func installDirName(download *models.Download) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 32 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, download.Game.Title)
+	name = strings.Trim(name, " .")
+	if name == "" {
+		return download.GameID.String()
+	}
+	return name
+}
+
+// treeSize возвращает суммарный размер файлов в src
+func treeSize(src string, skip func(string) bool) int64 {
+	var size int64
+	filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || skip(path) {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// transferTree переносит или копирует файл или дерево src в dst, объединяя директории
+func transferTree(ctx context.Context, src, dst string, move bool, skip func(string) bool, onBytes func(int64)) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if skip(path) || !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		if move {
+			// В пределах одной файловой системы перенос мгновенный
+			if err := os.Rename(path, target); err == nil {
+				onBytes(info.Size())
+				return nil
+			}
+		}
+
+		if err := copyFile(path, target, info.Mode().Perm(), onBytes); err != nil {
+			return err
+		}
+		if move {
+			return os.Remove(path)
+		}
+		return nil
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode, onBytes func(int64)) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return writeFile(dst, &countingReader{r: in, onRead: onBytes}, perm)
+}
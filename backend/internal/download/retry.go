@@ -0,0 +1,199 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"gamecloud/internal/direct"
+	"gamecloud/internal/hooks"
+	"gamecloud/internal/models"
+	"gamecloud/internal/torrent"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ErrorKindTransient = "transient"
+	ErrorKindPermanent = "permanent"
+)
+
+// errNoSource - у загрузки нет ни magnet-ссылки, ни торрент-файла
+var errNoSource = errors.New("no magnet URL or torrent URL provided")
+
+// classifyError определяет, имеет ли смысл повторять загрузку после ошибки
+func classifyError(err error) string {
+	var httpErr *torrent.HTTPStatusError
+	var directErr *direct.HTTPStatusError
+
+	switch {
+	case errors.Is(err, torrent.ErrInvalidTorrent),
+		errors.Is(err, direct.ErrInvalidURL),
+		errors.Is(err, direct.ErrInvalidChecksum),
+		errors.Is(err, os.ErrNotExist),
+		errors.Is(err, errNoSource):
+		return ErrorKindPermanent
+	case errors.As(err, &httpErr):
+		return classifyStatus(httpErr.StatusCode)
+	case errors.As(err, &directErr):
+		return classifyStatus(directErr.StatusCode)
+	}
+
+	// Остальные ошибки считаем временными: сетевые сбои, таймаут метаданных, нехватка места,
+	// поврежденный при передаче файл. Число повторов все равно ограничено.
+	return ErrorKindTransient
+}
+
+// classifyStatus: сервер может снова ответить после перегрузки, но 404/403 не исправятся сами
+func classifyStatus(statusCode int) string {
+	if statusCode >= 500 ||
+		statusCode == http.StatusRequestTimeout ||
+		statusCode == http.StatusTooManyRequests {
+		return ErrorKindTransient
+	}
+	return ErrorKindPermanent
+}
+
+// retryDelay вычисляет задержку перед следующей попыткой: экспоненциальный backoff с jitter
+func (m *Manager) retryDelay(attempt int) time.Duration {
+	base := m.cfg.TorrentConfig.RetryBaseDelay
+	if base <= 0 {
+		base = 30 * time.Second
+	}
+	maxDelay := m.cfg.TorrentConfig.RetryMaxDelay
+	if maxDelay < base {
+		maxDelay = base
+	}
+
+	delay := base
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	// Половина задержки фиксирована, вторая половина случайна, чтобы повторы не шли пачкой
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// applyFailure записывает ошибку в загрузку и, если ошибка временная и лимит не исчерпан,
+// планирует повторную попытку. Сохранение в БД остается за вызывающим кодом.
+func (m *Manager) applyFailure(download *models.Download, err error) {
+	download.Error = err.Error()
+	download.ErrorKind = classifyError(err)
+	download.NextRetryAt = nil
+	download.Status = "failed"
+
+	if download.ErrorKind != ErrorKindTransient {
+		m.fireHook(hooks.EventFailed, download)
+		return
+	}
+
+	if download.Attempts > m.cfg.TorrentConfig.MaxRetries {
+		log.Printf("Download %s failed after %d attempts: %v", download.ID, download.Attempts, err)
+		m.fireHook(hooks.EventFailed, download)
+		return
+	}
+
+	next := time.Now().Add(m.retryDelay(download.Attempts))
+	download.NextRetryAt = &next
+	download.Status = "retrying"
+	log.Printf("Download %s failed (attempt %d), retrying at %s: %v",
+		download.ID, download.Attempts, next.Format(time.RFC3339), err)
+}
+
+// failDownload помечает загрузку неудачной и сохраняет ее
+func (m *Manager) failDownload(download *models.Download, err error) {
+	m.applyFailure(download, err)
+	if dbErr := m.db.Save(download).Error; dbErr != nil {
+		log.Printf("Failed to save failed download %s: %v", download.ID, dbErr)
+	}
+}
+
+// retryScheduler ставит в очередь загрузки, у которых подошло время повтора
+func (m *Manager) retryScheduler() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.enqueueDueRetries()
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+func (m *Manager) enqueueDueRetries() {
+	var downloads []models.Download
+	if err := m.db.Preload("Game").
+		Where("status = ? AND next_retry_at <= ?", "retrying", time.Now()).
+		Find(&downloads).Error; err != nil {
+		log.Printf("Failed to load downloads due for retry: %v", err)
+		return
+	}
+
+	for i := range downloads {
+		m.requeue(&downloads[i])
+	}
+}
+
+// requeue возвращает загрузку в очередь воркеров
+func (m *Manager) requeue(download *models.Download) bool {
+	download.Status = "queued"
+	download.NextRetryAt = nil
+	if err := m.db.Save(download).Error; err != nil {
+		log.Printf("Failed to requeue download %s: %v", download.ID, err)
+		return false
+	}
+
+	select {
+	case m.queue <- download:
+		log.Printf("Retrying download: %s (attempt %d)", download.Game.Title, download.Attempts+1)
+		return true
+	default:
+		log.Printf("Download queue is full, retry postponed: %s", download.Game.Title)
+		// Вернем загрузку в ожидание, чтобы планировщик попробовал позже
+		next := time.Now().Add(m.retryDelay(1))
+		download.Status = "retrying"
+		download.NextRetryAt = &next
+		m.db.Save(download)
+		return false
+	}
+}
+
+// RetryDownload немедленно повторяет неудачную загрузку, не дожидаясь backoff. Счетчик
+// попыток сбрасывается: ручной повтор снова получает полный лимит автоматических.
+func (m *Manager) RetryDownload(id uuid.UUID) error {
+	m.mu.RLock()
+	_, active := m.downloads[id]
+	m.mu.RUnlock()
+	if active {
+		return fmt.Errorf("download is already active: %s", id)
+	}
+
+	var download models.Download
+	if err := m.db.Preload("Game").First(&download, "id = ?", id).Error; err != nil {
+		return err
+	}
+
+	if download.Status != "failed" && download.Status != "retrying" {
+		return fmt.Errorf("download is not failed: %s", download.Status)
+	}
+
+	download.Attempts = 0
+	download.ErrorKind = ""
+
+	if !m.requeue(&download) {
+		return fmt.Errorf("download queue is full")
+	}
+	return nil
+}
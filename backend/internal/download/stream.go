@@ -0,0 +1,57 @@
+package download
+
+import (
+	"context"
+	"gamecloud/internal/torrent"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// GetFiles возвращает файлы загрузки с прогрессом
+func (m *Manager) GetFiles(id uuid.UUID) ([]torrent.FileInfo, error) {
+	infoHash, err := m.activeInfoHash(id)
+	if err != nil {
+		return nil, err
+	}
+	return m.torrentClient.Files(infoHash)
+}
+
+// OpenFile открывает файл загрузки для потокового чтения, даже если он еще скачивается
+func (m *Manager) OpenFile(ctx context.Context, id uuid.UUID, index int) (*torrent.FileReader, error) {
+	infoHash, err := m.activeInfoHash(id)
+	if err != nil {
+		return nil, err
+	}
+	return m.torrentClient.OpenFile(ctx, infoHash, index)
+}
+
+// SetSequential включает или выключает последовательную загрузку. Настройка сохраняется
+// и применяется к торренту сразу, если он уже в клиенте.
+func (m *Manager) SetSequential(id uuid.UUID, enabled bool) error {
+	if m.torrentClient == nil {
+		return ErrNotSupported
+	}
+	download, err := m.GetDownload(id)
+	if err != nil {
+		return err
+	}
+
+	if err := m.db.Model(download).Update("sequential", enabled).Error; err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	if job, ok := m.downloads[id]; ok {
+		job.Download.Sequential = enabled
+	}
+	m.mu.RUnlock()
+
+	if download.InfoHash != "" {
+		if err := m.torrentClient.SetSequential(download.InfoHash, enabled); err != nil {
+			// Торрент еще не в клиенте - настройка применится при запуске
+			log.Printf("Sequential mode will apply on start for %s: %v", id, err)
+		}
+	}
+	return nil
+}
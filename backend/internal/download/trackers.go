@@ -0,0 +1,126 @@
+package download
+
+import (
+	"fmt"
+	"gamecloud/internal/models"
+	"gamecloud/internal/torrent"
+	"log"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// activeInfoHash возвращает info hash загрузки для операций с трекерами
+func (m *Manager) activeInfoHash(id uuid.UUID) (string, error) {
+	if m.torrentClient == nil {
+		return "", ErrNotSupported
+	}
+	download, err := m.GetDownload(id)
+	if err != nil {
+		return "", err
+	}
+	if download.InfoHash == "" {
+		// Метаданные еще не получены - торрента в клиенте нет
+		return "", torrent.ErrTorrentNotFound
+	}
+	return download.InfoHash, nil
+}
+
+// GetTrackers возвращает трекеры загрузки с состоянием анонсов
+func (m *Manager) GetTrackers(id uuid.UUID) ([]torrent.TrackerStatus, error) {
+	infoHash, err := m.activeInfoHash(id)
+	if err != nil {
+		return nil, err
+	}
+	return m.torrentClient.Trackers(infoHash)
+}
+
+// AddTracker добавляет трекер к активной загрузке
+func (m *Manager) AddTracker(id uuid.UUID, trackerURL string) error {
+	infoHash, err := m.activeInfoHash(id)
+	if err != nil {
+		return err
+	}
+	return m.torrentClient.AddTracker(infoHash, trackerURL)
+}
+
+// RemoveTracker удаляет трекер из активной загрузки
+func (m *Manager) RemoveTracker(id uuid.UUID, trackerURL string) error {
+	infoHash, err := m.activeInfoHash(id)
+	if err != nil {
+		return err
+	}
+	return m.torrentClient.RemoveTracker(infoHash, trackerURL)
+}
+
+// Reannounce форсирует анонс загрузки на все трекеры
+func (m *Manager) Reannounce(id uuid.UUID) error {
+	infoHash, err := m.activeInfoHash(id)
+	if err != nil {
+		return err
+	}
+	return m.torrentClient.Reannounce(infoHash)
+}
+
+// GetDefaultTrackers возвращает трекеры по умолчанию в порядке добавления
+func (m *Manager) GetDefaultTrackers() ([]string, error) {
+	var trackers []models.DefaultTracker
+	if err := m.db.Order("position").Find(&trackers).Error; err != nil {
+		return nil, err
+	}
+
+	urls := make([]string, 0, len(trackers))
+	for _, t := range trackers {
+		urls = append(urls, t.URL)
+	}
+	return urls, nil
+}
+
+// SetDefaultTrackers заменяет список трекеров по умолчанию. Он применяется к новым
+// magnet-ссылкам; уже добавленные торренты не меняются.
+func (m *Manager) SetDefaultTrackers(urls []string) error {
+	var unique []string
+	seen := make(map[string]bool)
+	for _, u := range urls {
+		if !torrent.ValidTrackerURL(u) {
+			return fmt.Errorf("%w: %s", torrent.ErrInvalidTracker, u)
+		}
+		if !seen[u] {
+			seen[u] = true
+			unique = append(unique, u)
+		}
+	}
+
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.DefaultTracker{}).Error; err != nil {
+			return err
+		}
+		for i, u := range unique {
+			if err := tx.Create(&models.DefaultTracker{URL: u, Position: i}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if m.torrentClient != nil {
+		m.torrentClient.SetDefaultTrackers(unique)
+	}
+	return nil
+}
+
+// loadDefaultTrackers передает клиенту сохраненные трекеры по умолчанию
+func (m *Manager) loadDefaultTrackers() {
+	if m.torrentClient == nil {
+		return
+	}
+	urls, err := m.GetDefaultTrackers()
+	if err != nil {
+		log.Printf("Failed to load default trackers: %v", err)
+		return
+	}
+	m.torrentClient.SetDefaultTrackers(urls)
+}
@@ -0,0 +1,143 @@
+package download
+
+import (
+	"gamecloud/internal/models"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Как часто сохранять объемы переданных данных
+const transferSaveInterval = 5 * time.Second
+
+// transferAccount - учет переданных данных загрузки в текущей сессии. Счетчики торрента
+// начинаются с нуля при каждом добавлении торрента в клиент, поэтому копим приращения.
+type transferAccount struct {
+	// Отдано до запуска сервера
+	uploadedBefore int64
+	// Накоплено за сессию
+	sessionDown, sessionUp int64
+	// Значения счетчиков торрента при прошлом замере
+	lastDown, lastUp int64
+}
+
+func (a *transferAccount) add(down, up int64) {
+	if down < a.lastDown || up < a.lastUp {
+		// Торрент добавлен в клиент заново - счетчики сбросились
+		a.lastDown, a.lastUp = 0, 0
+	}
+	a.sessionDown += down - a.lastDown
+	a.sessionUp += up - a.lastUp
+	a.lastDown, a.lastUp = down, up
+}
+
+// resetSessionTotals обнуляет сессионные объемы и скорости, оставшиеся от прошлого запуска
+func (m *Manager) resetSessionTotals() {
+	err := m.db.Model(&models.Download{}).
+		Where("session_downloaded <> 0 OR session_uploaded <> 0 OR download_speed <> 0 OR upload_speed <> 0 OR web_seed_speed <> 0 OR web_seed_bytes <> 0").
+		UpdateColumns(map[string]interface{}{
+			"session_downloaded": 0,
+			"session_uploaded":   0,
+			"download_speed":     0,
+			"upload_speed":       0,
+			"web_seed_speed":     0,
+			"web_seed_bytes":     0,
+		}).Error
+	if err != nil {
+		log.Printf("Failed to reset session transfer totals: %v", err)
+	}
+}
+
+// transferAccounting периодически сохраняет объемы передачи всех загрузок, торренты
+// которых есть в клиенте, в том числе раздающихся после завершения
+func (m *Manager) transferAccounting() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(transferSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.saveTransfers()
+		case <-m.stopCh:
+			m.saveTransfers()
+			return
+		}
+	}
+}
+
+func (m *Manager) saveTransfers() {
+	if m.torrentClient == nil {
+		return
+	}
+	stats := m.torrentClient.TransferStats()
+	if len(stats) == 0 {
+		return
+	}
+	infoHashes := make([]string, 0, len(stats))
+	for ih := range stats {
+		infoHashes = append(infoHashes, ih)
+	}
+
+	var downloads []models.Download
+	if err := m.db.Select("id", "info_hash", "uploaded_bytes").
+		Where("info_hash IN ?", infoHashes).Find(&downloads).Error; err != nil {
+		log.Printf("Failed to load downloads for transfer accounting: %v", err)
+		return
+	}
+
+	for _, download := range downloads {
+		s, ok := stats[download.InfoHash]
+		if !ok {
+			continue
+		}
+
+		m.transfersMu.Lock()
+		account, ok := m.transfers[download.ID]
+		if !ok {
+			account = &transferAccount{uploadedBefore: download.UploadedBytes}
+			m.transfers[download.ID] = account
+		}
+		account.add(s.Downloaded, s.Uploaded)
+		columns := map[string]interface{}{
+			"uploaded_bytes":     account.uploadedBefore + account.sessionUp,
+			"session_downloaded": account.sessionDown,
+			"session_uploaded":   account.sessionUp,
+		}
+		m.transfersMu.Unlock()
+
+		m.mu.RLock()
+		_, active := m.downloads[download.ID]
+		m.mu.RUnlock()
+		if !active {
+			// Скорость активных загрузок сохраняет их мониторинг, здесь - только раздачи
+			columns["download_speed"] = int64(s.DownloadRate)
+			columns["upload_speed"] = int64(s.UploadRate)
+		}
+
+		if err := m.db.Model(&models.Download{}).Where("id = ?", download.ID).UpdateColumns(columns).Error; err != nil {
+			log.Printf("Failed to save transfer totals for %s: %v", download.ID, err)
+		}
+	}
+}
+
+// applyTransfers переносит учтенные объемы в загрузку перед ее сохранением целиком,
+// чтобы не затереть их устаревшими значениями
+func (m *Manager) applyTransfers(download *models.Download) {
+	m.transfersMu.Lock()
+	defer m.transfersMu.Unlock()
+	if account, ok := m.transfers[download.ID]; ok {
+		download.UploadedBytes = account.uploadedBefore + account.sessionUp
+		download.SessionDownloaded = account.sessionDown
+		download.SessionUploaded = account.sessionUp
+	}
+}
+
+// forgetTransfers удаляет учет удаленной загрузки
+func (m *Manager) forgetTransfers(id uuid.UUID) {
+	m.transfersMu.Lock()
+	defer m.transfersMu.Unlock()
+	delete(m.transfers, id)
+}
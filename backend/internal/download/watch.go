@@ -0,0 +1,293 @@
+package download
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"gamecloud/internal/models"
+	"gamecloud/internal/torrent"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// Подкаталоги WatchDir для обработанных файлов
+const (
+	watchDoneDir   = "done"
+	watchFailedDir = "failed"
+)
+
+// watchedFile - размер и время изменения файла при прошлой проверке. Файл берется в
+// работу, только когда они не изменились: по сетевой папке он может копироваться долго.
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// watchFolder периодически импортирует .torrent и .magnet файлы из WatchDir
+func (m *Manager) watchFolder() {
+	defer m.wg.Done()
+
+	dir := m.cfg.TorrentConfig.WatchDir
+	if m.cfg.TorrentConfig.WatchUser == "" {
+		log.Printf("Watch folder %s is disabled: WATCH_USER is not configured", dir)
+		return
+	}
+	for _, sub := range []string{watchDoneDir, watchFailedDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			log.Printf("Failed to prepare watch folder %s: %v", dir, err)
+			return
+		}
+	}
+	log.Printf("Watching %s for .torrent and .magnet files", dir)
+
+	interval := m.cfg.TorrentConfig.WatchInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	seen := make(map[string]watchedFile)
+	for {
+		m.scanWatchFolder(dir, seen)
+
+		select {
+		case <-ticker.C:
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+func (m *Manager) scanWatchFolder(dir string, seen map[string]watchedFile) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Printf("Failed to read watch folder %s: %v", dir, err)
+		return
+	}
+
+	current := make(map[string]bool)
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if !entry.Type().IsRegular() || (ext != ".torrent" && ext != ".magnet") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		name := entry.Name()
+		current[name] = true
+		state := watchedFile{size: info.Size(), modTime: info.ModTime()}
+		if prev, ok := seen[name]; !ok || prev != state {
+			// Файл появился или еще копируется - ждем следующей проверки
+			seen[name] = state
+			continue
+		}
+		delete(seen, name)
+
+		path := filepath.Join(dir, name)
+		if err := m.importWatchedFile(path); err != nil {
+			log.Printf("Failed to import %s from watch folder: %v", name, err)
+			moveWatchedFile(path, filepath.Join(dir, watchFailedDir), err)
+		} else {
+			moveWatchedFile(path, filepath.Join(dir, watchDoneDir), nil)
+		}
+	}
+
+	for name := range seen {
+		if !current[name] {
+			delete(seen, name)
+		}
+	}
+}
+
+// importWatchedFile создает загрузку из .torrent или .magnet файла
+func (m *Manager) importWatchedFile(path string) error {
+	userID := m.watchOwner()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var name, magnet string
+	isTorrent := strings.EqualFold(filepath.Ext(path), ".torrent")
+	if isTorrent {
+		preview, err := m.InspectTorrentFile(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		name = preview.Name
+	} else {
+		magnet = firstLine(data)
+		if name, err = torrent.MagnetName(magnet); err != nil {
+			return err
+		}
+	}
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	game, err := m.gameForTorrent(userID, name)
+	if err != nil {
+		return err
+	}
+
+	download := &models.Download{
+		UserID: userID,
+		GameID: game.ID,
+		Game:   *game,
+		Status: "queued",
+	}
+	if isTorrent {
+		// Файлы с тем же именем могут прийти повторно - копия торрента не должна
+		// перезаписать сохраненную для другой загрузки
+		watchDir := filepath.Join(m.cfg.TorrentConfig.DownloadDir, "watch")
+		download.TorrentURL = filepath.Join("watch", uniqueName(watchDir, filepath.Base(path), time.Now()))
+		err = m.AddTorrentFile(download, bytes.NewReader(data))
+	} else {
+		download.MagnetURL = magnet
+		err = m.AddDownload(download)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Imported %s from watch folder as download of %s", filepath.Base(path), game.Title)
+	return nil
+}
+
+// watchOwner возвращает ID владельца загрузок из WatchDir: WatchUser может быть
+// именем пользователя или его ID
+func (m *Manager) watchOwner() string {
+	owner := m.cfg.TorrentConfig.WatchUser
+	var user models.User
+	// Find, а не First: отсутствие пользователя с таким именем - не ошибка
+	if m.db.Where("username = ?", owner).Limit(1).Find(&user); user.ID != uuid.Nil {
+		return user.ID.String()
+	}
+	return owner
+}
+
+// gameForTorrent находит игру пользователя, к которой относится торрент, или создает
+// новую (см. matchGame).
+func (m *Manager) gameForTorrent(userID, name string) (*models.Game, error) {
+	var games []models.Game
+	if err := m.db.Where("user_id = ?", userID).Find(&games).Error; err != nil {
+		return nil, err
+	}
+	if game := matchGame(games, name); game != nil {
+		return game, nil
+	}
+
+	game := &models.Game{UserID: userID, Title: name, Status: "not_available"}
+	if err := m.db.Create(game).Error; err != nil {
+		return nil, fmt.Errorf("failed to create game: %w", err)
+	}
+	return game, nil
+}
+
+// matchGame выбирает игру для торрента name. Названия сравниваются без учета регистра и
+// знаков препинания. Торрент вида "Game.Name.v1.2-GROUP" относится к игре "Game Name":
+// название игры должно совпадать с началом имени торрента целыми словами, так что игра
+// "Portal" не подходит торренту "Portal.Knights". Берется самое длинное совпадение.
+func matchGame(games []models.Game, name string) *models.Game {
+	key := normalizeTitle(name)
+	words := titleWords(name)
+
+	var match *models.Game
+	matchLen := 0
+	for i := range games {
+		title := normalizeTitle(games[i].Title)
+		if title == "" {
+			continue
+		}
+		if title == key {
+			return &games[i]
+		}
+		if hasWordPrefix(words, titleWords(games[i].Title)) && len(title) > matchLen {
+			match, matchLen = &games[i], len(title)
+		}
+	}
+	return match
+}
+
+// titleWords разбивает название на слова из букв и цифр в нижнем регистре
+func titleWords(title string) []string {
+	return strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// hasWordPrefix сообщает, начинается ли words со всех слов prefix
+func hasWordPrefix(words, prefix []string) bool {
+	if len(prefix) == 0 || len(prefix) > len(words) {
+		return false
+	}
+	for i := range prefix {
+		if words[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeTitle оставляет в названии только буквы и цифры в нижнем регистре
+func normalizeTitle(title string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, title)
+}
+
+func firstLine(data []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// uniqueName возвращает имя для файла base в каталоге dir с временем обработки:
+// "Game.torrent" -> "Game.20240102-150405.torrent". Если такой файл уже есть,
+// добавляется счетчик.
+func uniqueName(dir, base string, now time.Time) string {
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext) + "." + now.Format("20060102-150405")
+	name := stem + ext
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(filepath.Join(dir, name)); os.IsNotExist(err) {
+			return name
+		}
+		name = fmt.Sprintf("%s.%d%s", stem, i, ext)
+	}
+}
+
+// moveWatchedFile переносит обработанный файл в dest под уникальным именем (см. uniqueName).
+// Для неудачного импорта рядом кладется <файл>.error с текстом ошибки.
+func moveWatchedFile(path, dest string, importErr error) {
+	target := filepath.Join(dest, uniqueName(dest, filepath.Base(path), time.Now()))
+
+	if err := os.Rename(path, target); err != nil {
+		log.Printf("Failed to move %s to %s: %v", path, dest, err)
+		return
+	}
+	if importErr != nil {
+		if err := os.WriteFile(target+".error", []byte(importErr.Error()+"\n"), 0644); err != nil {
+			log.Printf("Failed to write import error for %s: %v", target, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package download
+
+import (
+	"gamecloud/internal/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMatchGame(t *testing.T) {
+	games := []models.Game{
+		{Title: "Portal"},
+		{Title: "Portal 2"},
+		{Title: "Half-Life"},
+		{Title: "Half-Life 2: Episode One"},
+		{Title: "The Witcher 3"},
+		{Title: "Doom"},
+	}
+
+	tests := []struct {
+		torrent string
+		want    string // "" - подходящей игры нет
+	}{
+		{"Portal", "Portal"},
+		{"portal", "Portal"},
+		{"Portal.2.v2.0.1-GROUP", "Portal 2"},
+		{"Portal-GOG", "Portal"},
+		{"Portal Knights", "Portal"},
+		{"PortalKnights", ""},
+		{"Portal2", "Portal 2"},
+		{"HalfLife", "Half-Life"},
+		{"Half-Life.2.Episode.One.Repack", "Half-Life 2: Episode One"},
+		{"Half-Life.2.Episode.Two", "Half-Life"},
+		{"The.Witcher.3.Wild.Hunt.GOTY", "The Witcher 3"},
+		{"The Witcher", ""},
+		{"Doomsday Engine", ""},
+		{"DOOM_Eternal", "Doom"},
+		{"Quake", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.torrent, func(t *testing.T) {
+			got := ""
+			if game := matchGame(games, tt.torrent); game != nil {
+				got = game.Title
+			}
+			if got != tt.want {
+				t.Errorf("matchGame(%q) = %q, want %q", tt.torrent, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoveWatchedFileKeepsDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	done := filepath.Join(dir, watchDoneDir)
+	if err := os.MkdirAll(done, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Три файла с одним именем, пришедшие друг за другом
+	for i := 0; i < 3; i++ {
+		path := filepath.Join(dir, "Game.torrent")
+		writeTestFile(t, path, []byte{byte('a' + i)})
+		moveWatchedFile(path, done, nil)
+	}
+
+	entries, err := os.ReadDir(done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := make(map[string]bool)
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(done, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[string(data)] = true
+		if filepath.Ext(entry.Name()) != ".torrent" {
+			t.Errorf("%s lost its extension", entry.Name())
+		}
+	}
+	if len(contents) != 3 {
+		t.Fatalf("done has %d distinct files, want 3", len(contents))
+	}
+}
+
+func TestUniqueName(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	name := uniqueName(dir, "Game.torrent", now)
+	if name != "Game.20240102-150405.torrent" {
+		t.Fatalf("uniqueName = %q", name)
+	}
+	writeTestFile(t, filepath.Join(dir, name), nil)
+	if name := uniqueName(dir, "Game.torrent", now); name != "Game.20240102-150405.1.torrent" {
+		t.Fatalf("uniqueName with existing file = %q", name)
+	}
+}
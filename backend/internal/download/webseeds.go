@@ -0,0 +1,78 @@
+package download
+
+import (
+	"errors"
+	"gamecloud/internal/models"
+	"gamecloud/internal/torrent"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// GetWebSeeds возвращает веб-сиды загрузки: для активного торрента - все, включая ссылки
+// из magnet-ссылки и .torrent файла, иначе - добавленные пользователем
+func (m *Manager) GetWebSeeds(id uuid.UUID) ([]string, error) {
+	download, err := m.GetDownload(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.torrentClient != nil && download.InfoHash != "" {
+		if urls, err := m.torrentClient.WebSeeds(download.InfoHash); err == nil {
+			return urls, nil
+		}
+	}
+	if download.WebSeeds == nil {
+		return []string{}, nil
+	}
+	return download.WebSeeds, nil
+}
+
+// AddWebSeeds добавляет веб-сиды к загрузке. Они сохраняются в загрузке и применяются
+// сразу, если торрент уже в клиенте, иначе - при запуске. Transmission не позволяет
+// добавлять веб-сиды через RPC.
+func (m *Manager) AddWebSeeds(id uuid.UUID, urls []string) error {
+	if m.torrentClient == nil {
+		return ErrNotSupported
+	}
+	if err := torrent.ValidateWebSeeds(urls); err != nil {
+		return err
+	}
+	download, err := m.GetDownload(id)
+	if err != nil {
+		return err
+	}
+
+	webSeeds := download.WebSeeds
+	seen := make(map[string]bool, len(webSeeds))
+	for _, u := range webSeeds {
+		seen[u] = true
+	}
+	for _, u := range urls {
+		if !seen[u] {
+			seen[u] = true
+			webSeeds = append(webSeeds, u)
+		}
+	}
+
+	if err := m.db.Model(download).Select("web_seeds").Updates(&models.Download{WebSeeds: webSeeds}).Error; err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	if job, ok := m.downloads[id]; ok {
+		job.Download.WebSeeds = webSeeds
+	}
+	m.mu.RUnlock()
+
+	if download.InfoHash != "" {
+		if err := m.torrentClient.AddWebSeeds(download.InfoHash, urls); err != nil {
+			if !errors.Is(err, torrent.ErrTorrentNotFound) {
+				return err
+			}
+			// Торрента еще нет в клиенте - веб-сиды применятся при запуске
+			log.Printf("Web seeds will apply on start for %s", id)
+		}
+	}
+	return nil
+}
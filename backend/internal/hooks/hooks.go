@@ -0,0 +1,366 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gamecloud/internal/models"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// События жизненного цикла загрузки
+const (
+	EventQueued    = "queued"
+	EventStarted   = "started"
+	EventCompleted = "completed"
+	EventFailed    = "failed"
+	EventCancelled = "cancelled"
+)
+
+// Типы хуков
+const (
+	TypeCommand = "command"
+	TypeWebhook = "webhook"
+)
+
+const (
+	DefaultTimeout    = 30 // seconds
+	DefaultMaxRetries = 3
+
+	// Сколько символов вывода команды или ответа webhook сохранять в журнале
+	maxOutputLength = 4096
+	// Сколько последних записей журнала хранить для каждого хука
+	maxExecutionsPerHook = 200
+)
+
+// ValidEvent сообщает, поддерживается ли событие
+func ValidEvent(event string) bool {
+	switch event {
+	case EventQueued, EventStarted, EventCompleted, EventFailed, EventCancelled:
+		return true
+	}
+	return false
+}
+
+// Payload - тело запроса webhook.
+//
+// Запрос подписывается ключом хука: заголовок X-GameCloud-Signature содержит
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)), где timestamp - значение
+// заголовка X-GameCloud-Timestamp (unix-время в секундах).
+type Payload struct {
+	Event     string          `json:"event"`
+	Timestamp time.Time       `json:"timestamp"`
+	Download  DownloadPayload `json:"download"`
+}
+
+type DownloadPayload struct {
+	ID        string `json:"id"`
+	UserID    string `json:"user_id"`
+	GameID    string `json:"game_id"`
+	GameTitle string `json:"game_title"`
+	InfoHash  string `json:"info_hash"`
+	Status    string `json:"status"`
+	Path      string `json:"path,omitempty"`
+	Size      int64  `json:"size"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Dispatcher выполняет хуки в фоне, не задерживая обработку загрузок
+type Dispatcher struct {
+	db        *gorm.DB
+	client    *http.Client
+	retryBase time.Duration // первая пауза между попытками, дальше удваивается
+	wg        sync.WaitGroup
+
+	// stopCh прерывает паузы между повторами, ctx - выполняющиеся попытки
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+func NewDispatcher(db *gorm.DB) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		db:        db,
+		client:    &http.Client{},
+		retryBase: 2 * time.Second,
+		stopCh:    make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Fire запускает все включенные хуки, подписанные на событие
+func (d *Dispatcher) Fire(event string, download models.Download) {
+	var hooks []models.Hook
+	if err := d.db.Where("enabled = ?", true).Find(&hooks).Error; err != nil {
+		log.Printf("Failed to load hooks: %v", err)
+		return
+	}
+
+	payload := newPayload(event, &download)
+	for i := range hooks {
+		hook := hooks[i]
+		if !subscribed(&hook, event) {
+			continue
+		}
+
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			d.run(&hook, payload)
+		}()
+	}
+}
+
+// Wait отменяет отложенные повторы и ждет завершения уже выполняющихся попыток. Если ctx
+// истекает раньше, попытки прерываются, а Wait возвращает ошибку контекста.
+func (d *Dispatcher) Wait(ctx context.Context) error {
+	d.stopOnce.Do(func() { close(d.stopCh) })
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		return ctx.Err()
+	}
+}
+
+func subscribed(hook *models.Hook, event string) bool {
+	for _, e := range hook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func newPayload(event string, download *models.Download) Payload {
+	path := download.InstallPath
+	if path == "" {
+		path = download.Game.FilePath
+	}
+
+	return Payload{
+		Event:     event,
+		Timestamp: time.Now().UTC(),
+		Download: DownloadPayload{
+			ID:        download.ID.String(),
+			UserID:    download.UserID,
+			GameID:    download.GameID.String(),
+			GameTitle: download.Game.Title,
+			InfoHash:  download.InfoHash,
+			Status:    download.Status,
+			Path:      path,
+			Size:      download.TotalBytes,
+			Error:     download.Error,
+		},
+	}
+}
+
+// run выполняет хук с повторами; каждая попытка записывается в журнал
+func (d *Dispatcher) run(hook *models.Hook, payload Payload) {
+	timeout := time.Duration(hook.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = DefaultTimeout * time.Second
+	}
+	downloadID, _ := uuid.Parse(payload.Download.ID)
+
+	for attempt := 1; attempt <= hook.MaxRetries+1; attempt++ {
+		execution := models.HookExecution{
+			HookID:     hook.ID,
+			Event:      payload.Event,
+			DownloadID: downloadID,
+			Attempt:    attempt,
+		}
+
+		ctx, cancel := context.WithTimeout(d.ctx, timeout)
+		started := time.Now()
+		var err error
+		switch hook.Type {
+		case TypeCommand:
+			err = runCommand(ctx, hook, payload, &execution)
+		case TypeWebhook:
+			err = d.runWebhook(ctx, hook, payload, &execution)
+		default:
+			err = fmt.Errorf("unknown hook type %q", hook.Type)
+		}
+		cancel()
+
+		execution.DurationMs = time.Since(started).Milliseconds()
+		execution.Success = err == nil
+		if err != nil {
+			execution.Error = err.Error()
+		}
+		d.record(&execution)
+
+		if err == nil {
+			return
+		}
+		log.Printf("Hook %s failed on %s (attempt %d/%d): %v",
+			hook.Name, payload.Event, attempt, hook.MaxRetries+1, err)
+
+		if attempt <= hook.MaxRetries {
+			select {
+			case <-time.After(d.retryDelay(attempt)):
+			case <-d.stopCh:
+				log.Printf("Hook %s: remaining retries on %s cancelled by shutdown", hook.Name, payload.Event)
+				return
+			}
+		}
+	}
+}
+
+// retryDelay - 2, 4, 8... секунд, но не больше минуты
+func (d *Dispatcher) retryDelay(attempt int) time.Duration {
+	delay := d.retryBase << (attempt - 1)
+	if delay > time.Minute || delay <= 0 {
+		delay = time.Minute
+	}
+	return delay
+}
+
+func (d *Dispatcher) record(execution *models.HookExecution) {
+	if err := d.db.Create(execution).Error; err != nil {
+		log.Printf("Failed to save hook execution: %v", err)
+		return
+	}
+
+	// Храним только последние записи журнала
+	d.db.Where("hook_id = ? AND id NOT IN (?)", execution.HookID,
+		d.db.Model(&models.HookExecution{}).Select("id").
+			Where("hook_id = ?", execution.HookID).
+			Order("created_at DESC").Limit(maxExecutionsPerHook),
+	).Delete(&models.HookExecution{})
+}
+
+// runCommand выполняет команду через системную оболочку. Данные события передаются
+// через переменные окружения:
+//
+//	GAMECLOUD_EVENT        событие (queued, started, completed, failed, cancelled)
+//	GAMECLOUD_DOWNLOAD_ID  ID загрузки
+//	GAMECLOUD_USER_ID      ID пользователя
+//	GAMECLOUD_GAME_ID      ID игры
+//	GAMECLOUD_GAME_TITLE   название игры
+//	GAMECLOUD_INFOHASH     info hash торрента
+//	GAMECLOUD_STATUS       статус загрузки
+//	GAMECLOUD_PATH         путь к игре (после установки) или к скачанным данным
+//	GAMECLOUD_SIZE         размер в байтах
+//	GAMECLOUD_ERROR        текст ошибки для события failed
+func runCommand(ctx context.Context, hook *models.Hook, payload Payload, execution *models.HookExecution) error {
+	if hook.Command == "" {
+		return errors.New("command is empty")
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", hook.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", hook.Command)
+	}
+
+	dl := payload.Download
+	cmd.Env = append(os.Environ(),
+		"GAMECLOUD_EVENT="+payload.Event,
+		"GAMECLOUD_DOWNLOAD_ID="+dl.ID,
+		"GAMECLOUD_USER_ID="+dl.UserID,
+		"GAMECLOUD_GAME_ID="+dl.GameID,
+		"GAMECLOUD_GAME_TITLE="+dl.GameTitle,
+		"GAMECLOUD_INFOHASH="+dl.InfoHash,
+		"GAMECLOUD_STATUS="+dl.Status,
+		"GAMECLOUD_PATH="+dl.Path,
+		"GAMECLOUD_SIZE="+strconv.FormatInt(dl.Size, 10),
+		"GAMECLOUD_ERROR="+dl.Error,
+	)
+
+	output, err := cmd.CombinedOutput()
+	execution.Output = truncate(string(output))
+	if cmd.ProcessState != nil {
+		execution.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("command timed out after %d seconds", hook.Timeout)
+	}
+	return err
+}
+
+func (d *Dispatcher) runWebhook(ctx context.Context, hook *models.Hook, payload Payload, execution *models.HookExecution) error {
+	if hook.URL == "" {
+		return errors.New("webhook URL is empty")
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GameCloud-Hooks/1.0")
+	req.Header.Set("X-GameCloud-Event", payload.Event)
+	req.Header.Set("X-GameCloud-Delivery", execution.HookID.String()+"/"+payload.Download.ID)
+	req.Header.Set("X-GameCloud-Timestamp", timestamp)
+	if hook.Secret != "" {
+		req.Header.Set("X-GameCloud-Signature", "sha256="+Sign(hook.Secret, timestamp, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxOutputLength))
+	execution.StatusCode = resp.StatusCode
+	execution.Output = truncate(string(respBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign вычисляет подпись тела webhook
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func truncate(s string) string {
+	if len(s) > maxOutputLength {
+		return s[:maxOutputLength]
+	}
+	return s
+}
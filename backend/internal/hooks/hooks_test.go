@@ -0,0 +1,293 @@
+package hooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"gamecloud/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDispatcher(t *testing.T) *Dispatcher {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "hooks.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Hook{}, &models.HookExecution{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	d := NewDispatcher(db)
+	d.retryBase = time.Millisecond
+	return d
+}
+
+func testPayload(event string) Payload {
+	return Payload{
+		Event:     event,
+		Timestamp: time.Now().UTC(),
+		Download: DownloadPayload{
+			ID:        uuid.New().String(),
+			UserID:    "user-1",
+			GameID:    uuid.New().String(),
+			GameTitle: "Half-Life",
+			InfoHash:  "0123456789abcdef0123456789abcdef01234567",
+			Status:    "completed",
+			Path:      "/games/half-life",
+			Size:      1 << 30,
+		},
+	}
+}
+
+func executions(t *testing.T, d *Dispatcher, hookID uuid.UUID) []models.HookExecution {
+	var list []models.HookExecution
+	if err := d.db.Where("hook_id = ?", hookID).Order("attempt").Find(&list).Error; err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+// webhookRequest - запрос, полученный тестовым сервером
+type webhookRequest struct {
+	header http.Header
+	body   string
+}
+
+// webhookServer отвечает кодами из statuses по очереди, последний повторяется
+func webhookServer(t *testing.T, statuses ...int) (*httptest.Server, func() []webhookRequest) {
+	var mu sync.Mutex
+	var requests []webhookRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, webhookRequest{header: r.Header.Clone(), body: string(body)})
+		status := statuses[min(len(requests), len(statuses))-1]
+		mu.Unlock()
+		w.WriteHeader(status)
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []webhookRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]webhookRequest(nil), requests...)
+	}
+}
+
+func TestRunWebhookSignature(t *testing.T) {
+	d := newTestDispatcher(t)
+	srv, received := webhookServer(t, http.StatusOK)
+	hook := models.Hook{ID: uuid.New(), Name: "notify", Type: TypeWebhook, URL: srv.URL, Secret: "s3cret"}
+
+	d.run(&hook, testPayload(EventCompleted))
+
+	reqs := received()
+	if len(reqs) != 1 {
+		t.Fatalf("webhook got %d requests, want 1", len(reqs))
+	}
+	req := reqs[0]
+	if got := req.header.Get("X-GameCloud-Event"); got != EventCompleted {
+		t.Errorf("X-GameCloud-Event = %q", got)
+	}
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(req.header.Get("X-GameCloud-Timestamp") + "." + req.body))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := req.header.Get("X-GameCloud-Signature"); got != want {
+		t.Errorf("X-GameCloud-Signature = %q, want %q", got, want)
+	}
+
+	list := executions(t, d, hook.ID)
+	if len(list) != 1 || !list[0].Success || list[0].StatusCode != http.StatusOK || list[0].Output != "ok" {
+		t.Errorf("executions = %+v", list)
+	}
+
+	// Без ключа запрос не подписывается
+	hook.Secret = ""
+	d.run(&hook, testPayload(EventCompleted))
+	if reqs := received(); reqs[1].header.Get("X-GameCloud-Signature") != "" {
+		t.Error("request without a secret is signed")
+	}
+}
+
+func TestRunCommandEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("command uses POSIX shell syntax")
+	}
+
+	hook := models.Hook{
+		Type:    TypeCommand,
+		Command: `printf '%s|%s|%s|%s|%s' "$GAMECLOUD_EVENT" "$GAMECLOUD_GAME_TITLE" "$GAMECLOUD_PATH" "$GAMECLOUD_SIZE" "$GAMECLOUD_STATUS"`,
+	}
+	var execution models.HookExecution
+	if err := runCommand(context.Background(), &hook, testPayload(EventCompleted), &execution); err != nil {
+		t.Fatalf("runCommand: %v", err)
+	}
+	if want := "completed|Half-Life|/games/half-life|1073741824|completed"; execution.Output != want {
+		t.Errorf("output = %q, want %q", execution.Output, want)
+	}
+
+	hook.Command = "exit 3"
+	if err := runCommand(context.Background(), &hook, testPayload(EventFailed), &execution); err == nil {
+		t.Error("failing command returned no error")
+	}
+	if execution.ExitCode != 3 {
+		t.Errorf("exit code = %d, want 3", execution.ExitCode)
+	}
+}
+
+func TestRunRetries(t *testing.T) {
+	d := newTestDispatcher(t)
+
+	t.Run("succeeds after failure", func(t *testing.T) {
+		srv, received := webhookServer(t, http.StatusInternalServerError, http.StatusOK)
+		hook := models.Hook{ID: uuid.New(), Name: "flaky", Type: TypeWebhook, URL: srv.URL, MaxRetries: 3}
+		d.run(&hook, testPayload(EventCompleted))
+
+		if n := len(received()); n != 2 {
+			t.Errorf("webhook got %d requests, want 2", n)
+		}
+		list := executions(t, d, hook.ID)
+		if len(list) != 2 || list[0].Success || list[0].StatusCode != http.StatusInternalServerError ||
+			!list[1].Success || list[1].Attempt != 2 {
+			t.Errorf("executions = %+v", list)
+		}
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		srv, received := webhookServer(t, http.StatusBadGateway)
+		hook := models.Hook{ID: uuid.New(), Name: "down", Type: TypeWebhook, URL: srv.URL, MaxRetries: 2}
+		d.run(&hook, testPayload(EventFailed))
+
+		if n := len(received()); n != 3 {
+			t.Errorf("webhook got %d requests, want 3", n)
+		}
+		list := executions(t, d, hook.ID)
+		if len(list) != 3 {
+			t.Fatalf("got %d executions, want 3", len(list))
+		}
+		for i, e := range list {
+			if e.Success || e.Attempt != i+1 || e.Error == "" {
+				t.Errorf("execution %d = %+v", i, e)
+			}
+		}
+	})
+}
+
+func TestWaitCancelsRetries(t *testing.T) {
+	d := newTestDispatcher(t)
+	d.retryBase = time.Hour
+	srv, received := webhookServer(t, http.StatusServiceUnavailable)
+	hook := models.Hook{Name: "down", Events: []string{EventCompleted}, Type: TypeWebhook, URL: srv.URL, MaxRetries: 5, Enabled: true}
+	if err := d.db.Create(&hook).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	d.Fire(EventCompleted, models.Download{ID: uuid.New(), Status: "completed"})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(executions(t, d, hook.ID)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("hook did not run")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Пауза перед повтором - час; Wait должен прервать ее сразу
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Wait(ctx); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if n := len(received()); n != 1 {
+		t.Errorf("webhook got %d requests, want 1", n)
+	}
+}
+
+func TestWaitDeadlineAbortsAttempt(t *testing.T) {
+	d := newTestDispatcher(t)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+
+	hook := models.Hook{Name: "hung", Events: []string{EventStarted}, Type: TypeWebhook, URL: srv.URL, Timeout: 3600, Enabled: true}
+	if err := d.db.Create(&hook).Error; err != nil {
+		t.Fatal(err)
+	}
+	d.Fire(EventStarted, models.Download{ID: uuid.New(), Status: "downloading"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := d.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Wait = %v, want deadline exceeded", err)
+	}
+
+	// Попытка прервана и записана в журнал как неудачная
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		list := executions(t, d, hook.ID)
+		if len(list) == 1 && !list[0].Success {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("aborted attempt was not recorded: %+v", list)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRecordPrunesExecutions(t *testing.T) {
+	d := newTestDispatcher(t)
+	hookID, otherID := uuid.New(), uuid.New()
+	d.record(&models.HookExecution{HookID: otherID, Attempt: 1})
+
+	start := time.Now().Add(-time.Hour)
+	total := maxExecutionsPerHook + 5
+	for i := 1; i <= total; i++ {
+		d.record(&models.HookExecution{
+			HookID:    hookID,
+			Attempt:   i,
+			CreatedAt: start.Add(time.Duration(i) * time.Second),
+		})
+	}
+
+	list := executions(t, d, hookID)
+	if len(list) != maxExecutionsPerHook {
+		t.Fatalf("kept %d executions, want %d", len(list), maxExecutionsPerHook)
+	}
+	// Удалены самые старые записи
+	if list[0].Attempt != total-maxExecutionsPerHook+1 || list[len(list)-1].Attempt != total {
+		t.Errorf("kept attempts %d..%d, want %d..%d",
+			list[0].Attempt, list[len(list)-1].Attempt, total-maxExecutionsPerHook+1, total)
+	}
+	// Журнал другого хука не затронут
+	if n := len(executions(t, d, otherID)); n != 1 {
+		t.Errorf("other hook has %d executions, want 1", n)
+	}
+}
@@ -56,18 +56,37 @@ type Download struct {
 	Game             Game      `json:"game" gorm:"foreignKey:GameID;constraint:OnDelete:CASCADE"`
 	TorrentURL       string    `json:"torrent_url"`
 	MagnetURL        string    `json:"magnet_url"`
+	DirectURL        string    `json:"direct_url,omitempty"` // прямая HTTP(S) ссылка на файл вместо торрента
+	Checksum         string    `json:"checksum,omitempty"` // контрольная сумма прямой загрузки, алгоритм:hex
 	TorrentID        string    `json:"torrent_id"` // ID от торрент-клиента
-	Status           string    `json:"status"` // pending, downloading, completed, failed, paused, seeding
+	Status           string    `json:"status"` // pending, downloading, processing, completed, failed, paused, seeding
 	Progress         float64   `json:"progress"` // 0.0 to 100.0
 	DownloadSpeed    int64     `json:"download_speed"` // bytes per second
 	UploadSpeed      int64     `json:"upload_speed"` // bytes per second
 	TotalBytes       int64     `json:"total_bytes"` // total size in bytes
 	DownloadedBytes  int64     `json:"downloaded_bytes"` // downloaded size in bytes
+	UploadedBytes    int64     `json:"uploaded_bytes"` // отдано за все время
+	SessionDownloaded int64    `json:"session_downloaded"` // скачано с момента запуска сервера
+	SessionUploaded   int64    `json:"session_uploaded"` // отдано с момента запуска сервера
 	PeersConnected   int       `json:"peers_connected"`
 	SeedsConnected   int       `json:"seeds_connected"`
+	WebSeeds         []string  `json:"web_seeds,omitempty" gorm:"serializer:json"` // дополнительные HTTP зеркала (BEP 19)
+	WebSeedSpeed     int64     `json:"web_seed_speed"` // bytes per second с веб-сидов, входит в download_speed
+	WebSeedBytes     int64     `json:"web_seed_bytes"` // скачано с веб-сидов за сессию
 	ETA              int64     `json:"eta"` // seconds remaining
 	InfoHash         string    `json:"info_hash"` // торрент info hash
+	StorageBackend   string    `json:"storage_backend,omitempty"` // file, mmap, piece; пусто - из конфигурации
+	Sequential       bool      `json:"sequential"` // скачивать данные по порядку
 	Error            string    `json:"error,omitempty"`
+	ErrorKind        string    `json:"error_kind,omitempty"` // transient, permanent
+	Attempts         int       `json:"attempts"` // количество запущенных попыток загрузки
+	NextRetryAt      *time.Time `json:"next_retry_at,omitempty"`
+	PostProcessStep     string  `json:"postprocess_step,omitempty"` // текущий шаг обработки после загрузки
+	PostProcessProgress float64 `json:"postprocess_progress"` // 0.0 to 100.0 в пределах шага
+	PostProcessError    string  `json:"postprocess_error,omitempty"`
+	InstallPath         string  `json:"install_path,omitempty"`
+	DataPath            string  `json:"data_path,omitempty"` // существующие данные, используемые на месте (импорт)
+	VerifyData          bool    `json:"verify_data"` // перепроверить данные на диске перед загрузкой
 	StartedAt        *time.Time `json:"started_at,omitempty"`
 	CompletedAt      *time.Time `json:"completed_at,omitempty"`
 	CreatedAt        time.Time `json:"created_at"`
@@ -81,6 +100,108 @@ func (d *Download) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// Hook - действие, выполняемое при событиях загрузки (см. пакет hooks)
+type Hook struct {
+	ID         uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
+	Name       string    `json:"name" gorm:"not null"`
+	Events     []string  `json:"events" gorm:"serializer:json"` // queued, started, completed, failed, cancelled
+	Type       string    `json:"type" gorm:"not null"` // command, webhook
+	Command    string    `json:"command,omitempty"`
+	URL        string    `json:"url,omitempty"`
+	Secret     string    `json:"-"` // ключ HMAC-подписи webhook
+	Timeout    int       `json:"timeout"` // seconds
+	MaxRetries int       `json:"max_retries"`
+	Enabled    bool      `json:"enabled"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (h *Hook) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == uuid.Nil {
+		h.ID = uuid.New()
+	}
+	return nil
+}
+
+// HookExecution - запись журнала выполнения хука, по одной на каждую попытку
+type HookExecution struct {
+	ID         uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
+	HookID     uuid.UUID `json:"hook_id" gorm:"type:uuid;not null;index"`
+	Event      string    `json:"event"`
+	DownloadID uuid.UUID `json:"download_id" gorm:"type:uuid;index"`
+	Attempt    int       `json:"attempt"`
+	Success    bool      `json:"success"`
+	StatusCode int       `json:"status_code,omitempty"` // HTTP статус ответа webhook
+	ExitCode   int       `json:"exit_code"` // код завершения команды
+	Output     string    `json:"output,omitempty"` // начало вывода команды или ответа webhook
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (e *HookExecution) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// DefaultTracker - трекер, добавляемый ко всем magnet-ссылкам (задает администратор)
+type DefaultTracker struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
+	URL       string    `json:"url" gorm:"unique;not null"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (t *DefaultTracker) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// PeerBan - заблокированный IP пира: для одного торрента или глобально
+type PeerBan struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
+	IP        string    `json:"ip" gorm:"not null;index"`
+	InfoHash  string    `json:"info_hash,omitempty" gorm:"index"` // пусто - бан для всех торрентов
+	Reason    string    `json:"reason,omitempty"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (b *PeerBan) BeforeCreate(tx *gorm.DB) error {
+	if b.ID == uuid.Nil {
+		b.ID = uuid.New()
+	}
+	return nil
+}
+
+// MetricSample - точка временного ряда передачи данных. Сырые замеры (Resolution 10 с)
+// периодически сворачиваются в 5-минутные и суточные точки (см. download/metrics.go).
+type MetricSample struct {
+	ID           uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
+	UserID       string    `json:"user_id" gorm:"not null;index:idx_metric_series,priority:1"`
+	DownloadID   uuid.UUID `json:"download_id" gorm:"type:uuid;index:idx_metric_series,priority:2"` // uuid.Nil - сумма по всем загрузкам пользователя
+	Resolution   int       `json:"resolution" gorm:"not null;index:idx_metric_series,priority:3"` // длительность точки в секундах
+	Timestamp    time.Time `json:"timestamp" gorm:"not null;index:idx_metric_series,priority:4;index"` // начало интервала
+	DownloadRate float64   `json:"download_rate"` // средняя за интервал, bytes/s
+	UploadRate   float64   `json:"upload_rate"` // средняя за интервал, bytes/s
+	Peers        float64   `json:"peers"` // среднее число пиров
+	Downloaded   int64     `json:"downloaded"` // скачано за интервал
+	Uploaded     int64     `json:"uploaded"` // отдано за интервал
+	DiskUsage    int64     `json:"disk_usage"` // объем скачанных данных на конец интервала
+	Samples      int       `json:"samples"` // число сырых замеров в точке
+}
+
+func (s *MetricSample) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
 type User struct {
 	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
 	Username  string    `json:"username" gorm:"unique;not null"`
@@ -0,0 +1,421 @@
+package torrent
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/iplist"
+)
+
+// ErrInvalidBlocklist - файл не похож на блоклист или имя файла недопустимо
+var ErrInvalidBlocklist = errors.New("invalid blocklist")
+
+// ErrBlocklistNotFound - загруженный блоклист не найден
+var ErrBlocklistNotFound = errors.New("blocklist not found")
+
+const (
+	// Загруженные администратором блоклисты хранятся в <stateDir>/blocklists
+	blocklistDir = "blocklists"
+	// В формате eMule DAT блокируются диапазоны с уровнем доступа до 127 включительно
+	datMaxBlockedLevel = 127
+)
+
+// BlocklistSource - один файл блоклиста
+type BlocklistSource struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Uploaded bool   `json:"uploaded"`
+	Ranges   int    `json:"ranges"`
+	// Строки, которые не удалось разобрать
+	Skipped int    `json:"skipped"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BlocklistStatus - состояние блоклистов клиента
+type BlocklistStatus struct {
+	// Диапазонов после объединения пересекающихся
+	Ranges   int               `json:"ranges"`
+	Sources  []BlocklistSource `json:"sources"`
+	LoadedAt *time.Time        `json:"loaded_at,omitempty"`
+	// Разных IP, соединения с которыми отклонены с момента загрузки
+	BlockedPeers int `json:"blocked_peers"`
+	// Всего отклоненных попыток (один пир может приходить от трекера, DHT и PEX)
+	BlockedAttempts int64 `json:"blocked_attempts"`
+}
+
+// blocklist - диапазоны IPv4 и IPv6 отдельно: iplist ищет двоичным поиском, а адреса
+// разной длины в одном списке нельзя упорядочить
+type blocklist struct {
+	v4, v6 *iplist.IPList
+}
+
+func (b *blocklist) lookup(ip net.IP) (iplist.Range, bool) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return b.v4.Lookup(ip4)
+	}
+	return b.v6.Lookup(ip)
+}
+
+func (b *blocklist) numRanges() int {
+	if b == nil {
+		return 0
+	}
+	return b.v4.NumRanges() + b.v6.NumRanges()
+}
+
+// blocklistState - загруженный блоклист и счетчики отклоненных пиров
+type blocklistState struct {
+	mu       sync.Mutex
+	sources  []BlocklistSource
+	loadedAt *time.Time
+	blocked  map[netip.Addr]struct{}
+	attempts int64
+}
+
+func (s *blocklistState) recordBlocked(ip net.IP) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if s.blocked != nil {
+		s.blocked[addr.Unmap()] = struct{}{}
+	}
+}
+
+// blocklistUploadDir возвращает каталог загруженных блоклистов
+func (c *Client) blocklistUploadDir() string {
+	return filepath.Join(c.stateDir(), blocklistDir)
+}
+
+// blocklistFiles возвращает файлы из конфигурации и загруженные администратором
+func (c *Client) blocklistFiles() []BlocklistSource {
+	var files []BlocklistSource
+	for _, path := range c.config.BlocklistPaths {
+		files = append(files, BlocklistSource{Name: filepath.Base(path), Path: path})
+	}
+
+	entries, err := os.ReadDir(c.blocklistUploadDir())
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to read blocklist directory: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.HasSuffix(entry.Name(), ".tmp") {
+			files = append(files, BlocklistSource{
+				Name:     entry.Name(),
+				Path:     filepath.Join(c.blocklistUploadDir(), entry.Name()),
+				Uploaded: true,
+			})
+		}
+	}
+	return files
+}
+
+// ReloadBlocklists перечитывает все блоклисты и заменяет действующий список. Ошибка
+// отдельного файла не мешает загрузке остальных и отражается в статусе.
+func (c *Client) ReloadBlocklists() *BlocklistStatus {
+	sources := c.blocklistFiles()
+
+	var ranges []iplist.Range
+	for i := range sources {
+		src := &sources[i]
+		parsed, skipped, err := parseBlocklistFile(src.Path)
+		src.Ranges, src.Skipped = len(parsed), skipped
+		if err != nil {
+			src.Error = err.Error()
+			log.Printf("Failed to load blocklist %s: %v", src.Path, err)
+			continue
+		}
+		ranges = append(ranges, parsed...)
+	}
+
+	var list *blocklist
+	if len(sources) > 0 {
+		list = buildBlocklist(ranges)
+	}
+	c.peerFilter.setBlocklist(list)
+
+	now := time.Now()
+	state := &c.blocklist
+	state.mu.Lock()
+	state.sources = sources
+	state.loadedAt = &now
+	state.blocked = make(map[netip.Addr]struct{})
+	state.attempts = 0
+	state.mu.Unlock()
+
+	if len(sources) > 0 {
+		log.Printf("Loaded %d blocklist ranges from %d files", list.numRanges(), len(sources))
+	}
+	return c.BlocklistStatus()
+}
+
+// BlocklistStatus возвращает состояние блоклистов
+func (c *Client) BlocklistStatus() *BlocklistStatus {
+	// Число диапазонов берем до блокировки state: peerFilter.Lookup захватывает их
+	// в обратном порядке
+	ranges := c.peerFilter.blocklistRanges()
+
+	state := &c.blocklist
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	return &BlocklistStatus{
+		Ranges:          ranges,
+		Sources:         append([]BlocklistSource{}, state.sources...),
+		LoadedAt:        state.loadedAt,
+		BlockedPeers:    len(state.blocked),
+		BlockedAttempts: state.attempts,
+	}
+}
+
+// AddBlocklist сохраняет загруженный блоклист под именем name и применяет его.
+// Файл с тем же именем заменяется.
+func (c *Client) AddBlocklist(name string, r io.Reader) (*BlocklistStatus, error) {
+	name, err := blocklistName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	ranges, _, err := parseBlocklist(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("%w: no IP ranges found", ErrInvalidBlocklist)
+	}
+
+	if err := os.MkdirAll(c.blocklistUploadDir(), 0755); err != nil {
+		return nil, err
+	}
+	// Пишем во временный файл, чтобы перечитывание не увидело файл наполовину
+	path := filepath.Join(c.blocklistUploadDir(), name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+
+	log.Printf("Blocklist %s uploaded: %d ranges", name, len(ranges))
+	return c.ReloadBlocklists(), nil
+}
+
+// RemoveBlocklist удаляет загруженный блоклист. Файлы из конфигурации не удаляются.
+func (c *Client) RemoveBlocklist(name string) (*BlocklistStatus, error) {
+	name, err := blocklistName(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(filepath.Join(c.blocklistUploadDir(), name)); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrBlocklistNotFound, name)
+		}
+		return nil, err
+	}
+
+	log.Printf("Blocklist %s removed", name)
+	return c.ReloadBlocklists(), nil
+}
+
+// blocklistName оставляет от имени файла только базовое имя
+func blocklistName(name string) (string, error) {
+	name = filepath.Base(strings.TrimSpace(name))
+	if name == "" || name == "." || name == ".." || name == string(filepath.Separator) || strings.HasSuffix(name, ".tmp") {
+		return "", fmt.Errorf("%w: bad file name %q", ErrInvalidBlocklist, name)
+	}
+	return name, nil
+}
+
+func parseBlocklistFile(path string) ([]iplist.Range, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	return parseBlocklist(f)
+}
+
+// parseBlocklist разбирает блоклист в формате PeerGuardian P2P ("описание:first-last")
+// или eMule DAT ("first - last , уровень , описание"); формат определяется для каждой
+// строки. Поддерживаются файлы, сжатые gzip. Возвращает число пропущенных строк.
+func parseBlocklist(r io.Reader) ([]iplist.Range, int, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: %v", ErrInvalidBlocklist, err)
+		}
+		defer gz.Close()
+		br = bufio.NewReader(gz)
+	}
+
+	var ranges []iplist.Range
+	skipped := 0
+	scanner := bufio.NewScanner(br)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		r, blocked, err := parseBlocklistLine(line)
+		if err != nil {
+			skipped++
+			continue
+		}
+		if blocked {
+			ranges = append(ranges, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, skipped, fmt.Errorf("%w: %v", ErrInvalidBlocklist, err)
+	}
+	return ranges, skipped, nil
+}
+
+// parseBlocklistLine разбирает строку; blocked=false для разрешенных диапазонов DAT
+func parseBlocklistLine(line string) (iplist.Range, bool, error) {
+	// DAT: диапазон до первой запятой, затем уровень и описание
+	if fields := strings.SplitN(line, ",", 3); len(fields) >= 2 {
+		if r, err := parseIPRange(fields[0]); err == nil {
+			level, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+			if err != nil {
+				return iplist.Range{}, false, err
+			}
+			if len(fields) == 3 {
+				r.Description = strings.TrimSpace(fields[2])
+			}
+			return r, level <= datMaxBlockedLevel, nil
+		}
+	}
+
+	// P2P: двоеточия бывают и в описании, и в адресах IPv6, поэтому диапазоном считается
+	// первый остаток строки после двоеточия, который удается разобрать
+	for i := 0; i < len(line); i++ {
+		if line[i] != ':' {
+			continue
+		}
+		if r, err := parseIPRange(line[i+1:]); err == nil {
+			r.Description = strings.TrimSpace(line[:i])
+			return r, true, nil
+		}
+	}
+	return iplist.Range{}, false, fmt.Errorf("%w: %q", ErrInvalidBlocklist, line)
+}
+
+// parseIPRange разбирает "first-last"; адреса одного семейства, first <= last
+func parseIPRange(s string) (iplist.Range, error) {
+	first, last, ok := strings.Cut(s, "-")
+	if !ok {
+		return iplist.Range{}, fmt.Errorf("%w: %q", ErrInvalidBlocklist, s)
+	}
+	from, err := parseBlocklistIP(first)
+	if err != nil {
+		return iplist.Range{}, err
+	}
+	to, err := parseBlocklistIP(last)
+	if err != nil {
+		return iplist.Range{}, err
+	}
+	if from.Is4() != to.Is4() || to.Less(from) {
+		return iplist.Range{}, fmt.Errorf("%w: %q", ErrInvalidBlocklist, s)
+	}
+	return iplist.Range{First: net.IP(from.AsSlice()), Last: net.IP(to.AsSlice())}, nil
+}
+
+// parseBlocklistIP разбирает адрес; в IPv4 допускаются ведущие нули ("001.002.003.004"),
+// которые встречаются в DAT-файлах, но не принимаются netip
+func parseBlocklistIP(s string) (netip.Addr, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, ":") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("%w: %v", ErrInvalidBlocklist, err)
+		}
+		return addr.Unmap(), nil
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) != 4 {
+		return netip.Addr{}, fmt.Errorf("%w: bad IP %q", ErrInvalidBlocklist, s)
+	}
+	var ip [4]byte
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 8)
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("%w: bad IP %q", ErrInvalidBlocklist, s)
+		}
+		ip[i] = byte(n)
+	}
+	return netip.AddrFrom4(ip), nil
+}
+
+// buildBlocklist сортирует диапазоны и объединяет пересекающиеся и смежные: iplist
+// требует отсортированного списка без пересечений
+func buildBlocklist(ranges []iplist.Range) *blocklist {
+	var v4, v6 []iplist.Range
+	for _, r := range ranges {
+		if len(r.First) == net.IPv4len {
+			v4 = append(v4, r)
+		} else {
+			v6 = append(v6, r)
+		}
+	}
+	return &blocklist{v4: iplist.New(mergeRanges(v4)), v6: iplist.New(mergeRanges(v6))}
+}
+
+func mergeRanges(ranges []iplist.Range) []iplist.Range {
+	sort.Slice(ranges, func(i, j int) bool {
+		return bytes.Compare(ranges[i].First, ranges[j].First) < 0
+	})
+
+	merged := ranges[:0]
+	for _, r := range ranges {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if bytes.Compare(r.First, nextIP(last.Last)) <= 0 {
+				if bytes.Compare(r.Last, last.Last) > 0 {
+					last.Last = r.Last
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// nextIP возвращает следующий адрес (для последнего адреса - его же)
+func nextIP(ip net.IP) net.IP {
+	next := append(net.IP(nil), ip...)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			return next
+		}
+	}
+	return ip
+}
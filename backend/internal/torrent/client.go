@@ -2,12 +2,15 @@ package torrent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"gamecloud/internal/config"
 	"io"
 	"log"
+	"math/rand"
 	"net/http"
 	"os"
+	"slices"
 	"sync"
 	"time"
 
@@ -17,12 +20,92 @@ import (
 	"github.com/google/uuid"
 )
 
+var (
+	// ErrMetadataTimeout - метаданные торрента не получены за отведенное время
+	ErrMetadataTimeout = errors.New("timeout waiting for torrent info")
+	// ErrInvalidTorrent - торрент-файл или magnet-ссылку невозможно разобрать
+	ErrInvalidTorrent = errors.New("invalid torrent")
+	// ErrTorrentActive - торрент уже добавлен в клиент с другим расположением данных
+	ErrTorrentActive = errors.New("torrent is already active")
+)
+
+// HTTPStatusError возвращается, если сервер ответил неуспешным статусом на запрос .torrent файла
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("failed to download torrent file: HTTP %d", e.StatusCode)
+}
+
+// AdmissionFunc решает, можно ли начинать загрузку торрента, когда стала известна
+// его информация. dir - директория, в которую будут записаны данные, size - количество
+// байт, которое еще предстоит скачать.
+type AdmissionFunc func(downloadID, dir string, size int64) error
+
 type Client struct {
 	client    *torrent.Client
 	config    *config.TorrentConfig
 	mu        sync.RWMutex
 	downloads map[string]*DownloadJob
 	stopCh    chan struct{}
+	// Загрузки, использующие каждый торрент (см. owners.go); защищено mu
+	owners map[metainfo.Hash]*torrentOwners
+	admission AdmissionFunc
+
+	// Бэкенд хранения по умолчанию, дополнительные бэкенды для отдельных загрузок
+	// и общая для них база piece completion
+	storage    storage.ClientImplCloser
+	storages   map[string]storage.ClientImplCloser
+	completion storage.PieceCompletion
+
+	// Анонсы на трекеры (см. trackers.go)
+	clientConfig    *torrent.ClientConfig
+	trackersMu      sync.Mutex
+	trackers        map[metainfo.Hash]map[string]*trackerAnnouncer
+	announceLists   map[metainfo.Hash][][]string // все трекеры торрента по уровням
+	defaultTrackers []string
+	announceKey     int32
+
+	// Заблокированные пиры и блоклисты (см. peers.go, blocklist.go)
+	peerFilter *peerFilter
+	blocklist  blocklistState
+
+	// Сглаженные скорости торрентов (см. rates.go)
+	rates   map[metainfo.Hash]*rateMeter
+	ratesMu sync.Mutex
+
+	// Торренты в режиме последовательной загрузки (см. stream.go)
+	sequentialMu sync.Mutex
+	sequential   map[metainfo.Hash]*sequentialState
+
+	// Прокси для исходящего трафика (см. proxy.go); nil - соединения напрямую
+	proxy      *proxyDialer
+	httpClient *http.Client
+
+	// Закрывается, когда проброс порта через NAT-PMP снят (см. natpmp.go); nil - не запущен
+	natPMPDone chan struct{}
+}
+
+// AddOptions задает параметры добавления торрента
+type AddOptions struct {
+	// Директория для данных торрента; пусто - DownloadDir из конфигурации
+	DownloadDir string
+	// Бэкенд хранения (file, mmap, piece); пусто - бэкенд из конфигурации
+	Storage string
+	// Последовательная загрузка: сначала первые недостающие данные
+	Sequential bool
+	// Существующие данные торрента (каталог или файл), которые нужно использовать на
+	// месте, даже если имя отличается от имени в торренте; DownloadDir и Storage не учитываются
+	ContentPath string
+	// Перепроверить хеши всех частей перед загрузкой: данные на диске могли измениться
+	Verify bool
+	// Владелец торрента - загрузка, для которой он добавлен. Одинаковый торрент нескольких
+	// владельцев добавляется в клиент один раз и удаляется, когда его отпустит последний.
+	Owner string
+	// Дополнительные веб-сиды (HTTP зеркала) к указанным в magnet-ссылке и .torrent файле
+	WebSeeds []string
 }
 
 type DownloadJob struct {
@@ -34,22 +117,30 @@ type DownloadJob struct {
 	ctx      context.Context
 	cancel   context.CancelFunc
 	mu       sync.RWMutex
+	paused   bool
+	opts     AddOptions
 }
 
 type ProgressUpdate struct {
-	ID           string    `json:"id"`
-	InfoHash     string    `json:"info_hash"`
-	Name         string    `json:"name"`
-	Size         int64     `json:"size"`
-	Downloaded   int64     `json:"downloaded"`
-	DownloadRate float64   `json:"download_rate"`
-	UploadRate   float64   `json:"upload_rate"`
-	Progress     float64   `json:"progress"`
-	Status       string    `json:"status"`
-	ETA          int64     `json:"eta"`
-	Peers        int       `json:"peers"`
-	Seeds        int       `json:"seeds"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID                string    `json:"id"`
+	InfoHash          string    `json:"info_hash"`
+	Name              string    `json:"name"`
+	Size              int64     `json:"size"`
+	Downloaded        int64     `json:"downloaded"`
+	DownloadRate      float64   `json:"download_rate"`
+	UploadRate        float64   `json:"upload_rate"`
+	Progress          float64   `json:"progress"`
+	Status            string    `json:"status"`
+	ETA               int64     `json:"eta"`
+	Peers             int       `json:"peers"`
+	Seeds             int       `json:"seeds"`
+	Error             string    `json:"error,omitempty"`
+	Checked           float64   `json:"checked,omitempty"`   // доля проверенных частей при перепроверке, 0.0 to 100.0
+	WebSeeds          int       `json:"web_seeds"`           // число веб-сидов торрента
+	WebSeedDownloaded int64     `json:"web_seed_downloaded"` // скачано с веб-сидов за сессию
+	WebSeedRate       float64   `json:"web_seed_rate"`       // bytes/s, сглаженная; входит в download_rate
+	Err               error     `json:"-"`                   // исходная ошибка для классификации на стороне менеджера
+	UpdatedAt         time.Time `json:"updated_at"`
 }
 
 type TorrentInfo struct {
@@ -70,18 +161,56 @@ func NewClient(cfg *config.TorrentConfig) (*Client, error) {
 	// Создаем конфигурацию для anacrolix/torrent
 	clientConfig := torrent.NewDefaultClientConfig()
 	
+	c := &Client{
+		config:    cfg,
+		downloads: make(map[string]*DownloadJob),
+		stopCh:    make(chan struct{}),
+		owners:    make(map[metainfo.Hash]*torrentOwners),
+		storages:  make(map[string]storage.ClientImplCloser),
+		trackers:  make(map[metainfo.Hash]map[string]*trackerAnnouncer),
+
+		clientConfig:  clientConfig,
+		announceLists: make(map[metainfo.Hash][][]string),
+		announceKey:   rand.Int31(),
+		peerFilter:    newPeerFilter(),
+		sequential:    make(map[metainfo.Hash]*sequentialState),
+		rates:         make(map[metainfo.Hash]*rateMeter),
+		httpClient:    http.DefaultClient,
+	}
+
+	c.peerFilter.stats = &c.blocklist
+
+	if !ValidStorage(cfg.Storage) {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStorage, cfg.Storage)
+	}
+	if err := validateNetworkConfig(cfg); err != nil {
+		return nil, err
+	}
+
 	// Настраиваем директорию загрузки
 	if cfg.DownloadDir != "" {
 		err := os.MkdirAll(cfg.DownloadDir, 0755)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create download directory: %w", err)
 		}
+
+		// Состояние скачанных частей храним в отдельной директории, чтобы после
+		// перезапуска не перепроверять данные заново
+		if err := os.MkdirAll(c.stateDir(), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create torrent state directory: %w", err)
+		}
+		c.completion, err = storage.NewDefaultPieceCompletionForDir(c.stateDir())
+		if err != nil {
+			return nil, fmt.Errorf("failed to open piece completion database: %w", err)
+		}
 		
-		// Используем базовый storage без дополнительных слоев для избежания конфликтов
-		clientConfig.DefaultStorage = storage.NewFile(cfg.DownloadDir)
-		
-		// Альтернативно можно попробовать mmap storage (закомментировано)
-		// clientConfig.DefaultStorage = storage.NewMMap(cfg.DownloadDir)
+		// Бэкенд хранения выбирается в конфигурации (file, mmap или piece)
+		c.storage, err = c.newStorage(c.defaultStorageName(), cfg.DownloadDir)
+		if err != nil {
+			c.completion.Close()
+			return nil, err
+		}
+		clientConfig.DefaultStorage = c.storage
 	}
 	
 	// Включаем seeding для поддержки сообщества
@@ -90,40 +219,66 @@ func NewClient(cfg *config.TorrentConfig) (*Client, error) {
 	// Отключаем debug логи для production
 	clientConfig.Debug = false
 	
-	// Включаем DHT для поиска пиров без трекеров
-	clientConfig.NoDHT = false
-	
-	// Включаем PEX для обмена пирами
-	clientConfig.DisablePEX = false
-	
-	// Включаем поддержку uTP (micro Transport Protocol)
-	clientConfig.DisableUTP = false
-	
+	// Порт, протоколы, шифрование и лимиты соединений задаются в конфигурации
+	applyNetworkConfig(clientConfig, cfg)
+
 	// Более консервативные настройки для стабильности
 	clientConfig.MaxUnverifiedBytes = 16 << 20 // Уменьшаем до 16MB
-	
-	// Ограничиваем количество одновременных соединений для снижения нагрузки на диск
-	clientConfig.EstablishedConnsPerTorrent = 30
-	clientConfig.HalfOpenConnsPerTorrent = 15
-	
-	// Настройка таймаутов для стабильности
-	clientConfig.HandshakesTimeout = 20 * time.Second
-	
+
 	// Отключаем аггрессивную загрузку для снижения конкуренции за файлы
 	clientConfig.DisableAggressiveUpload = true
-	
+
+	// Лимит памяти под запросы пира должен вмещать всю его очередь запросов (до 1024 блоков
+	// по 16 KiB): с меньшим лимитом библиотека может ждать резерв для одного запроса, пока
+	// освободившийся резерв уходит другому, и отдача пиру останавливается навсегда
+	clientConfig.MaxAllocPeerRequestDataPerConn = 1024 * 16 << 10
+
+	// На HTTP и UDP трекеры анонсируемся сами, чтобы знать их состояние; трекеры WebTorrent
+	// анонсирует библиотека (см. trackers.go)
+	clientConfig.Callbacks.StatusUpdated = append(clientConfig.Callbacks.StatusUpdated, c.onTrackerStatus)
+
+	// Баны пиров: глобальные и блоклисты проверяет сама библиотека, для отдельных
+	// торрентов - колбэк
+	clientConfig.IPBlocklist = c.peerFilter
+	c.ReloadBlocklists()
+	clientConfig.Callbacks.PeerConnAdded = append(clientConfig.Callbacks.PeerConnAdded, c.onPeerConnAdded)
+	
+	if cfg.ProxyURL != "" {
+		if err := c.applyProxy(cfg.ProxyURL, cfg.ProxyFailClosed); err != nil {
+			c.closeStorages()
+			return nil, err
+		}
+	}
+
+
 	// Создаем клиент
 	client, err := torrent.NewClient(clientConfig)
 	if err != nil {
+		c.closeStorages()
 		return nil, fmt.Errorf("failed to create torrent client: %w", err)
 	}
+	c.client = client
+	if c.proxy != nil {
+		client.AddDialer(torrent.NetworkDialer{Network: "tcp", Dialer: c.proxy})
+	}
 
-	return &Client{
-		client:    client,
-		config:    cfg,
-		downloads: make(map[string]*DownloadJob),
-		stopCh:    make(chan struct{}),
-	}, nil
+	// Восстанавливаем таблицу DHT с прошлого запуска и периодически сохраняем ее
+	c.loadDHTNodes()
+	go c.persistState()
+	go c.sampleRates()
+	if slices.Contains(cfg.PortForwarding, PortForwardingNATPMP) {
+		c.natPMPDone = make(chan struct{})
+		go c.forwardNATPMP(client.LocalPort(), c.natPMPProtocols())
+	}
+
+	return c, nil
+}
+
+// SetAdmissionCheck устанавливает проверку, выполняемую перед стартом каждой загрузки
+func (c *Client) SetAdmissionCheck(fn AdmissionFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.admission = fn
 }
 
 func (c *Client) Close() error {
@@ -135,116 +290,132 @@ func (c *Client) Close() error {
 		job.cancel()
 	}
 	c.mu.Unlock()
+
+	// Сохраняем таблицу DHT до закрытия клиента
+	c.saveDHTNodes()
+
+	// Дожидаемся удаления проброса порта на шлюзе
+	if c.natPMPDone != nil {
+		<-c.natPMPDone
+	}
 	
 	errs := c.client.Close()
+
+	// Закрываем storage (и базу piece completion) после остановки клиента
+	errs = append(errs, c.closeStorages()...)
+
 	if len(errs) > 0 {
 		return errs[0] // Возвращаем первую ошибку
 	}
 	return nil
 }
 
-func (c *Client) AddMagnet(magnetLink, downloadPath string) (string, chan ProgressUpdate, error) {
+func (c *Client) AddMagnet(magnetLink string, opts AddOptions) (string, chan ProgressUpdate, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	// Добавляем торрент по магнет-ссылке
-	t, err := c.client.AddMagnet(magnetLink)
+	spec, err := torrent.TorrentSpecFromMagnetUri(magnetLink)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to add magnet link: %w: %w", ErrInvalidTorrent, err)
+	}
+	c.withDefaultTrackers(spec)
+	t, err := c.addSpec(spec, opts)
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to add magnet link: %w", err)
 	}
 
-	// Создаем контекст для управления загрузкой
-	ctx, cancel := context.WithCancel(context.Background())
-	
-	// Генерируем уникальный ID для загрузки
-	downloadID := uuid.New().String()
-	
-	// Создаем задачу загрузки
-	job := &DownloadJob{
-		ID:       downloadID,
-		Torrent:  t,
-		Progress: make(chan ProgressUpdate, 100),
-		Done:     make(chan struct{}),
-		Error:    make(chan error, 1),
-		ctx:      ctx,
-		cancel:   cancel,
-	}
-	
-	c.downloads[downloadID] = job
-	
-	// Запускаем горутину для обработки загрузки
-	go c.processDownload(job, downloadPath)
-	
-	return downloadID, job.Progress, nil
+	downloadID, progress := c.startJob(t, opts)
+	return downloadID, progress, nil
 }
 
-func (c *Client) AddTorrentURL(torrentURL, downloadPath string) (string, chan ProgressUpdate, error) {
+func (c *Client) AddTorrentURL(torrentURL string, opts AddOptions) (string, chan ProgressUpdate, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// Загружаем .torrent файл по URL
-	resp, err := http.Get(torrentURL)
+	// Загружаем и разбираем .torrent файл по URL
+	metaInfo, err := c.fetchMetainfo(context.Background(), torrentURL)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to download torrent file: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", nil, fmt.Errorf("failed to download torrent file: HTTP %d", resp.StatusCode)
-	}
-
-	// Читаем metainfo из загруженного файла
-	metaInfo, err := metainfo.Load(resp.Body)
-	if err != nil {
-		return "", nil, fmt.Errorf("failed to parse torrent file: %w", err)
+		return "", nil, err
 	}
 
 	// Добавляем торрент
-	t, err := c.client.AddTorrent(metaInfo)
+	t, err := c.addMetainfo(metaInfo, opts)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to add torrent: %w", err)
+		return "", nil, err
 	}
 
-	// Создаем контекст для управления загрузкой
-	ctx, cancel := context.WithCancel(context.Background())
-	
-	// Генерируем уникальный ID для загрузки
-	downloadID := uuid.New().String()
-	
-	// Создаем задачу загрузки
-	job := &DownloadJob{
-		ID:       downloadID,
-		Torrent:  t,
-		Progress: make(chan ProgressUpdate, 100),
-		Done:     make(chan struct{}),
-		Error:    make(chan error, 1),
-		ctx:      ctx,
-		cancel:   cancel,
-	}
-	
-	c.downloads[downloadID] = job
-	
-	// Запускаем горутину для обработки загрузки
-	go c.processDownload(job, downloadPath)
-	
-	return downloadID, job.Progress, nil
+	downloadID, progress := c.startJob(t, opts)
+	return downloadID, progress, nil
 }
 
-func (c *Client) AddTorrentFile(torrentFile io.Reader, downloadPath string) (string, chan ProgressUpdate, error) {
+func (c *Client) AddTorrentFile(torrentFile io.Reader, opts AddOptions) (string, chan ProgressUpdate, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	// Читаем metainfo из файла
 	metaInfo, err := metainfo.Load(torrentFile)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to parse torrent file: %w", err)
+		return "", nil, fmt.Errorf("failed to parse torrent file: %w: %w", ErrInvalidTorrent, err)
 	}
 
 	// Добавляем торрент
-	t, err := c.client.AddTorrent(metaInfo)
+	t, err := c.addMetainfo(metaInfo, opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	downloadID, progress := c.startJob(t, opts)
+	return downloadID, progress, nil
+}
+
+// addMetainfo добавляет торрент из разобранного .torrent файла
+func (c *Client) addMetainfo(metaInfo *metainfo.MetaInfo, opts AddOptions) (*torrent.Torrent, error) {
+	spec, err := torrent.TorrentSpecFromMetaInfoErr(metaInfo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add torrent: %w: %w", ErrInvalidTorrent, err)
+	}
+	t, err := c.addSpec(spec, opts)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to add torrent: %w", err)
+		return nil, fmt.Errorf("failed to add torrent: %w", err)
 	}
+	return t, nil
+}
+
+// addSpec добавляет торрент в клиент с учетом выбранного бэкенда хранения.
+// Вызывается с захваченным c.mu.
+func (c *Client) addSpec(spec *torrent.TorrentSpec, opts AddOptions) (*torrent.Torrent, error) {
+	var impl storage.ClientImpl
+	var err error
+	if opts.ContentPath != "" {
+		// Хранилище уже добавленного торрента не заменить - данные остались бы на старом месте
+		if _, ok := c.client.Torrent(spec.InfoHash); ok {
+			return nil, fmt.Errorf("%w: %s", ErrTorrentActive, spec.InfoHash.HexString())
+		}
+		impl, err = c.rootedStorage(opts.ContentPath)
+	} else {
+		impl, err = c.storageFor(opts.Storage, opts.DownloadDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	spec.Storage = impl
+	spec.Webseeds = append(spec.Webseeds, opts.WebSeeds...)
+
+	// Уже добавленный торрент возвращается как есть, с прежним хранилищем: новый владелец
+	// использует те же данные
+	t, err := c.addTorrentSpec(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidTorrent, err)
+	}
+	c.addOwner(t.InfoHash(), opts)
+	return t, nil
+}
+
+// startJob создает задачу загрузки для добавленного торрента и запускает ее обработку.
+// Вызывается с захваченным c.mu.
+func (c *Client) startJob(t *torrent.Torrent, opts AddOptions) (string, chan ProgressUpdate) {
+	opts = c.sharedOptions(t.InfoHash(), opts)
 
 	// Создаем контекст для управления загрузкой
 	ctx, cancel := context.WithCancel(context.Background())
@@ -261,17 +432,19 @@ func (c *Client) AddTorrentFile(torrentFile io.Reader, downloadPath string) (str
 		Error:    make(chan error, 1),
 		ctx:      ctx,
 		cancel:   cancel,
+		opts:     opts,
 	}
 	
 	c.downloads[downloadID] = job
 	
 	// Запускаем горутину для обработки загрузки
-	go c.processDownload(job, downloadPath)
+	go c.processDownload(job, opts.DownloadDir)
 	
-	return downloadID, job.Progress, nil
+	return downloadID, job.Progress
 }
 
 func (c *Client) processDownload(job *DownloadJob, downloadPath string) {
+	completed := false
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("Panic recovered in processDownload: %v", r)
@@ -290,8 +463,9 @@ func (c *Client) processDownload(job *DownloadJob, downloadPath string) {
 			}
 		}
 		
-		// Удаляем из карты активных загрузок
-		if job != nil {
+		// Удаляем из карты активных загрузок. Завершенная загрузка остается до ReleaseJob:
+		// менеджеру еще нужен путь к ее данным для обработки
+		if job != nil && !completed {
 			c.mu.Lock()
 			delete(c.downloads, job.ID)
 			c.mu.Unlock()
@@ -309,18 +483,47 @@ func (c *Client) processDownload(job *DownloadJob, downloadPath string) {
 	select {
 	case <-t.GotInfo():
 		log.Printf("Got torrent info for: %s", t.Name())
-	case <-time.After(60 * time.Second):
-		if job.Error != nil {
-			job.Error <- fmt.Errorf("timeout waiting for torrent info")
-		}
+		// Сохраняем метаданные, чтобы после перезапуска не получать их заново
+		c.saveMetainfo(t)
+	case <-time.After(c.metadataTimeout()):
+		log.Printf("Timeout waiting for torrent info: %s", t.InfoHash().String())
+		c.failJob(job, ErrMetadataTimeout)
 		return
 	case <-job.ctx.Done():
 		log.Printf("Download cancelled before getting torrent info")
 		return
 	}
 
+	// Данные уже лежат на диске - сначала узнаем, каких частей не хватает
+	if job.opts.Verify {
+		if err := c.verifyJob(job); err != nil {
+			if job.ctx.Err() != nil {
+				log.Printf("Download cancelled during data check: %s", t.Name())
+				return
+			}
+			log.Printf("Data check failed: %s: %v", t.Name(), err)
+			c.failJob(job, err)
+			return
+		}
+	}
+
+	// Проверяем, можно ли начинать загрузку (например, хватит ли места на диске)
+	c.mu.RLock()
+	admission := c.admission
+	c.mu.RUnlock()
+	if admission != nil {
+		if err := admission(job.ID, c.jobDir(job), t.Length()-t.BytesCompleted()); err != nil {
+			log.Printf("Download rejected: %s: %v", t.Name(), err)
+			c.failJob(job, err)
+			return
+		}
+	}
+
 	// Запускаем загрузку всех файлов
 	t.DownloadAll()
+	if job.opts.Sequential {
+		c.setSequential(t, true)
+	}
 
 	// Мониторинг прогресса в отдельной горутине
 	go c.monitorProgress(job)
@@ -336,21 +539,25 @@ func (c *Client) processDownload(job *DownloadJob, downloadPath string) {
 			if t.BytesCompleted() >= t.Length() {
 				log.Printf("Download completed: %s", t.Name())
 				
-				// Отправляем финальный статус
+				// Отправляем финальный статус; объем с веб-сидов остается в итоге загрузки
+				stats := t.Stats()
 				finalUpdate := ProgressUpdate{
-					ID:           job.ID,
-					InfoHash:     t.InfoHash().String(),
-					Name:         t.Name(),
-					Size:         t.Length(),
-					Downloaded:   t.BytesCompleted(),
-					Progress:     100.0,
-					Status:       "completed",
-					UpdatedAt:    time.Now(),
+					ID:                job.ID,
+					InfoHash:          t.InfoHash().String(),
+					Name:              t.Name(),
+					Size:              t.Length(),
+					Downloaded:        t.BytesCompleted(),
+					Progress:          100.0,
+					Status:            "completed",
+					WebSeeds:          len(t.WebseedPeerConns()),
+					WebSeedDownloaded: stats.WebSeeds.BytesReadUsefulData.Int64(),
+					UpdatedAt:         time.Now(),
 				}
 				
 				if job.Progress != nil {
 					select {
 					case job.Progress <- finalUpdate:
+						completed = true
 					case <-job.ctx.Done():
 					}
 				}
@@ -363,6 +570,61 @@ func (c *Client) processDownload(job *DownloadJob, downloadPath string) {
 	}
 }
 
+// failJob сообщает об ошибке загрузки и освобождает торрент, если он больше никому не нужен
+func (c *Client) failJob(job *DownloadJob, err error) {
+	t := job.Torrent
+
+	failedUpdate := ProgressUpdate{
+		ID:        job.ID,
+		InfoHash:  t.InfoHash().String(),
+		Name:      t.Name(),
+		Status:    "failed",
+		Error:     err.Error(),
+		Err:       err,
+		UpdatedAt: time.Now(),
+	}
+	if t.Info() != nil {
+		failedUpdate.Size = t.Length()
+		failedUpdate.Downloaded = t.BytesCompleted()
+	}
+
+	select {
+	case job.Progress <- failedUpdate:
+	case <-job.ctx.Done():
+	}
+
+	select {
+	case job.Error <- err:
+	default:
+	}
+
+	c.mu.Lock()
+	last := c.releaseOwner(t.InfoHash(), job.opts.Owner)
+	c.mu.Unlock()
+	if last {
+		t.Drop()
+	}
+}
+
+// jobDir возвращает директорию, в которую пишутся данные торрента задачи
+func (c *Client) jobDir(job *DownloadJob) string {
+	if job.opts.ContentPath != "" {
+		return job.opts.ContentPath
+	}
+	if job.opts.DownloadDir != "" {
+		return job.opts.DownloadDir
+	}
+	return c.config.DownloadDir
+}
+
+// metadataTimeout возвращает время ожидания метаданных торрента
+func (c *Client) metadataTimeout() time.Duration {
+	if c.config.MetadataTimeout > 0 {
+		return c.config.MetadataTimeout
+	}
+	return 60 * time.Second
+}
+
 func (c *Client) monitorProgress(job *DownloadJob) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -378,9 +640,6 @@ func (c *Client) monitorProgress(job *DownloadJob) {
 	ticker := time.NewTicker(2 * time.Second)
 	defer ticker.Stop()
 
-	var lastDownloaded int64
-	var lastUpdate time.Time = time.Now()
-
 	for {
 		select {
 		case <-ticker.C:
@@ -393,39 +652,36 @@ func (c *Client) monitorProgress(job *DownloadJob) {
 			stats := t.Stats()
 			now := time.Now()
 			downloaded := t.BytesCompleted()
-			
-			// Вычисляем скорость скачивания
-			var downloadRate float64
-			if !lastUpdate.IsZero() {
-				timeDiff := now.Sub(lastUpdate).Seconds()
-				if timeDiff > 0 {
-					downloadRate = float64(downloaded-lastDownloaded) / timeDiff
-				}
-			}
-			
-			// Вычисляем ETA
-			var eta int64
-			if downloadRate > 0 {
-				remaining := t.Length() - downloaded
-				eta = int64(float64(remaining) / downloadRate)
-			}
+
+			// Скорости сглажены (см. rates.go), поэтому и ETA не скачет между обновлениями
+			downloadRate, uploadRate := c.rate(t.InfoHash())
+			webSeedRate := c.webSeedRate(t.InfoHash())
+			eta := etaSeconds(t.Length()-downloaded, downloadRate)
 
 			progress := float64(downloaded) / float64(t.Length()) * 100
+
+			status := getStatus(t)
+			if job.isPaused() && status != "completed" {
+				status = "paused"
+			}
 			
 			update := ProgressUpdate{
-				ID:           job.ID,
-				InfoHash:     t.InfoHash().String(),
-				Name:         t.Name(),
-				Size:         t.Length(),
-				Downloaded:   downloaded,
-				DownloadRate: downloadRate,
-				UploadRate:   float64(stats.ConnStats.BytesWrittenData.Int64()),
-				Progress:     progress,
-				Status:       getStatus(t),
-				ETA:          eta,
-				Peers:        stats.ActivePeers,
-				Seeds:        stats.ConnectedSeeders,
-				UpdatedAt:    now,
+				ID:                job.ID,
+				InfoHash:          t.InfoHash().String(),
+				Name:              t.Name(),
+				Size:              t.Length(),
+				Downloaded:        downloaded,
+				DownloadRate:      downloadRate,
+				UploadRate:        uploadRate,
+				Progress:          progress,
+				Status:            status,
+				ETA:               eta,
+				Peers:             stats.ActivePeers,
+				Seeds:             stats.ConnectedSeeders,
+				WebSeeds:          len(t.WebseedPeerConns()),
+				WebSeedDownloaded: stats.WebSeeds.BytesReadUsefulData.Int64(),
+				WebSeedRate:       webSeedRate,
+				UpdatedAt:         now,
 			}
 
 			if job.Progress != nil {
@@ -438,9 +694,6 @@ func (c *Client) monitorProgress(job *DownloadJob) {
 				}
 			}
 
-			lastDownloaded = downloaded
-			lastUpdate = now
-
 		case <-job.ctx.Done():
 			return
 		}
@@ -453,21 +706,68 @@ func (c *Client) CancelDownload(downloadID string) error {
 
 	if job, exists := c.downloads[downloadID]; exists {
 		job.cancel()
-		job.Torrent.Drop()
+		t := job.Torrent
+		if c.releaseOwner(t.InfoHash(), job.opts.Owner) {
+			t.Drop()
+			c.forgetMetainfo(t.InfoHash().HexString())
+		} else if !job.isPaused() && c.othersPaused(t, job) {
+			// Торрент остается у других владельцев, и все они на паузе
+			t.CancelPieces(0, t.NumPieces())
+			t.DisallowDataDownload()
+		}
 		return nil
 	}
 	
 	return fmt.Errorf("download not found: %s", downloadID)
 }
 
+// ReleaseJob прекращает отслеживание загрузки, не удаляя торрент из клиента -
+// он продолжает раздаваться
+func (c *Client) ReleaseJob(downloadID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if job, exists := c.downloads[downloadID]; exists {
+		job.cancel()
+		delete(c.downloads, downloadID)
+	}
+}
+
+// DropTorrent снимает владельца с торрента. Если других владельцев нет, торрент удаляется
+// из клиента вместе с сохраненными метаданными (данные на диске остаются) и возвращается true.
+func (c *Client) DropTorrent(infoHash, owner string) bool {
+	var ih metainfo.Hash
+	if err := ih.FromHexString(infoHash); err != nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.releaseOwner(ih, owner) {
+		return false
+	}
+	if t, ok := c.client.Torrent(ih); ok {
+		t.Drop()
+	}
+	c.forgetMetainfo(infoHash)
+	return true
+}
+
 func (c *Client) PauseDownload(downloadID string) error {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
 	if job, exists := c.downloads[downloadID]; exists {
+		job.setPaused(true)
+		// Общий торрент продолжает скачиваться, пока его не поставят на паузу все владельцы
+		if !c.othersPaused(job.Torrent, job) {
+			return nil
+		}
 		// Для библиотеки anacrolix/torrent паузу можно реализовать 
 		// через отключение всех соединений
 		job.Torrent.CancelPieces(0, job.Torrent.NumPieces())
+		job.Torrent.DisallowDataDownload()
 		return nil
 	}
 	
@@ -480,13 +780,26 @@ func (c *Client) ResumeDownload(downloadID string) error {
 
 	if job, exists := c.downloads[downloadID]; exists {
 		// Возобновляем загрузку всех файлов
+		job.Torrent.AllowDataDownload()
 		job.Torrent.DownloadAll()
+		job.setPaused(false)
 		return nil
 	}
 	
 	return fmt.Errorf("download not found: %s", downloadID)
 }
 
+// InfoHash возвращает info hash торрента загрузки
+func (c *Client) InfoHash(downloadID string) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if job, exists := c.downloads[downloadID]; exists {
+		return job.Torrent.InfoHash().String(), nil
+	}
+	return "", fmt.Errorf("download not found: %s", downloadID)
+}
+
 func (c *Client) GetTorrents() ([]*TorrentInfo, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -496,15 +809,15 @@ func (c *Client) GetTorrents() ([]*TorrentInfo, error) {
 
 	for _, t := range torrents {
 		if t.Info() != nil {
-			stats := t.Stats()
+			downloadRate, uploadRate := c.rate(t.InfoHash())
 			
 			info := &TorrentInfo{
 				InfoHash:     t.InfoHash().String(),
 				Name:         t.Name(),
 				Size:         t.Length(),
 				Downloaded:   t.BytesCompleted(),
-				DownloadRate: stats.ConnStats.BytesReadData.Int64(),
-				UploadRate:   stats.ConnStats.BytesWrittenData.Int64(),
+				DownloadRate: int64(downloadRate),
+				UploadRate:   int64(uploadRate),
 				Progress:     float64(t.BytesCompleted()) / float64(t.Length()) * 100,
 				Status:       getStatus(t),
 				DownloadDir:  c.config.DownloadDir,
@@ -538,15 +851,15 @@ func (c *Client) GetExistingTorrents() []*TorrentInfo {
 	
 	for _, t := range torrents {
 		if t.Info() != nil {
-			stats := t.Stats()
+			downloadRate, uploadRate := c.rate(t.InfoHash())
 			
 			info := &TorrentInfo{
 				InfoHash:     t.InfoHash().String(),
 				Name:         t.Name(),
 				Size:         t.Length(),
 				Downloaded:   t.BytesCompleted(),
-				DownloadRate: stats.ConnStats.BytesReadData.Int64(),
-				UploadRate:   stats.ConnStats.BytesWrittenData.Int64(),
+				DownloadRate: int64(downloadRate),
+				UploadRate:   int64(uploadRate),
 				Progress:     float64(t.BytesCompleted()) / float64(t.Length()) * 100,
 				Status:       getStatus(t),
 				DownloadDir:  c.config.DownloadDir,
@@ -577,7 +890,9 @@ func (c *Client) RestoreDownloadFromTorrent(t *torrent.Torrent, downloadID strin
 		Error:    make(chan error, 1),
 		ctx:      ctx,
 		cancel:   cancel,
+		opts:     c.sharedOptions(t.InfoHash(), AddOptions{Owner: downloadID}),
 	}
+	c.addOwner(t.InfoHash(), job.opts)
 	
 	c.downloads[downloadID] = job
 	
@@ -589,6 +904,18 @@ func (c *Client) RestoreDownloadFromTorrent(t *torrent.Torrent, downloadID strin
 	return downloadID, job.Progress, nil
 }
 
+func (j *DownloadJob) setPaused(paused bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.paused = paused
+}
+
+func (j *DownloadJob) isPaused() bool {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.paused
+}
+
 func getStatus(t *torrent.Torrent) string {
 	if t.BytesCompleted() == t.Length() {
 		return "completed"
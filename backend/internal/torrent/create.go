@@ -0,0 +1,204 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// ErrEmptyContent - в каталоге нет файлов для торрента
+var ErrEmptyContent = errors.New("no files to create torrent from")
+
+// CreateOptions - параметры создания торрента
+type CreateOptions struct {
+	// Файл или каталог с данными
+	Path     string
+	Trackers []string
+	Private  bool
+	Comment  string
+}
+
+// CreateTorrent строит торрент из файла или каталога: размер части выбирается по общему
+// размеру, части хешируются с отчетом о прогрессе. Символические ссылки пропускаются.
+func CreateTorrent(ctx context.Context, opts CreateOptions, progress func(done, total int64)) (*metainfo.MetaInfo, error) {
+	root, err := filepath.Abs(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	rootInfo, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+
+	info := metainfo.Info{Name: filepath.Base(root)}
+	if opts.Private {
+		private := true
+		info.Private = &private
+	}
+
+	if rootInfo.IsDir() {
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			info.Files = append(info.Files, metainfo.FileInfo{
+				Path:   strings.Split(rel, string(filepath.Separator)),
+				Length: fi.Size(),
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(info.Files) == 0 {
+			return nil, ErrEmptyContent
+		}
+		sort.Slice(info.Files, func(i, j int) bool {
+			return strings.Join(info.Files[i].Path, "/") < strings.Join(info.Files[j].Path, "/")
+		})
+	} else {
+		info.Length = rootInfo.Size()
+	}
+
+	total := info.TotalLength()
+	if total == 0 {
+		return nil, ErrEmptyContent
+	}
+	info.PieceLength = metainfo.ChoosePieceLength(total)
+
+	var done int64
+	err = info.GeneratePieces(func(fi metainfo.FileInfo) (io.ReadCloser, error) {
+		path := root
+		if rootInfo.IsDir() {
+			path = filepath.Join(root, filepath.Join(fi.Path...))
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return &hashReader{ctx: ctx, f: f, onRead: func(n int) {
+			done += int64(n)
+			if progress != nil {
+				progress(done, total)
+			}
+		}}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash pieces: %w", err)
+	}
+
+	mi := &metainfo.MetaInfo{
+		CreatedBy:    "GameCloud",
+		CreationDate: time.Now().Unix(),
+		Comment:      opts.Comment,
+	}
+	if len(opts.Trackers) > 0 {
+		mi.Announce = opts.Trackers[0]
+		mi.AnnounceList = metainfo.AnnounceList{opts.Trackers}
+	}
+	mi.InfoBytes, err = bencode.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	return mi, nil
+}
+
+// hashReader читает файл для хеширования, сообщает о прочитанном и прерывается по ctx
+type hashReader struct {
+	ctx    context.Context
+	f      *os.File
+	onRead func(n int)
+}
+
+func (r *hashReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.f.Read(p)
+	if n > 0 {
+		r.onRead(n)
+	}
+	return n, err
+}
+
+func (r *hashReader) Close() error {
+	return r.f.Close()
+}
+
+// Seed начинает раздачу торрента, данные которого уже лежат в path (файл или каталог
+// с именем торрента). Если verified, части отмечаются как скачанные без проверки - они
+// только что посчитаны при создании; иначе используется сохраненная база piece completion.
+// owner - загрузка, которой принадлежит раздача (см. AddOptions.Owner).
+func (c *Client) Seed(mi *metainfo.MetaInfo, path, owner string, verified bool) (string, error) {
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidTorrent, err)
+	}
+	ih := mi.HashInfoBytes()
+
+	if verified && c.completion != nil {
+		for i := 0; i < info.NumPieces(); i++ {
+			pk := metainfo.PieceKey{InfoHash: ih, Index: i}
+			if err := c.completion.Set(pk, true); err != nil {
+				return "", fmt.Errorf("failed to mark pieces complete: %w", err)
+			}
+		}
+	}
+
+	c.mu.Lock()
+	t, err := c.addMetainfo(mi, AddOptions{
+		DownloadDir: filepath.Dir(path),
+		Storage:     StorageFile,
+		Owner:       owner,
+	})
+	c.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	<-t.GotInfo()
+	c.saveMetainfo(t)
+	if c.completion == nil {
+		// Без базы piece completion состояние частей неизвестно - проверяем данные
+		go t.VerifyData()
+	}
+	t.DownloadAll()
+	return ih.HexString(), nil
+}
+
+// MetainfoBytes возвращает .torrent файл торрента из кэша метаданных
+func (c *Client) MetainfoBytes(infoHash string) ([]byte, error) {
+	mi, err := c.LoadCachedMetainfo(infoHash)
+	if err != nil {
+		return nil, err
+	}
+	return bencode.Marshal(mi)
+}
+
+// MagnetLink возвращает magnet-ссылку торрента
+func MagnetLink(mi *metainfo.MetaInfo) (string, error) {
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return "", err
+	}
+	magnet := mi.Magnet(nil, &info)
+	return magnet.String(), nil
+}
@@ -0,0 +1,108 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// ContentPath возвращает путь к скачанным данным торрента: файл для однофайлового торрента
+// или директорию. Для бэкенда piece файлов на диске нет - возвращается пустая строка,
+// данные нужно выгрузить через ExportFiles.
+func (c *Client) ContentPath(downloadID string) (string, error) {
+	c.mu.RLock()
+	job, exists := c.downloads[downloadID]
+	c.mu.RUnlock()
+	if !exists {
+		return "", fmt.Errorf("download not found: %s", downloadID)
+	}
+
+	info := job.Torrent.Info()
+	if info == nil {
+		return "", fmt.Errorf("torrent info is not available: %s", downloadID)
+	}
+
+	if job.opts.ContentPath != "" {
+		return job.opts.ContentPath, nil
+	}
+
+	storageName := job.opts.Storage
+	if storageName == "" {
+		storageName = c.defaultStorageName()
+	}
+	if storageName == StoragePiece {
+		return "", nil
+	}
+
+	dir := job.opts.DownloadDir
+	if dir == "" {
+		dir = c.config.DownloadDir
+	}
+	return filepath.Join(dir, info.BestName()), nil
+}
+
+// ExportFiles записывает файлы завершенного торрента в директорию dest через торрент-клиент.
+// progress вызывается после каждого записанного блока с числом записанных и общим числом байт.
+func (c *Client) ExportFiles(ctx context.Context, infoHash, dest string, progress func(done, total int64)) error {
+	var ih metainfo.Hash
+	if err := ih.FromHexString(infoHash); err != nil {
+		return fmt.Errorf("invalid info hash %q: %w", infoHash, err)
+	}
+	t, ok := c.client.Torrent(ih)
+	if !ok {
+		return fmt.Errorf("torrent not found: %s", infoHash)
+	}
+	if t.Info() == nil {
+		return fmt.Errorf("torrent info is not available: %s", infoHash)
+	}
+
+	total := t.Length()
+	var done int64
+	buf := make([]byte, 1<<20)
+
+	for _, file := range t.Files() {
+		path := filepath.Join(dest, filepath.FromSlash(file.Path()))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		err := func() error {
+			out, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+
+			reader := file.NewReader()
+			defer reader.Close()
+			reader.SetContext(ctx)
+
+			for {
+				n, readErr := reader.Read(buf)
+				if n > 0 {
+					if _, err := out.Write(buf[:n]); err != nil {
+						return err
+					}
+					done += int64(n)
+					if progress != nil {
+						progress(done, total)
+					}
+				}
+				if readErr == io.EOF {
+					return nil
+				}
+				if readErr != nil {
+					return readErr
+				}
+			}
+		}()
+		if err != nil {
+			return fmt.Errorf("failed to export %s: %w", file.Path(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// TorrentPreview описывает содержимое торрента до создания загрузки
+type TorrentPreview struct {
+	Name         string     `json:"name"`
+	InfoHash     string     `json:"info_hash"`
+	TotalSize    int64      `json:"total_size"`
+	PieceSize    int64      `json:"piece_size"`
+	NumPieces    int        `json:"num_pieces"`
+	NumFiles     int        `json:"num_files"`
+	Private      bool       `json:"private"`
+	Files        *FileNode  `json:"files"`
+	Trackers     []string   `json:"trackers"`
+	WebSeeds     []string   `json:"web_seeds"`
+	Comment      string     `json:"comment,omitempty"`
+	CreatedBy    string     `json:"created_by,omitempty"`
+	CreationDate *time.Time `json:"creation_date,omitempty"`
+	MagnetLink   string     `json:"magnet_link"`
+}
+
+// FileNode - узел дерева файлов торрента (директория или файл)
+type FileNode struct {
+	Name     string      `json:"name"`
+	Path     string      `json:"path"`
+	Size     int64       `json:"size"`
+	IsDir    bool        `json:"is_dir"`
+	Children []*FileNode `json:"children,omitempty"`
+}
+
+// InspectTorrentFile разбирает .torrent файл без добавления его в клиент
+func (c *Client) InspectTorrentFile(torrentFile io.Reader) (*TorrentPreview, error) {
+	return PreviewTorrentFile(torrentFile)
+}
+
+// InspectTorrentURL скачивает .torrent файл по URL и разбирает его
+func (c *Client) InspectTorrentURL(ctx context.Context, torrentURL string) (*TorrentPreview, error) {
+	mi, err := c.fetchMetainfo(ctx, torrentURL)
+	if err != nil {
+		return nil, err
+	}
+	return buildPreview(mi, nil)
+}
+
+// PreviewTorrentFile разбирает .torrent файл. Не требует клиента - используется и
+// внешними бэкендами загрузок.
+func PreviewTorrentFile(torrentFile io.Reader) (*TorrentPreview, error) {
+	mi, err := metainfo.Load(torrentFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse torrent file: %w: %w", ErrInvalidTorrent, err)
+	}
+	return buildPreview(mi, nil)
+}
+
+// PreviewMetainfo описывает содержимое разобранного .torrent файла
+func PreviewMetainfo(mi *metainfo.MetaInfo) (*TorrentPreview, error) {
+	return buildPreview(mi, nil)
+}
+
+// FileTree строит дерево файлов по info торрента, например, собранной из ответа внешнего клиента
+func FileTree(info *metainfo.Info) (*FileNode, int) {
+	return buildFileTree(info)
+}
+
+// InspectMagnet получает метаданные по magnet-ссылке и сразу удаляет торрент из клиента,
+// не скачивая содержимое. Если торрент уже загружается, используется его информация.
+func (c *Client) InspectMagnet(ctx context.Context, magnetLink string) (*TorrentPreview, error) {
+	magnet, err := metainfo.ParseMagnetUri(magnetLink)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse magnet link: %w: %w", ErrInvalidTorrent, err)
+	}
+
+	t, existing := c.client.Torrent(magnet.InfoHash)
+	if !existing {
+		spec, err := torrent.TorrentSpecFromMagnetUri(magnetLink)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add magnet link: %w: %w", ErrInvalidTorrent, err)
+		}
+		c.withDefaultTrackers(spec)
+		t, err = c.addTorrentSpec(spec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add magnet link: %w: %w", ErrInvalidTorrent, err)
+		}
+		// Торрент нужен только для получения метаданных
+		t.DisallowDataDownload()
+		defer func() {
+			// Пока шла проверка, тот же торрент мог быть добавлен как настоящая загрузка
+			if c.isTracked(t) {
+				t.AllowDataDownload()
+				return
+			}
+			t.Drop()
+		}()
+	}
+
+	timer := time.NewTimer(c.metadataTimeout())
+	defer timer.Stop()
+
+	select {
+	case <-t.GotInfo():
+	case <-timer.C:
+		return nil, ErrMetadataTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	mi := c.fullMetainfo(t)
+	if len(mi.UrlList) == 0 {
+		mi.UrlList = magnet.Params["ws"]
+	}
+	return buildPreview(&mi, magnet.Trackers)
+}
+
+// MagnetName проверяет magnet-ссылку и возвращает имя торрента из параметра dn
+// (пустое, если его нет)
+func MagnetName(magnetLink string) (string, error) {
+	magnet, err := metainfo.ParseMagnetUri(magnetLink)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse magnet link: %w: %w", ErrInvalidTorrent, err)
+	}
+	return magnet.DisplayName, nil
+}
+
+// isTracked сообщает, используется ли торрент какой-либо активной загрузкой
+func (c *Client) isTracked(t *torrent.Torrent) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if _, ok := c.owners[t.InfoHash()]; ok {
+		return true
+	}
+	for _, job := range c.downloads {
+		if job.Torrent == t {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchMetainfo скачивает и разбирает .torrent файл по HTTP(S)
+func (c *Client) fetchMetainfo(ctx context.Context, torrentURL string) (*metainfo.MetaInfo, error) {
+	return FetchMetainfo(ctx, c.httpClient, torrentURL)
+}
+
+// FetchMetainfo скачивает и разбирает .torrent файл по HTTP(S) указанным HTTP-клиентом
+func FetchMetainfo(ctx context.Context, httpClient *http.Client, torrentURL string) (*metainfo.MetaInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, torrentURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download torrent file: %w", err)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download torrent file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPStatusError{URL: torrentURL, StatusCode: resp.StatusCode}
+	}
+
+	mi, err := metainfo.Load(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse torrent file: %w: %w", ErrInvalidTorrent, err)
+	}
+	return mi, nil
+}
+
+func buildPreview(mi *metainfo.MetaInfo, extraTrackers []string) (*TorrentPreview, error) {
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse torrent info: %w: %w", ErrInvalidTorrent, err)
+	}
+
+	infoHash := mi.HashInfoBytes()
+	preview := &TorrentPreview{
+		Name:      info.BestName(),
+		InfoHash:  infoHash.HexString(),
+		TotalSize: info.TotalLength(),
+		PieceSize: info.PieceLength,
+		NumPieces: info.NumPieces(),
+		Private:   info.Private != nil && *info.Private,
+		Trackers:  collectTrackers(mi, extraTrackers),
+		WebSeeds:  append([]string{}, mi.UrlList...),
+		Comment:   mi.Comment,
+		CreatedBy: mi.CreatedBy,
+	}
+
+	if mi.CreationDate > 0 {
+		created := time.Unix(mi.CreationDate, 0)
+		preview.CreationDate = &created
+	}
+
+	magnet := mi.Magnet(&infoHash, &info)
+	preview.MagnetLink = magnet.String()
+
+	preview.Files, preview.NumFiles = buildFileTree(&info)
+	return preview, nil
+}
+
+// collectTrackers возвращает список трекеров без повторов, сохраняя порядок уровней
+func collectTrackers(mi *metainfo.MetaInfo, extra []string) []string {
+	seen := make(map[string]bool)
+	trackers := make([]string, 0)
+	add := func(url string) {
+		if url != "" && !seen[url] {
+			seen[url] = true
+			trackers = append(trackers, url)
+		}
+	}
+
+	for _, tier := range mi.UpvertedAnnounceList() {
+		for _, url := range tier {
+			add(url)
+		}
+	}
+	for _, url := range extra {
+		add(url)
+	}
+	return trackers
+}
+
+// buildFileTree строит дерево файлов торрента; размеры директорий суммируются
+func buildFileTree(info *metainfo.Info) (*FileNode, int) {
+	root := &FileNode{Name: info.BestName(), IsDir: info.IsDir()}
+	if !info.IsDir() {
+		root.Path = root.Name
+		root.Size = info.TotalLength()
+		return root, 1
+	}
+
+	dirs := map[string]*FileNode{"": root}
+	files := info.UpvertedFiles()
+	for _, file := range files {
+		parts := file.BestPath()
+		if len(parts) == 0 {
+			continue
+		}
+		parent := root
+		for i := range parts[:len(parts)-1] {
+			dirPath := strings.Join(parts[:i+1], "/")
+			dir, ok := dirs[dirPath]
+			if !ok {
+				dir = &FileNode{Name: parts[i], Path: dirPath, IsDir: true}
+				dirs[dirPath] = dir
+				parent.Children = append(parent.Children, dir)
+			}
+			parent = dir
+		}
+
+		parent.Children = append(parent.Children, &FileNode{
+			Name: parts[len(parts)-1],
+			Path: strings.Join(parts, "/"),
+			Size: file.Length,
+		})
+	}
+
+	sumDirSizes(root)
+	return root, len(files)
+}
+
+func sumDirSizes(node *FileNode) int64 {
+	if !node.IsDir {
+		return node.Size
+	}
+
+	// Директории показываем перед файлами, внутри группы - по имени
+	sort.Slice(node.Children, func(i, j int) bool {
+		a, b := node.Children[i], node.Children[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		return a.Name < b.Name
+	})
+
+	node.Size = 0
+	for _, child := range node.Children {
+		node.Size += sumDirSizes(child)
+	}
+	return node.Size
+}
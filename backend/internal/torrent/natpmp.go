@@ -0,0 +1,231 @@
+package torrent
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Порт NAT-PMP на шлюзе
+	natPMPPort = 5351
+	// Запрашиваемый срок аренды; продлеваем на половине выданного срока
+	natPMPLifetime = 2 * time.Hour
+	// Пауза перед новой попыткой, если шлюз не ответил или отказал
+	natPMPRetryInterval = 5 * time.Minute
+	// Первый таймаут ответа, дальше он удваивается (RFC 6886, 3.1)
+	natPMPTimeout  = 250 * time.Millisecond
+	natPMPAttempts = 4
+)
+
+// Коды операций NAT-PMP; ответ шлюза приходит с кодом операции + 128
+const (
+	natPMPOpMapUDP = 1
+	natPMPOpMapTCP = 2
+)
+
+// errNoGateway - не удалось определить шлюз по умолчанию
+var errNoGateway = errors.New("default IPv4 gateway not found")
+
+// natPMPClient запрашивает проброс портов у шлюза по NAT-PMP (RFC 6886). UPnP IGD
+// выполняет сама библиотека, а NAT-PMP она не умеет.
+type natPMPClient struct {
+	gateway string // host:port
+	timeout time.Duration
+}
+
+// natPMPMapping - выданный шлюзом проброс
+type natPMPMapping struct {
+	ExternalPort int
+	Lifetime     time.Duration
+}
+
+// mapPort пробрасывает внутренний порт протокола tcp или udp. Нулевой lifetime удаляет
+// проброс.
+func (n natPMPClient) mapPort(protocol string, port int, lifetime time.Duration) (natPMPMapping, error) {
+	var op byte
+	switch protocol {
+	case "tcp":
+		op = natPMPOpMapTCP
+	case "udp":
+		op = natPMPOpMapUDP
+	default:
+		return natPMPMapping{}, fmt.Errorf("unsupported protocol %q", protocol)
+	}
+
+	req := make([]byte, 12)
+	req[1] = op
+	binary.BigEndian.PutUint16(req[4:], uint16(port))
+	if lifetime > 0 {
+		// Просим тот же внешний порт, шлюз может выдать другой
+		binary.BigEndian.PutUint16(req[6:], uint16(port))
+	}
+	binary.BigEndian.PutUint32(req[8:], uint32(lifetime/time.Second))
+
+	conn, err := net.Dial("udp4", n.gateway)
+	if err != nil {
+		return natPMPMapping{}, err
+	}
+	defer conn.Close()
+
+	timeout := n.timeout
+	if timeout <= 0 {
+		timeout = natPMPTimeout
+	}
+	resp := make([]byte, 16)
+	for attempt := 0; attempt < natPMPAttempts; attempt, timeout = attempt+1, timeout*2 {
+		if _, err := conn.Write(req); err != nil {
+			return natPMPMapping{}, err
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		for {
+			size, err := conn.Read(resp)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				return natPMPMapping{}, err
+			}
+			// Ответы на другие запросы (например, на прошлую попытку) пропускаем
+			if size < 16 || resp[0] != 0 || resp[1] != op+128 ||
+				binary.BigEndian.Uint16(resp[8:]) != uint16(port) {
+				continue
+			}
+			if code := binary.BigEndian.Uint16(resp[2:]); code != 0 {
+				return natPMPMapping{}, fmt.Errorf("gateway refused %s mapping of port %d: result code %d", protocol, port, code)
+			}
+			return natPMPMapping{
+				ExternalPort: int(binary.BigEndian.Uint16(resp[10:])),
+				Lifetime:     time.Duration(binary.BigEndian.Uint32(resp[12:])) * time.Second,
+			}, nil
+		}
+	}
+	return natPMPMapping{}, fmt.Errorf("gateway %s did not respond to NAT-PMP", n.gateway)
+}
+
+// mapPorts пробрасывает порт для всех протоколов и возвращает наименьший выданный срок
+func (n natPMPClient) mapPorts(port int, protocols []string, lifetime time.Duration) (time.Duration, error) {
+	granted := lifetime
+	for _, protocol := range protocols {
+		mapping, err := n.mapPort(protocol, port, lifetime)
+		if err != nil {
+			return 0, err
+		}
+		if mapping.ExternalPort != port && lifetime > 0 {
+			log.Printf("NAT-PMP: %s port %d is mapped to external port %d", protocol, port, mapping.ExternalPort)
+		}
+		granted = min(granted, mapping.Lifetime)
+	}
+	return granted, nil
+}
+
+// forwardNATPMP находит шлюз и держит проброс порта клиента до его закрытия
+func (c *Client) forwardNATPMP(port int, protocols []string) {
+	defer close(c.natPMPDone)
+
+	gateway, err := defaultGateway()
+	if err != nil {
+		log.Printf("NAT-PMP port forwarding is unavailable: %v", err)
+		return
+	}
+	n := natPMPClient{gateway: net.JoinHostPort(gateway.String(), strconv.Itoa(natPMPPort))}
+	c.runNATPMP(n, port, protocols, natPMPRetryInterval)
+}
+
+// runNATPMP пробрасывает порт, продлевает аренду и удаляет проброс при закрытии клиента
+func (c *Client) runNATPMP(n natPMPClient, port int, protocols []string, retry time.Duration) {
+	mapped := false
+	lastErr := ""
+	for {
+		wait := retry
+		lifetime, err := n.mapPorts(port, protocols, natPMPLifetime)
+		switch {
+		case err != nil:
+			// Повторяющуюся ошибку не пишем в лог на каждой попытке
+			if err.Error() != lastErr {
+				log.Printf("NAT-PMP port forwarding failed: %v", err)
+				lastErr = err.Error()
+			}
+		default:
+			if !mapped {
+				log.Printf("NAT-PMP: forwarded port %d (%s) on %s", port, strings.Join(protocols, ", "), n.gateway)
+			}
+			mapped, lastErr = true, ""
+			if lifetime > 0 {
+				wait = lifetime / 2
+			}
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-c.stopCh:
+			if mapped {
+				if _, err := n.mapPorts(port, protocols, 0); err != nil {
+					log.Printf("Failed to remove NAT-PMP port mapping: %v", err)
+				}
+			}
+			return
+		}
+	}
+}
+
+// natPMPProtocols возвращает протоколы, на которых клиент принимает соединения: TCP и
+// UDP (uTP и DHT)
+func (c *Client) natPMPProtocols() []string {
+	var protocols []string
+	if c.config.EnableTCP {
+		protocols = append(protocols, "tcp")
+	}
+	if c.config.EnableUTP || c.config.EnableDHT {
+		protocols = append(protocols, "udp")
+	}
+	return protocols
+}
+
+// defaultGateway возвращает шлюз IPv4 по умолчанию из таблицы маршрутов Linux
+func defaultGateway() (net.IP, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNoGateway, err)
+	}
+	defer f.Close()
+	return parseDefaultGateway(f)
+}
+
+// parseDefaultGateway разбирает /proc/net/route: адреса записаны в hex в порядке байт
+// little-endian, у маршрута по умолчанию нулевое назначение и флаг RTF_GATEWAY
+func parseDefaultGateway(r io.Reader) (net.IP, error) {
+	const rtfGateway = 0x2
+
+	scanner := bufio.NewScanner(r)
+	scanner.Scan() // заголовок
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[1] != "00000000" {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil || flags&rtfGateway == 0 {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		return net.IPv4(raw[3], raw[2], raw[1], raw[0]), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errNoGateway
+}
@@ -0,0 +1,222 @@
+package torrent
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// natPMPRequest - запрос проброса, полученный фейковым шлюзом
+type natPMPRequest struct {
+	op           byte
+	internalPort uint16
+	externalPort uint16
+	lifetime     uint32
+}
+
+// fakeGateway отвечает на запросы NAT-PMP: выдает запрошенный порт со сроком lifetime
+// или, если задан result, отказывает с этим кодом
+type fakeGateway struct {
+	addr string
+
+	mu       sync.Mutex
+	lifetime uint32
+	result   uint16
+	silent   bool // не отвечать на запросы
+	requests []natPMPRequest
+}
+
+func newFakeGateway(t *testing.T) *fakeGateway {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	g := &fakeGateway{addr: conn.LocalAddr().String(), lifetime: 3600}
+
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n != 12 {
+				continue
+			}
+			req := natPMPRequest{
+				op:           buf[1],
+				internalPort: binary.BigEndian.Uint16(buf[4:]),
+				externalPort: binary.BigEndian.Uint16(buf[6:]),
+				lifetime:     binary.BigEndian.Uint32(buf[8:]),
+			}
+			g.mu.Lock()
+			g.requests = append(g.requests, req)
+			lifetime, result, silent := g.lifetime, g.result, g.silent
+			g.mu.Unlock()
+			if silent {
+				continue
+			}
+			if req.lifetime == 0 {
+				lifetime = 0
+			}
+
+			resp := make([]byte, 16)
+			resp[1] = req.op + 128
+			binary.BigEndian.PutUint16(resp[2:], result)
+			binary.BigEndian.PutUint32(resp[4:], 1)
+			binary.BigEndian.PutUint16(resp[8:], req.internalPort)
+			binary.BigEndian.PutUint16(resp[10:], req.externalPort)
+			binary.BigEndian.PutUint32(resp[12:], lifetime)
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return g
+}
+
+func (g *fakeGateway) received() []natPMPRequest {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]natPMPRequest(nil), g.requests...)
+}
+
+func (g *fakeGateway) client() natPMPClient {
+	return natPMPClient{gateway: g.addr, timeout: 20 * time.Millisecond}
+}
+
+func TestNATPMPMapPort(t *testing.T) {
+	g := newFakeGateway(t)
+	n := g.client()
+
+	for _, tt := range []struct {
+		protocol string
+		op       byte
+	}{{"tcp", natPMPOpMapTCP}, {"udp", natPMPOpMapUDP}} {
+		mapping, err := n.mapPort(tt.protocol, 42069, natPMPLifetime)
+		if err != nil {
+			t.Fatalf("map %s: %v", tt.protocol, err)
+		}
+		if mapping.ExternalPort != 42069 || mapping.Lifetime != time.Hour {
+			t.Errorf("map %s = %+v", tt.protocol, mapping)
+		}
+		reqs := g.received()
+		want := natPMPRequest{op: tt.op, internalPort: 42069, externalPort: 42069, lifetime: 7200}
+		if last := reqs[len(reqs)-1]; last != want {
+			t.Errorf("map %s request = %+v, want %+v", tt.protocol, last, want)
+		}
+	}
+
+	// Удаление проброса - нулевой срок и нулевой внешний порт
+	if _, err := n.mapPort("tcp", 42069, 0); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	reqs := g.received()
+	want := natPMPRequest{op: natPMPOpMapTCP, internalPort: 42069}
+	if last := reqs[len(reqs)-1]; last != want {
+		t.Errorf("delete request = %+v, want %+v", last, want)
+	}
+
+	if _, err := n.mapPort("sctp", 42069, natPMPLifetime); err == nil {
+		t.Error("mapping an unsupported protocol succeeded")
+	}
+}
+
+func TestNATPMPGatewayErrors(t *testing.T) {
+	t.Run("refused", func(t *testing.T) {
+		g := newFakeGateway(t)
+		g.mu.Lock()
+		g.result = 2 // not authorized
+		g.mu.Unlock()
+		_, err := g.client().mapPort("tcp", 42069, natPMPLifetime)
+		if err == nil || !strings.Contains(err.Error(), "result code 2") {
+			t.Fatalf("err = %v, want refusal with result code 2", err)
+		}
+	})
+
+	t.Run("no response", func(t *testing.T) {
+		g := newFakeGateway(t)
+		g.mu.Lock()
+		g.silent = true
+		g.mu.Unlock()
+		_, err := g.client().mapPort("tcp", 42069, natPMPLifetime)
+		if err == nil {
+			t.Fatal("mapping succeeded without a response")
+		}
+		if n := len(g.received()); n != natPMPAttempts {
+			t.Errorf("gateway got %d requests, want %d", n, natPMPAttempts)
+		}
+	})
+}
+
+func TestRunNATPMPRenewsAndRemoves(t *testing.T) {
+	g := newFakeGateway(t)
+	// Срок в 1 секунду - продление через полсекунды
+	g.mu.Lock()
+	g.lifetime = 1
+	g.mu.Unlock()
+	c := &Client{stopCh: make(chan struct{})}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.runNATPMP(g.client(), 42069, []string{"tcp", "udp"}, time.Minute)
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for len(g.received()) < 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("mapping was not renewed: %+v", g.received())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	close(c.stopCh)
+	<-done
+
+	reqs := g.received()
+	var deleted []byte
+	for _, req := range reqs {
+		if req.lifetime == 0 {
+			deleted = append(deleted, req.op)
+		}
+	}
+	if len(deleted) != 2 || reqs[len(reqs)-1].lifetime != 0 {
+		t.Errorf("mappings were not removed on stop: %+v", reqs)
+	}
+}
+
+func TestParseDefaultGateway(t *testing.T) {
+	const routes = `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	0000A8C0	00000000	0001	0	0	0	00FFFFFF	0	0	0
+eth0	00000000	0100A8C0	0003	0	0	100	00000000	0	0	0
+`
+	ip, err := parseDefaultGateway(strings.NewReader(routes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(net.IPv4(192, 168, 0, 1)) {
+		t.Errorf("gateway = %s, want 192.168.0.1", ip)
+	}
+
+	const noDefault = `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	0000A8C0	00000000	0001	0	0	0	00FFFFFF	0	0	0
+`
+	if _, err := parseDefaultGateway(strings.NewReader(noDefault)); !errors.Is(err, errNoGateway) {
+		t.Errorf("err = %v, want errNoGateway", err)
+	}
+}
+
+func TestValidatePortForwarding(t *testing.T) {
+	cfg := newTestConfig(t.TempDir(), StorageFile)
+	cfg.PortForwarding = []string{PortForwardingUPnP, PortForwardingNATPMP}
+	if err := validateNetworkConfig(cfg); err != nil {
+		t.Errorf("upnp and natpmp rejected: %v", err)
+	}
+	cfg.PortForwarding = []string{"pcp"}
+	if err := validateNetworkConfig(cfg); !errors.Is(err, ErrInvalidNetworkConfig) {
+		t.Errorf("unknown method: err = %v, want ErrInvalidNetworkConfig", err)
+	}
+}
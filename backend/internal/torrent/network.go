@@ -0,0 +1,151 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"gamecloud/internal/config"
+	"net"
+	"slices"
+	"strconv"
+
+	"github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/mse"
+)
+
+// ErrInvalidNetworkConfig - недопустимые сетевые настройки клиента
+var ErrInvalidNetworkConfig = errors.New("invalid torrent network config")
+
+// Политики шифрования соединений с пирами (TORRENT_ENCRYPTION)
+const (
+	// Только зашифрованные (RC4) соединения
+	EncryptionRequired = "required"
+	// Шифруем исходящие, но принимаем и открытые соединения
+	EncryptionPreferred = "preferred"
+	// Только открытые соединения
+	EncryptionDisabled = "disabled"
+)
+
+// Способы проброса порта на роутере (TORRENT_PORT_FORWARDING)
+const (
+	// UPnP IGD, выполняет библиотека
+	PortForwardingUPnP = "upnp"
+	// NAT-PMP (RFC 6886), см. natpmp.go
+	PortForwardingNATPMP = "natpmp"
+)
+
+// Максимальная длина peer ID по протоколу BitTorrent
+const peerIDLength = 20
+
+// validateNetworkConfig проверяет сетевые настройки до запуска клиента
+func validateNetworkConfig(cfg *config.TorrentConfig) error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrInvalidNetworkConfig, fmt.Sprintf(format, args...))
+	}
+
+	if cfg.ListenPort < 0 || cfg.ListenPort > 65535 {
+		return invalid("listen port %d is out of range", cfg.ListenPort)
+	}
+	if !cfg.EnableIPv4 && !cfg.EnableIPv6 {
+		return invalid("both IPv4 and IPv6 are disabled")
+	}
+	if !cfg.EnableTCP && !cfg.EnableUTP {
+		return invalid("both TCP and uTP are disabled")
+	}
+	if cfg.ProxyURL != "" && !cfg.EnableTCP {
+		return invalid("proxy requires TCP, but TCP is disabled")
+	}
+
+	for _, method := range cfg.PortForwarding {
+		if method != PortForwardingUPnP && method != PortForwardingNATPMP {
+			return invalid("unknown port forwarding method %q, expected upnp or natpmp", method)
+		}
+	}
+
+	switch cfg.Encryption {
+	case EncryptionRequired, EncryptionPreferred, EncryptionDisabled:
+	default:
+		return invalid("unknown encryption policy %q, expected required, preferred or disabled", cfg.Encryption)
+	}
+
+	if cfg.MaxPeers <= 0 {
+		return invalid("max peers per torrent must be positive")
+	}
+	if cfg.HalfOpenPerTorrent <= 0 || cfg.MaxHalfOpen <= 0 {
+		return invalid("half-open connection limits must be positive")
+	}
+	if cfg.HalfOpenPerTorrent > cfg.MaxHalfOpen {
+		return invalid("half-open connections per torrent (%d) exceed the total limit (%d)", cfg.HalfOpenPerTorrent, cfg.MaxHalfOpen)
+	}
+	if cfg.HandshakeTimeout <= 0 {
+		return invalid("handshake timeout must be positive")
+	}
+
+	if len(cfg.PeerIDPrefix) > peerIDLength {
+		return invalid("peer ID prefix %q is longer than %d bytes", cfg.PeerIDPrefix, peerIDLength)
+	}
+	for _, r := range cfg.PeerIDPrefix {
+		if r < 0x21 || r > 0x7e {
+			return invalid("peer ID prefix %q must contain printable ASCII only", cfg.PeerIDPrefix)
+		}
+	}
+
+	if len(cfg.DHTBootstrapNodes) > 0 && !cfg.EnableDHT {
+		return invalid("DHT bootstrap nodes are set, but DHT is disabled")
+	}
+	for _, node := range cfg.DHTBootstrapNodes {
+		host, port, err := net.SplitHostPort(node)
+		if err != nil || host == "" {
+			return invalid("DHT bootstrap node %q must be host:port", node)
+		}
+		if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+			return invalid("DHT bootstrap node %q has invalid port", node)
+		}
+	}
+	return nil
+}
+
+// applyNetworkConfig переносит проверенные сетевые настройки в конфигурацию
+// anacrolix/torrent
+func applyNetworkConfig(clientConfig *torrent.ClientConfig, cfg *config.TorrentConfig) {
+	clientConfig.ListenPort = cfg.ListenPort
+	clientConfig.DisableIPv4 = !cfg.EnableIPv4
+	clientConfig.DisableIPv6 = !cfg.EnableIPv6
+	clientConfig.DisableTCP = !cfg.EnableTCP
+	clientConfig.DisableUTP = !cfg.EnableUTP
+	clientConfig.NoDHT = !cfg.EnableDHT
+	clientConfig.DisablePEX = !cfg.EnablePEX
+	// UPnP IGD выполняет библиотека, NAT-PMP запускается после создания клиента
+	clientConfig.NoDefaultPortForwarding = !slices.Contains(cfg.PortForwarding, PortForwardingUPnP)
+
+	clientConfig.EstablishedConnsPerTorrent = cfg.MaxPeers
+	clientConfig.HalfOpenConnsPerTorrent = cfg.HalfOpenPerTorrent
+	clientConfig.TotalHalfOpenConns = cfg.MaxHalfOpen
+	clientConfig.HandshakesTimeout = cfg.HandshakeTimeout
+
+	switch cfg.Encryption {
+	case EncryptionRequired:
+		clientConfig.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{Preferred: true, RequirePreferred: true}
+		clientConfig.CryptoProvides = mse.CryptoMethodRC4
+		// Входящим соединениям без RC4 отвечаем неподдерживаемым методом - рукопожатие
+		// прерывается
+		clientConfig.CryptoSelector = func(provided mse.CryptoMethod) mse.CryptoMethod {
+			return provided & mse.CryptoMethodRC4
+		}
+	case EncryptionPreferred:
+		clientConfig.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{Preferred: true}
+	case EncryptionDisabled:
+		clientConfig.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{Preferred: false, RequirePreferred: true}
+	}
+
+	if cfg.PeerIDPrefix != "" {
+		clientConfig.Bep20 = cfg.PeerIDPrefix
+	}
+
+	if len(cfg.DHTBootstrapNodes) > 0 {
+		nodes := cfg.DHTBootstrapNodes
+		clientConfig.DhtStartingNodes = func(string) dht.StartingNodesGetter {
+			return func() ([]dht.Addr, error) { return dht.ResolveHostPorts(nodes) }
+		}
+	}
+}
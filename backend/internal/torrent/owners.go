@@ -0,0 +1,67 @@
+package torrent
+
+import (
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// torrentOwners - загрузки, которые используют один торрент клиента. Клиент хранит
+// торрент в единственном экземпляре на info hash, поэтому одну игру, добавленную
+// несколькими пользователями, они скачивают и раздают вместе.
+type torrentOwners struct {
+	ids map[string]struct{}
+	// Параметры первого владельца: данные торрента лежат там, куда их положил он
+	opts AddOptions
+}
+
+// addOwner регистрирует владельца торрента. Вызывается с захваченным c.mu.
+func (c *Client) addOwner(ih metainfo.Hash, opts AddOptions) {
+	owners, ok := c.owners[ih]
+	if !ok {
+		owners = &torrentOwners{ids: make(map[string]struct{}), opts: opts}
+		c.owners[ih] = owners
+	}
+	owners.ids[opts.Owner] = struct{}{}
+}
+
+// sharedOptions возвращает параметры задачи с расположением данных общего торрента.
+// Вызывается с захваченным c.mu.
+func (c *Client) sharedOptions(ih metainfo.Hash, opts AddOptions) AddOptions {
+	if owners, ok := c.owners[ih]; ok {
+		opts.DownloadDir = owners.opts.DownloadDir
+		opts.Storage = owners.opts.Storage
+		opts.ContentPath = owners.opts.ContentPath
+	}
+	return opts
+}
+
+// releaseOwner снимает владельца с торрента и сообщает, был ли он последним - тогда
+// торрент нужно удалить из клиента. Вызывается с захваченным c.mu.
+func (c *Client) releaseOwner(ih metainfo.Hash, owner string) bool {
+	owners, ok := c.owners[ih]
+	if !ok {
+		// Торрент добавлен без учета владельцев
+		return true
+	}
+	if _, ok := owners.ids[owner]; !ok {
+		// Владелец уже отпустил торрент, его держат другие
+		return false
+	}
+	delete(owners.ids, owner)
+	if len(owners.ids) > 0 {
+		return false
+	}
+	delete(c.owners, ih)
+	return true
+}
+
+// othersPaused сообщает, что все остальные задачи торрента стоят на паузе (или их нет).
+// Вызывается с захваченным c.mu.
+func (c *Client) othersPaused(t *torrent.Torrent, except *DownloadJob) bool {
+	for _, job := range c.downloads {
+		if job != except && job.Torrent == t && job.ctx.Err() == nil && !job.isPaused() {
+			return false
+		}
+	}
+	return true
+}
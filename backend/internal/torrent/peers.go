@@ -0,0 +1,312 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/iplist"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// ErrInvalidPeerIP - некорректный IP-адрес пира
+var ErrInvalidPeerIP = errors.New("invalid peer IP")
+
+// PeerInfo описывает подключенного пира
+type PeerInfo struct {
+	Address      string  `json:"address"`
+	IP           string  `json:"ip"`
+	Client       string  `json:"client"`
+	Source       string  `json:"source"` // tracker, dht, pex, incoming...
+	Encrypted    bool    `json:"encrypted"`
+	UTP          bool    `json:"utp"`
+	Incoming     bool    `json:"incoming"`
+	DownloadRate float64 `json:"download_rate"` // bytes/s
+	UploadRate   float64 `json:"upload_rate"`   // bytes/s
+	Downloaded   int64   `json:"downloaded"`
+	Uploaded     int64   `json:"uploaded"`
+	Progress     float64 `json:"progress"` // доля частей торрента, которые есть у пира
+}
+
+// peerFilter - список заблокированных IP. Глобальные баны и блоклисты передаются в
+// anacrolix/torrent как IPBlocklist и проверяются для входящих и исходящих соединений,
+// баны для отдельного торрента проверяются после рукопожатия.
+type peerFilter struct {
+	mu        sync.RWMutex
+	global    map[netip.Addr]struct{}
+	torrent   map[metainfo.Hash]map[netip.Addr]struct{}
+	blocklist *blocklist
+	// Счетчики отклоненных блоклистом пиров
+	stats *blocklistState
+}
+
+func newPeerFilter() *peerFilter {
+	return &peerFilter{
+		global:  make(map[netip.Addr]struct{}),
+		torrent: make(map[metainfo.Hash]map[netip.Addr]struct{}),
+	}
+}
+
+// Lookup реализует iplist.Ranger
+func (f *peerFilter) Lookup(ip net.IP) (iplist.Range, bool) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return iplist.Range{}, false
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if _, banned := f.global[addr.Unmap()]; banned {
+		return iplist.Range{First: ip, Last: ip, Description: "banned"}, true
+	}
+	if f.blocklist != nil {
+		if r, blocked := f.blocklist.lookup(ip); blocked {
+			if f.stats != nil {
+				f.stats.recordBlocked(ip)
+			}
+			return r, true
+		}
+	}
+	return iplist.Range{}, false
+}
+
+// blocks сообщает, запрещен ли адрес глобальным баном или блоклистом. В отличие от Lookup
+// не попадает в статистику отклоненных пиров - используется для адресов трекеров.
+func (f *peerFilter) blocks(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if _, banned := f.global[addr.Unmap()]; banned {
+		return true
+	}
+	if f.blocklist != nil {
+		_, blocked := f.blocklist.lookup(ip)
+		return blocked
+	}
+	return false
+}
+
+// NumRanges реализует iplist.Ranger
+func (f *peerFilter) NumRanges() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.global) + f.blocklist.numRanges()
+}
+
+func (f *peerFilter) setBlocklist(b *blocklist) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.blocklist = b
+}
+
+func (f *peerFilter) blocklistRanges() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.blocklist.numRanges()
+}
+
+func (f *peerFilter) bannedFor(ih metainfo.Hash, addr netip.Addr) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if _, banned := f.global[addr]; banned {
+		return true
+	}
+	_, banned := f.torrent[ih][addr]
+	return banned
+}
+
+// peerIP возвращает IP-адрес пира без порта
+func peerIP(pc *torrent.PeerConn) (netip.Addr, bool) {
+	if pc.RemoteAddr == nil {
+		return netip.Addr{}, false
+	}
+	addrPort, err := netip.ParseAddrPort(pc.RemoteAddr.String())
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addrPort.Addr().Unmap(), true
+}
+
+// NormalizePeerIP проверяет IP пира и приводит его к каноническому виду
+func NormalizePeerIP(ip string) (string, error) {
+	addr, err := parsePeerIP(ip)
+	if err != nil {
+		return "", err
+	}
+	return addr.String(), nil
+}
+
+func parsePeerIP(ip string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("%w: %s", ErrInvalidPeerIP, ip)
+	}
+	return addr.Unmap(), nil
+}
+
+// onPeerConnAdded разрывает соединения с пирами, забаненными для торрента.
+// Вызывается библиотекой под ее блокировкой, поэтому соединение закрываем асинхронно.
+func (c *Client) onPeerConnAdded(pc *torrent.PeerConn) {
+	addr, ok := peerIP(pc)
+	if !ok || pc.Torrent() == nil {
+		return
+	}
+	if c.peerFilter.bannedFor(pc.Torrent().InfoHash(), addr) {
+		go pc.Close()
+	}
+}
+
+// BanPeer блокирует IP пира. Если infoHash пустой - для всех торрентов, иначе только
+// для указанного. Текущие соединения с этим IP разрываются.
+func (c *Client) BanPeer(ip, infoHash string) error {
+	addr, err := parsePeerIP(ip)
+	if err != nil {
+		return err
+	}
+
+	var ih metainfo.Hash
+	if infoHash != "" {
+		if err := ih.FromHexString(infoHash); err != nil {
+			return fmt.Errorf("%w: %s", ErrTorrentNotFound, infoHash)
+		}
+	}
+
+	c.peerFilter.mu.Lock()
+	if infoHash == "" {
+		c.peerFilter.global[addr] = struct{}{}
+	} else {
+		if c.peerFilter.torrent[ih] == nil {
+			c.peerFilter.torrent[ih] = make(map[netip.Addr]struct{})
+		}
+		c.peerFilter.torrent[ih][addr] = struct{}{}
+	}
+	c.peerFilter.mu.Unlock()
+
+	for _, t := range c.client.Torrents() {
+		if infoHash != "" && t.InfoHash() != ih {
+			continue
+		}
+		for _, pc := range t.PeerConns() {
+			if peerAddr, ok := peerIP(pc); ok && peerAddr == addr {
+				pc.Close()
+			}
+		}
+	}
+	return nil
+}
+
+// UnbanPeer снимает блокировку IP (глобальную при пустом infoHash)
+func (c *Client) UnbanPeer(ip, infoHash string) error {
+	addr, err := parsePeerIP(ip)
+	if err != nil {
+		return err
+	}
+
+	c.peerFilter.mu.Lock()
+	defer c.peerFilter.mu.Unlock()
+	if infoHash == "" {
+		delete(c.peerFilter.global, addr)
+		return nil
+	}
+
+	var ih metainfo.Hash
+	if err := ih.FromHexString(infoHash); err != nil {
+		return fmt.Errorf("%w: %s", ErrTorrentNotFound, infoHash)
+	}
+	delete(c.peerFilter.torrent[ih], addr)
+	if len(c.peerFilter.torrent[ih]) == 0 {
+		delete(c.peerFilter.torrent, ih)
+	}
+	return nil
+}
+
+// connFlags - флаги соединения из PeerConn.String(): источник, U (uTP), E/e (шифрование).
+// Библиотека не отдает их иначе.
+var connFlags = regexp.MustCompile(`flags=([^ \]]*)`)
+
+var peerSources = map[torrent.PeerSource]string{
+	torrent.PeerSourceTracker:         "tracker",
+	torrent.PeerSourceIncoming:        "incoming",
+	torrent.PeerSourceDhtGetPeers:     "dht",
+	torrent.PeerSourceDhtAnnouncePeer: "dht",
+	torrent.PeerSourcePex:             "pex",
+	torrent.PeerSourceDirect:          "direct",
+	torrent.PeerSourceUtHolepunch:     "holepunch",
+}
+
+// Peers возвращает подключенных пиров торрента
+func (c *Client) Peers(infoHash string) ([]PeerInfo, error) {
+	var ih metainfo.Hash
+	if err := ih.FromHexString(infoHash); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrTorrentNotFound, infoHash)
+	}
+	t, ok := c.client.Torrent(ih)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTorrentNotFound, infoHash)
+	}
+
+	numPieces := 0
+	if t.Info() != nil {
+		numPieces = t.NumPieces()
+	}
+
+	conns := t.PeerConns()
+	peers := make([]PeerInfo, 0, len(conns))
+	for _, pc := range conns {
+		stats := pc.Stats()
+
+		info := PeerInfo{
+			Client:       peerClientName(pc),
+			Source:       peerSources[pc.Discovery],
+			UTP:          strings.HasPrefix(pc.Network, "udp"),
+			Incoming:     pc.Discovery == torrent.PeerSourceIncoming,
+			DownloadRate: stats.DownloadRate,
+			UploadRate:   stats.LastWriteUploadRate,
+			Downloaded:   stats.BytesReadUsefulData.Int64(),
+			Uploaded:     stats.BytesWrittenData.Int64(),
+		}
+		if pc.RemoteAddr != nil {
+			info.Address = pc.RemoteAddr.String()
+		}
+		if addr, ok := peerIP(pc); ok {
+			info.IP = addr.String()
+		}
+		if m := connFlags.FindStringSubmatch(pc.String()); m != nil {
+			for _, flag := range strings.Split(m[1], ",") {
+				if flag == "E" || flag == "e" {
+					info.Encrypted = true
+				}
+			}
+		}
+		if numPieces > 0 {
+			info.Progress = float64(stats.RemotePieceCount) / float64(numPieces)
+			if info.Progress > 1 {
+				info.Progress = 1
+			}
+		}
+		peers = append(peers, info)
+	}
+	return peers, nil
+}
+
+// peerClientName возвращает название клиента из расширенного рукопожатия,
+// а если его нет - префикс peer ID в стиле Azureus (например, "qB4250")
+func peerClientName(pc *torrent.PeerConn) string {
+	if name, ok := pc.PeerClientName.Load().(string); ok && name != "" {
+		return name
+	}
+	id := pc.PeerID
+	if id[0] == '-' && id[7] == '-' {
+		return string(id[1:7])
+	}
+	return ""
+}
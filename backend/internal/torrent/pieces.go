@@ -0,0 +1,143 @@
+package torrent
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// PieceMap - компактная карта частей торрента для отрисовки полосы частей.
+//
+// Completed - битовое поле в формате BitTorrent, закодированное в base64: старший бит
+// первого байта соответствует части 0. Availability - число пиров, у которых есть часть,
+// в виде серий [значение, длина]: [[0, 10], [3, 5]] означает, что у частей 0-9 нет
+// источников, а части 10-14 есть у трех пиров.
+type PieceMap struct {
+	InfoHash       string   `json:"info_hash"`
+	NumPieces      int      `json:"num_pieces"`
+	PieceLength    int64    `json:"piece_length"`
+	CompletedCount int      `json:"completed_count"`
+	Completed      string   `json:"completed"`
+	Availability   [][2]int `json:"availability"`
+}
+
+// PieceMapDiff - изменения карты частей с предыдущего снимка
+type PieceMapDiff struct {
+	InfoHash string `json:"info_hash"`
+	// Части, скачанные с предыдущего снимка
+	Completed []int `json:"completed,omitempty"`
+	// Изменившаяся доступность: пары [часть, число пиров]
+	Availability [][2]int `json:"availability,omitempty"`
+}
+
+// PieceSnapshot - состояние частей торрента на момент снимка
+type PieceSnapshot struct {
+	infoHash     string
+	pieceLength  int64
+	completed    []bool
+	availability []int
+}
+
+// PieceSnapshot возвращает состояние частей торрента. Пока метаданные не получены,
+// снимок пустой.
+func (c *Client) PieceSnapshot(infoHash string) (*PieceSnapshot, error) {
+	var ih metainfo.Hash
+	if err := ih.FromHexString(infoHash); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrTorrentNotFound, infoHash)
+	}
+	t, ok := c.client.Torrent(ih)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTorrentNotFound, infoHash)
+	}
+
+	snapshot := &PieceSnapshot{infoHash: infoHash}
+	info := t.Info()
+	if info == nil {
+		return snapshot, nil
+	}
+
+	numPieces := t.NumPieces()
+	snapshot.pieceLength = info.PieceLength
+	snapshot.completed = make([]bool, numPieces)
+	snapshot.availability = make([]int, numPieces)
+
+	i := 0
+	for _, run := range t.PieceStateRuns() {
+		for j := 0; j < run.Length && i < numPieces; j++ {
+			snapshot.completed[i] = run.Complete
+			i++
+		}
+	}
+
+	// Библиотека не отдает доступность частей - считаем по битовым полям пиров
+	for _, pc := range t.PeerConns() {
+		it := pc.PeerPieces().Iterator()
+		for it.HasNext() {
+			piece := int(it.Next())
+			if piece >= numPieces {
+				break
+			}
+			snapshot.availability[piece]++
+		}
+	}
+	return snapshot, nil
+}
+
+// Empty сообщает, что метаданные торрента еще не получены
+func (s *PieceSnapshot) Empty() bool {
+	return len(s.completed) == 0
+}
+
+// Map кодирует снимок в компактную карту частей
+func (s *PieceSnapshot) Map() *PieceMap {
+	pieceMap := &PieceMap{
+		InfoHash:     s.infoHash,
+		NumPieces:    len(s.completed),
+		PieceLength:  s.pieceLength,
+		Availability: [][2]int{},
+	}
+
+	bitfield := make([]byte, (len(s.completed)+7)/8)
+	for i, done := range s.completed {
+		if done {
+			bitfield[i/8] |= 0x80 >> (i % 8)
+			pieceMap.CompletedCount++
+		}
+	}
+	pieceMap.Completed = base64.StdEncoding.EncodeToString(bitfield)
+
+	for i, value := range s.availability {
+		last := len(pieceMap.Availability) - 1
+		if i > 0 && pieceMap.Availability[last][0] == value {
+			pieceMap.Availability[last][1]++
+		} else {
+			pieceMap.Availability = append(pieceMap.Availability, [2]int{value, 1})
+		}
+	}
+	return pieceMap
+}
+
+// Diff возвращает изменения относительно предыдущего снимка. Если снимки
+// несопоставимы (например, у prev еще не было метаданных), ok = false.
+func (s *PieceSnapshot) Diff(prev *PieceSnapshot) (diff PieceMapDiff, ok bool) {
+	if prev == nil || len(prev.completed) != len(s.completed) {
+		return PieceMapDiff{}, false
+	}
+
+	diff.InfoHash = s.infoHash
+	for i := range s.completed {
+		if s.completed[i] && !prev.completed[i] {
+			diff.Completed = append(diff.Completed, i)
+		}
+		if s.availability[i] != prev.availability[i] {
+			diff.Availability = append(diff.Availability, [2]int{i, s.availability[i]})
+		}
+	}
+	return diff, true
+}
+
+// Size - число изменений в diff
+func (d PieceMapDiff) Size() int {
+	return len(d.Completed) + len(d.Availability)
+}
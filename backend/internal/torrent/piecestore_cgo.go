@@ -0,0 +1,17 @@
+//go:build cgo
+
+package torrent
+
+import (
+	"github.com/anacrolix/torrent/storage"
+	sqliteStorage "github.com/anacrolix/torrent/storage/sqlite"
+)
+
+// newPieceStorage открывает хранилище частей в базе sqlite path. Емкость не ограничена:
+// это данные игры, а не кэш, и вытеснять их нельзя.
+func newPieceStorage(path string) (storage.ClientImplCloser, error) {
+	var opts sqliteStorage.NewDirectStorageOpts
+	opts.Path = path
+	opts.Capacity = -1
+	return sqliteStorage.NewDirectStorage(opts)
+}
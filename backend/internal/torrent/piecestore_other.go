@@ -0,0 +1,14 @@
+//go:build !cgo
+
+package torrent
+
+import (
+	"errors"
+
+	"github.com/anacrolix/torrent/storage"
+)
+
+// newPieceStorage недоступен без cgo: хранилище частей anacrolix работает через sqlite на cgo
+func newPieceStorage(path string) (storage.ClientImplCloser, error) {
+	return nil, errors.New("piece storage requires a build with cgo enabled")
+}
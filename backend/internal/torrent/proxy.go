@@ -0,0 +1,215 @@
+package torrent
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+var (
+	// ErrInvalidProxy - некорректный адрес прокси в конфигурации
+	ErrInvalidProxy = errors.New("invalid proxy URL")
+	// errProxyDown - не удалось подключиться к самому прокси-серверу
+	errProxyDown = errors.New("proxy is unreachable")
+	// errProxyOnly - трафик в обход прокси запрещен (режим fail closed)
+	errProxyOnly = errors.New("traffic outside of proxy is disabled")
+)
+
+// proxyDialer устанавливает TCP-соединения через SOCKS5 или HTTP CONNECT прокси.
+// В режиме fail closed при недоступном прокси соединения не устанавливаются вовсе,
+// иначе - устанавливаются напрямую.
+type proxyDialer struct {
+	proxy      proxy.ContextDialer
+	direct     *net.Dialer
+	failClosed bool
+	// Адрес прокси без пароля - для логов
+	display string
+}
+
+// newProxyDialer разбирает адрес прокси: socks5://[user:pass@]host:port или
+// http://[user:pass@]host:port
+func newProxyDialer(rawURL string, failClosed bool) (*proxyDialer, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidProxy, rawURL)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("%w: port is required: %s", ErrInvalidProxy, u.Redacted())
+	}
+
+	d := &proxyDialer{
+		direct:     &net.Dialer{Timeout: 30 * time.Second},
+		failClosed: failClosed,
+		display:    u.Redacted(),
+	}
+	forward := forwardDialer{d.direct}
+
+	switch strings.ToLower(u.Scheme) {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if u.User != nil {
+			password, _ := u.User.Password()
+			auth = &proxy.Auth{User: u.User.Username(), Password: password}
+		}
+		socks, err := proxy.SOCKS5("tcp", u.Host, auth, forward)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProxy, err)
+		}
+		d.proxy = socks.(proxy.ContextDialer)
+	case "http":
+		connect := &httpConnectDialer{address: u.Host, forward: forward}
+		if u.User != nil {
+			password, _ := u.User.Password()
+			connect.auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(u.User.Username()+":"+password))
+		}
+		d.proxy = connect
+	default:
+		return nil, fmt.Errorf("%w: unsupported scheme %q, expected socks5 or http", ErrInvalidProxy, u.Scheme)
+	}
+	return d, nil
+}
+
+// DialContext реализует dialer.WithContext и подходит для трекеров и HTTP-клиентов
+func (d *proxyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if !strings.HasPrefix(network, "tcp") {
+		return nil, fmt.Errorf("%w: %s", errProxyOnly, network)
+	}
+
+	conn, err := d.proxy.DialContext(ctx, "tcp", addr)
+	if err == nil || d.failClosed || !errors.Is(err, errProxyDown) || ctx.Err() != nil {
+		return conn, err
+	}
+	log.Printf("Proxy %s is unreachable, connecting to %s directly: %v", d.display, addr, err)
+	return d.direct.DialContext(ctx, network, addr)
+}
+
+// listenPacket используется для UDP-трекеров в режиме fail closed: UDP через прокси
+// не передается, поэтому такие анонсы запрещены
+func (d *proxyDialer) listenPacket(network, addr string) (net.PacketConn, error) {
+	return nil, fmt.Errorf("%w: %s", errProxyOnly, network)
+}
+
+// forwardDialer подключается к прокси-серверу и помечает ошибки подключения как
+// errProxyDown, чтобы отличать их от ошибок соединения с конечным адресом
+type forwardDialer struct {
+	d *net.Dialer
+}
+
+func (f forwardDialer) Dial(network, addr string) (net.Conn, error) {
+	return f.DialContext(context.Background(), network, addr)
+}
+
+func (f forwardDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := f.d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errProxyDown, err)
+	}
+	return conn, nil
+}
+
+// httpConnectDialer открывает туннель через HTTP-прокси методом CONNECT
+type httpConnectDialer struct {
+	address string
+	auth    string // значение Proxy-Authorization
+	forward forwardDialer
+}
+
+func (d *httpConnectDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.forward.DialContext(ctx, "tcp", d.address)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(30 * time.Second))
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if d.auth != "" {
+		req.Header.Set("Proxy-Authorization", d.auth)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT to %s failed: %w", addr, err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT to %s failed: %w", addr, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT to %s failed: %s", addr, resp.Status)
+	}
+
+	conn.SetDeadline(time.Time{})
+	if br.Buffered() > 0 {
+		// Прокси мог прислать данные сразу за ответом
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// applyProxy направляет трафик клиента через прокси: исходящие соединения с пирами,
+// HTTP-трекеры, веб-сиды и загрузку .torrent файлов. Входящие соединения, uTP, DHT и
+// UDP-трекеры через прокси не проходят, поэтому в режиме fail closed они отключаются.
+func (c *Client) applyProxy(proxyURL string, failClosed bool) error {
+	d, err := newProxyDialer(proxyURL, failClosed)
+	if err != nil {
+		return err
+	}
+	c.proxy = d
+
+	clientConfig := c.clientConfig
+	// Прямые исходящие соединения через сокеты клиента заменяются dialer'ом прокси
+	clientConfig.DialForPeerConns = false
+	clientConfig.HTTPProxy = func(*http.Request) (*url.URL, error) { return nil, nil }
+	clientConfig.HTTPDialContext = d.DialContext
+	clientConfig.TrackerDialContext = d.DialContext
+	clientConfig.WebTransport = &http.Transport{DialContext: d.DialContext}
+
+	if failClosed {
+		clientConfig.AcceptPeerConnections = false
+		clientConfig.NoDHT = true
+		clientConfig.TrackerListenPacket = d.listenPacket
+	}
+
+	c.httpClient = &http.Client{Transport: &http.Transport{DialContext: d.DialContext}}
+	log.Printf("Torrent traffic goes through proxy %s (fail closed: %t)", d.display, failClosed)
+	return nil
+}
+
+// HTTPClient возвращает HTTP-клиент для исходящих запросов; при настроенном прокси
+// запросы идут через него
+func (c *Client) HTTPClient() *http.Client {
+	return c.httpClient
+}
@@ -0,0 +1,131 @@
+package torrent
+
+import (
+	"math"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const (
+	// Как часто снимать счетчики переданных байт
+	rateSampleInterval = time.Second
+	// Постоянная времени экспоненциального сглаживания скоростей: скорость реагирует на
+	// изменения примерно за это время и не скачет от секунды к секунде
+	rateSmoothing = 10 * time.Second
+)
+
+// TransferStats - объем и скорость передачи данных торрента. Объемы считаются с момента
+// добавления торрента в клиент, то есть за текущую сессию.
+type TransferStats struct {
+	Downloaded   int64   `json:"downloaded"`
+	Uploaded     int64   `json:"uploaded"`
+	DownloadRate float64 `json:"download_rate"` // bytes/s, сглаженная
+	UploadRate   float64 `json:"upload_rate"`   // bytes/s, сглаженная
+}
+
+// rateMeter сглаживает скорость торрента экспоненциальным скользящим средним.
+// Скорость скачивания с веб-сидов считается отдельно и входит в общую.
+type rateMeter struct {
+	read, written, webSeedRead int64
+	sampledAt                  time.Time
+	down, up, webSeed          float64
+}
+
+func (r *rateMeter) sample(read, written, webSeedRead int64, now time.Time) {
+	if r.sampledAt.IsZero() || read < r.read || written < r.written || webSeedRead < r.webSeedRead {
+		// Первый замер или торрент добавлен заново - начинаем с текущих счетчиков
+		r.read, r.written, r.webSeedRead, r.sampledAt = read, written, webSeedRead, now
+		return
+	}
+
+	dt := now.Sub(r.sampledAt).Seconds()
+	if dt <= 0 {
+		return
+	}
+	alpha := 1 - math.Exp(-dt/rateSmoothing.Seconds())
+	r.down += alpha * (float64(read-r.read)/dt - r.down)
+	r.up += alpha * (float64(written-r.written)/dt - r.up)
+	r.webSeed += alpha * (float64(webSeedRead-r.webSeedRead)/dt - r.webSeed)
+	r.read, r.written, r.webSeedRead, r.sampledAt = read, written, webSeedRead, now
+}
+
+// sampleRates периодически обновляет сглаженные скорости всех торрентов клиента
+func (c *Client) sampleRates() {
+	ticker := time.NewTicker(rateSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			torrents := c.client.Torrents()
+			seen := make(map[metainfo.Hash]bool, len(torrents))
+
+			c.ratesMu.Lock()
+			for _, t := range torrents {
+				ih := t.InfoHash()
+				seen[ih] = true
+				meter, ok := c.rates[ih]
+				if !ok {
+					meter = &rateMeter{}
+					c.rates[ih] = meter
+				}
+				stats := t.Stats()
+				meter.sample(stats.BytesReadData.Int64(), stats.BytesWrittenData.Int64(), stats.WebSeeds.BytesReadData.Int64(), now)
+			}
+			for ih := range c.rates {
+				if !seen[ih] {
+					delete(c.rates, ih)
+				}
+			}
+			c.ratesMu.Unlock()
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+// rate возвращает сглаженные скорости скачивания и отдачи торрента
+func (c *Client) rate(ih metainfo.Hash) (down, up float64) {
+	c.ratesMu.Lock()
+	defer c.ratesMu.Unlock()
+	if meter, ok := c.rates[ih]; ok {
+		return meter.down, meter.up
+	}
+	return 0, 0
+}
+
+// webSeedRate возвращает сглаженную скорость скачивания торрента с веб-сидов
+func (c *Client) webSeedRate(ih metainfo.Hash) float64 {
+	c.ratesMu.Lock()
+	defer c.ratesMu.Unlock()
+	if meter, ok := c.rates[ih]; ok {
+		return meter.webSeed
+	}
+	return 0
+}
+
+// TransferStats возвращает объемы и скорости передачи всех торрентов клиента по info hash
+func (c *Client) TransferStats() map[string]TransferStats {
+	torrents := c.client.Torrents()
+	result := make(map[string]TransferStats, len(torrents))
+	for _, t := range torrents {
+		stats := t.Stats()
+		down, up := c.rate(t.InfoHash())
+		result[t.InfoHash().HexString()] = TransferStats{
+			Downloaded:   stats.BytesReadData.Int64(),
+			Uploaded:     stats.BytesWrittenData.Int64(),
+			DownloadRate: down,
+			UploadRate:   up,
+		}
+	}
+	return result
+}
+
+// etaSeconds оценивает оставшееся время по сглаженной скорости; 0 - неизвестно
+func etaSeconds(remaining int64, rate float64) int64 {
+	if remaining <= 0 || rate < 1 {
+		return 0
+	}
+	return int64(math.Ceil(float64(remaining) / rate))
+}
@@ -0,0 +1,177 @@
+package torrent
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/dht/v2/krpc"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Состояние клиента, которое переживает перезапуск, хранится в StateDir:
+//   - piece completion база (какие части уже скачаны и проверены);
+//   - metainfo/<infohash>.torrent - метаданные каждой загрузки, включая полученные по magnet;
+//   - dht-nodes.dat - таблица маршрутизации DHT для быстрого старта.
+const (
+	metainfoCacheDir = "metainfo"
+	dhtNodesFile     = "dht-nodes.dat"
+
+	dhtSaveInterval = 5 * time.Minute
+)
+
+// stateDir возвращает директорию для состояния клиента
+func (c *Client) stateDir() string {
+	if c.config.StateDir != "" {
+		return c.config.StateDir
+	}
+	return filepath.Join(c.config.DownloadDir, ".gamecloud")
+}
+
+func (c *Client) metainfoPath(infoHash string) string {
+	return filepath.Join(c.stateDir(), metainfoCacheDir, strings.ToLower(infoHash)+".torrent")
+}
+
+// saveMetainfo сохраняет метаданные торрента в кэш, если их там еще нет
+func (c *Client) saveMetainfo(t *torrent.Torrent) {
+	if _, err := os.Stat(c.metainfoPath(t.InfoHash().HexString())); err == nil {
+		return
+	}
+	c.writeMetainfo(t)
+}
+
+// updateMetainfo перезаписывает кэш после изменения торрента (например, списка трекеров)
+func (c *Client) updateMetainfo(t *torrent.Torrent) {
+	if t.Info() == nil {
+		return
+	}
+	c.writeMetainfo(t)
+}
+
+func (c *Client) writeMetainfo(t *torrent.Torrent) {
+	path := c.metainfoPath(t.InfoHash().HexString())
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Printf("Failed to create metainfo cache directory: %v", err)
+		return
+	}
+
+	mi := c.fullMetainfo(t)
+	var buf bytes.Buffer
+	if err := mi.Write(&buf); err != nil {
+		log.Printf("Failed to encode metainfo for %s: %v", t.Name(), err)
+		return
+	}
+
+	// Пишем через временный файл, чтобы не оставить обрезанный кэш при сбое
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, buf.Bytes(), 0644); err != nil {
+		log.Printf("Failed to save metainfo for %s: %v", t.Name(), err)
+		return
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		log.Printf("Failed to save metainfo for %s: %v", t.Name(), err)
+	}
+}
+
+// LoadCachedMetainfo читает сохраненные метаданные торрента по info hash
+func (c *Client) LoadCachedMetainfo(infoHash string) (*metainfo.MetaInfo, error) {
+	return metainfo.LoadFromFile(c.metainfoPath(infoHash))
+}
+
+// HasCachedMetainfo сообщает, сохранены ли метаданные торрента
+func (c *Client) HasCachedMetainfo(infoHash string) bool {
+	if infoHash == "" {
+		return false
+	}
+	_, err := os.Stat(c.metainfoPath(infoHash))
+	return err == nil
+}
+
+// forgetMetainfo удаляет метаданные торрента из кэша
+func (c *Client) forgetMetainfo(infoHash string) {
+	if err := os.Remove(c.metainfoPath(infoHash)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove cached metainfo %s: %v", infoHash, err)
+	}
+}
+
+// AddCachedTorrent запускает загрузку из сохраненных метаданных - без повторного
+// получения метаданных и без перепроверки уже скачанных частей
+func (c *Client) AddCachedTorrent(infoHash string, opts AddOptions) (string, chan ProgressUpdate, error) {
+	metaInfo, err := c.LoadCachedMetainfo(infoHash)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to load cached metainfo: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t, err := c.addMetainfo(metaInfo, opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	downloadID, progress := c.startJob(t, opts)
+	return downloadID, progress, nil
+}
+
+// loadDHTNodes добавляет в DHT узлы, сохраненные при прошлом запуске
+func (c *Client) loadDHTNodes() {
+	path := filepath.Join(c.stateDir(), dhtNodesFile)
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+
+	for _, s := range c.client.DhtServers() {
+		if wrapper, ok := s.(torrent.AnacrolixDhtServerWrapper); ok {
+			added, err := wrapper.Server.AddNodesFromFile(path)
+			if err != nil {
+				log.Printf("Failed to load DHT nodes: %v", err)
+				continue
+			}
+			log.Printf("Loaded %d DHT nodes from previous session", added)
+		}
+	}
+}
+
+// saveDHTNodes сохраняет текущую таблицу маршрутизации DHT
+func (c *Client) saveDHTNodes() {
+	var nodes []krpc.NodeInfo
+	for _, s := range c.client.DhtServers() {
+		if wrapper, ok := s.(torrent.AnacrolixDhtServerWrapper); ok {
+			nodes = append(nodes, wrapper.Server.Nodes()...)
+		}
+	}
+	if len(nodes) == 0 {
+		return
+	}
+
+	if err := os.MkdirAll(c.stateDir(), 0755); err != nil {
+		log.Printf("Failed to create state directory: %v", err)
+		return
+	}
+	if err := dht.WriteNodesToFile(nodes, filepath.Join(c.stateDir(), dhtNodesFile)); err != nil {
+		log.Printf("Failed to save DHT nodes: %v", err)
+	}
+}
+
+// persistState периодически сохраняет таблицу DHT, пока клиент не закрыт
+func (c *Client) persistState() {
+	ticker := time.NewTicker(dhtSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.saveDHTNodes()
+		case <-c.stopCh:
+			return
+		}
+	}
+}
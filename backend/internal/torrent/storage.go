@@ -0,0 +1,150 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/anacrolix/torrent/storage"
+)
+
+// Поддерживаемые бэкенды хранения данных торрентов
+const (
+	// StorageFile - обычные файлы, запись через файловую систему
+	StorageFile = "file"
+	// StorageMMap - файлы, отображенные в память; быстрее на локальных дисках, но
+	// требует адресного пространства под весь торрент
+	StorageMMap = "mmap"
+	// StoragePiece - части хранятся в базе sqlite (.pieces.db) вместе с их состоянием;
+	// файлы игры в DownloadDir не собираются, данные доступны только через торрент-клиент
+	StoragePiece = "piece"
+)
+
+// ErrUnknownStorage - запрошен неизвестный бэкенд хранения
+var ErrUnknownStorage = errors.New("unknown storage backend")
+
+// ValidStorage сообщает, поддерживается ли бэкенд хранения. Пустое имя означает бэкенд по умолчанию.
+func ValidStorage(name string) bool {
+	switch name {
+	case "", StorageFile, StorageMMap, StoragePiece:
+		return true
+	}
+	return false
+}
+
+// sharedCompletion передается всем бэкендам, чтобы при их закрытии не закрылась общая
+// база piece completion - ее закрывает сам клиент
+type sharedCompletion struct {
+	storage.PieceCompletion
+}
+
+func (sharedCompletion) Close() error {
+	return nil
+}
+
+// defaultStorageName возвращает бэкенд хранения из конфигурации
+func (c *Client) defaultStorageName() string {
+	if c.config.Storage != "" {
+		return c.config.Storage
+	}
+	return StorageFile
+}
+
+// newStorage создает бэкенд хранения с данными в директории dir
+func (c *Client) newStorage(name, dir string) (storage.ClientImplCloser, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	completion := sharedCompletion{c.completion}
+
+	switch name {
+	case StorageFile:
+		return storage.NewFileOpts(storage.NewFileClientOpts{
+			ClientBaseDir:   dir,
+			PieceCompletion: completion,
+		}), nil
+	case StorageMMap:
+		return storage.NewMMapWithCompletion(dir, completion), nil
+	case StoragePiece:
+		// Состояние частей хранится в той же базе, что и данные: общая база piece
+		// completion этому бэкенду не нужна
+		impl, err := newPieceStorage(filepath.Join(dir, ".pieces.db"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open piece storage: %w", err)
+		}
+		return impl, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownStorage, name)
+}
+
+// storageFor возвращает бэкенд для отдельной загрузки; один бэкенд на пару (тип, директория)
+// переиспользуется всеми торрентами. Вызывается с захваченным c.mu.
+func (c *Client) storageFor(name, dir string) (storage.ClientImpl, error) {
+	if name == "" {
+		name = c.defaultStorageName()
+	}
+	if dir == "" {
+		dir = c.config.DownloadDir
+	}
+
+	if name == c.defaultStorageName() && dir == c.config.DownloadDir {
+		return c.storage, nil
+	}
+
+	key := name + "|" + dir
+	if impl, ok := c.storages[key]; ok {
+		return impl, nil
+	}
+
+	impl, err := c.newStorage(name, dir)
+	if err != nil {
+		return nil, err
+	}
+	c.storages[key] = impl
+	return impl, nil
+}
+
+// rootedStorage возвращает файловое хранилище, в котором данные торрента лежат прямо в
+// root (root - каталог многофайлового торрента или сам файл однофайлового), без
+// подкаталога с именем торрента. Так используются уже существующие каталоги игр.
+// Вызывается с захваченным c.mu.
+func (c *Client) rootedStorage(root string) (storage.ClientImpl, error) {
+	key := "root|" + root
+	if impl, ok := c.storages[key]; ok {
+		return impl, nil
+	}
+
+	impl := storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir: root,
+		FilePathMaker: func(opts storage.FilePathMakerOpts) string {
+			return filepath.Join(opts.File.BestPath()...)
+		},
+		PieceCompletion: sharedCompletion{c.completion},
+	})
+	c.storages[key] = impl
+	return impl, nil
+}
+
+// closeStorages закрывает все бэкенды хранения и общую базу piece completion
+func (c *Client) closeStorages() []error {
+	var errs []error
+	for _, impl := range c.storages {
+		if err := impl.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.storage != nil {
+		if err := c.storage.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.completion != nil {
+		if err := c.completion.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
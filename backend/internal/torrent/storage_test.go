@@ -0,0 +1,83 @@
+package torrent
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var storageBackends = []string{StorageFile, StorageMMap, StoragePiece}
+
+// leech скачивает игру клиентом с бэкендом storageName у раздающего клиента seeder
+// и возвращает клиент и время загрузки
+func leech(tb testing.TB, game *testGame, seeder *Client, storageName string) (*Client, time.Duration) {
+	tb.Helper()
+	leecher := newTestClient(tb, storageName)
+
+	start := time.Now()
+	_, progress, err := leecher.AddTorrentFile(game.torrentFile(tb), AddOptions{Owner: "leecher"})
+	if err != nil {
+		tb.Fatalf("AddTorrentFile: %v", err)
+	}
+	t, _ := leecher.client.Torrent(game.mi.HashInfoBytes())
+	t.AddClientPeer(seeder.client)
+
+	// Прогресс задачи опрашивается раз в секунду - время меряем по самому торренту
+	select {
+	case <-t.Complete().On():
+	case <-time.After(swarmTimeout):
+		tb.Fatalf("download did not complete in %s", swarmTimeout)
+	}
+	elapsed := time.Since(start)
+
+	waitCompleted(tb, progress)
+	return leecher, elapsed
+}
+
+func TestStorageBackendsSwarm(t *testing.T) {
+	game := newTestGame(t, 8<<20)
+	seeder := newTestClient(t, StorageFile)
+	game.seed(t, seeder)
+
+	for _, name := range storageBackends {
+		t.Run(name, func(t *testing.T) {
+			leecher, elapsed := leech(t, game, seeder, name)
+			game.checkPieces(t, leecher)
+			if name != StoragePiece {
+				// В бэкенде piece файлы игры не собираются
+				game.checkFiles(t, filepath.Join(leecher.config.DownloadDir, game.info.Name))
+			}
+			t.Logf("%s: %d bytes in %s (%.1f MiB/s)", name, game.info.TotalLength(), elapsed,
+				float64(game.info.TotalLength())/elapsed.Seconds()/(1<<20))
+		})
+	}
+}
+
+func TestStoragePieceReseeds(t *testing.T) {
+	// Данные из бэкенда piece должны раздаваться дальше: третий клиент качает у второго
+	game := newTestGame(t, 4<<20)
+	seeder := newTestClient(t, StorageFile)
+	game.seed(t, seeder)
+
+	middle, _ := leech(t, game, seeder, StoragePiece)
+
+	last, _ := leech(t, game, middle, StorageFile)
+	game.checkFiles(t, filepath.Join(last.config.DownloadDir, game.info.Name))
+}
+
+func BenchmarkStorageBackendsSwarm(b *testing.B) {
+	game := newTestGame(b, 32<<20)
+	seeder := newTestClient(b, StorageFile)
+	game.seed(b, seeder)
+
+	for _, name := range storageBackends {
+		b.Run(name, func(b *testing.B) {
+			var elapsed time.Duration
+			for i := 0; i < b.N; i++ {
+				_, d := leech(b, game, seeder, name)
+				elapsed += d
+			}
+			b.ReportMetric(float64(game.info.TotalLength())*float64(b.N)/elapsed.Seconds()/(1<<20), "MiB/s")
+		})
+	}
+}
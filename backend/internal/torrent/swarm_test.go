@@ -0,0 +1,178 @@
+package torrent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"gamecloud/internal/config"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Общие помощники тестов: клиенты на localhost без DHT и UPnP, сгенерированные игры и
+// ожидание завершения загрузки
+
+const swarmTimeout = 60 * time.Second
+
+// newTestConfig возвращает настройки клиента, который общается только с локальными пирами
+func newTestConfig(dir, storageName string) *config.TorrentConfig {
+	return &config.TorrentConfig{
+		DownloadDir:        filepath.Join(dir, "downloads"),
+		StateDir:           filepath.Join(dir, "state"),
+		Storage:            storageName,
+		MaxPeers:           30,
+		HalfOpenPerTorrent: 15,
+		MaxHalfOpen:        100,
+		HandshakeTimeout:   10 * time.Second,
+		EnableIPv4:         true,
+		EnableTCP:          true,
+		Encryption:         EncryptionPreferred,
+		MetadataTimeout:    swarmTimeout,
+	}
+}
+
+func newTestClient(tb testing.TB, storageName string) *Client {
+	tb.Helper()
+	c, err := NewClient(newTestConfig(tb.TempDir(), storageName))
+	if err != nil {
+		tb.Fatalf("NewClient(%q): %v", storageName, err)
+	}
+	tb.Cleanup(func() { c.Close() })
+	return c
+}
+
+// testGame - сгенерированный каталог игры и торрент для него
+type testGame struct {
+	dir   string
+	files map[string][]byte
+	mi    *metainfo.MetaInfo
+	info  metainfo.Info
+}
+
+// newTestGame создает каталог из нескольких файлов со случайными данными общим размером
+// около size байт и торрент для него
+func newTestGame(tb testing.TB, size int64, webSeeds ...string) *testGame {
+	tb.Helper()
+	rng := rand.New(rand.NewSource(size))
+	game := &testGame{
+		dir:   filepath.Join(tb.TempDir(), "Test Game"),
+		files: make(map[string][]byte),
+	}
+
+	names := []string{"game.bin", filepath.Join("data", "assets.pak"), filepath.Join("data", "readme.txt")}
+	sizes := []int64{size / 2, size/2 - 1000, 1000}
+	for i, name := range names {
+		data := make([]byte, sizes[i])
+		rng.Read(data)
+		path := filepath.Join(game.dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			tb.Fatal(err)
+		}
+		game.files[filepath.ToSlash(name)] = data
+	}
+
+	mi, err := CreateTorrent(context.Background(), CreateOptions{Path: game.dir}, nil)
+	if err != nil {
+		tb.Fatalf("CreateTorrent: %v", err)
+	}
+	if len(webSeeds) > 0 {
+		mi.UrlList = webSeeds
+	}
+	game.mi = mi
+	game.info, err = mi.UnmarshalInfo()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return game
+}
+
+// torrentFile возвращает .torrent файл игры
+func (g *testGame) torrentFile(tb testing.TB) io.Reader {
+	tb.Helper()
+	data, err := bencode.Marshal(g.mi)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return bytes.NewReader(data)
+}
+
+// seed начинает раздачу игры клиентом c
+func (g *testGame) seed(tb testing.TB, c *Client) {
+	tb.Helper()
+	if _, err := c.Seed(g.mi, g.dir, "seeder", true); err != nil {
+		tb.Fatalf("Seed: %v", err)
+	}
+}
+
+// waitCompleted читает прогресс загрузки до завершения и возвращает все обновления
+func waitCompleted(tb testing.TB, progress chan ProgressUpdate) []ProgressUpdate {
+	tb.Helper()
+	var updates []ProgressUpdate
+	timeout := time.After(swarmTimeout)
+	for {
+		select {
+		case update, ok := <-progress:
+			if !ok {
+				tb.Fatalf("progress channel closed before completion")
+			}
+			updates = append(updates, update)
+			switch update.Status {
+			case "completed":
+				return updates
+			case "failed":
+				tb.Fatalf("download failed: %s", update.Error)
+			}
+		case <-timeout:
+			tb.Fatalf("download did not complete in %s", swarmTimeout)
+		}
+	}
+}
+
+// checkPieces сверяет каждую часть, прочитанную через клиент, с хешем из торрента
+func (g *testGame) checkPieces(tb testing.TB, c *Client) {
+	tb.Helper()
+	t, ok := c.client.Torrent(g.mi.HashInfoBytes())
+	if !ok {
+		tb.Fatalf("torrent %s is not in the client", g.mi.HashInfoBytes())
+	}
+
+	r := t.NewReader()
+	defer r.Close()
+	for i := 0; i < g.info.NumPieces(); i++ {
+		piece := g.info.Piece(i)
+		buf := make([]byte, piece.Length())
+		if _, err := r.Seek(piece.Offset(), io.SeekStart); err != nil {
+			tb.Fatal(err)
+		}
+		if _, err := io.ReadFull(r, buf); err != nil {
+			tb.Fatalf("piece %d: %v", i, err)
+		}
+		if sum := sha1.Sum(buf); !bytes.Equal(sum[:], piece.V1Hash().Unwrap().Bytes()) {
+			tb.Fatalf("piece %d hash mismatch", i)
+		}
+	}
+}
+
+// checkFiles сверяет файлы в каталоге dir с исходными данными игры
+func (g *testGame) checkFiles(tb testing.TB, dir string) {
+	tb.Helper()
+	for name, want := range g.files {
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			tb.Fatalf("%s differs from the original", name)
+		}
+	}
+}
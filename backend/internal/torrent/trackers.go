@@ -0,0 +1,674 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	alog "github.com/anacrolix/log"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/tracker"
+)
+
+// Анонсы на HTTP и UDP трекеры выполняет сам клиент, а не anacrolix/torrent: библиотека не
+// отдает результат своих анонсов, не умеет анонсироваться по требованию, а ModifyTrackers
+// останавливает ее анонсеры без перезапуска. Поэтому библиотеке передаются только трекеры
+// WebTorrent (ws, wss): они требуют WebRTC, и их состояние приходит в колбэке StatusUpdated.
+// Полный список трекеров торрента хранит клиент (announceLists).
+
+// Состояния трекера
+const (
+	TrackerNotContacted = "not_contacted"
+	TrackerUpdating     = "updating"
+	TrackerWorking      = "working"
+	TrackerError        = "error"
+)
+
+const (
+	// Интервал, если трекер его не сообщил
+	defaultAnnounceInterval = 30 * time.Minute
+	// Не анонсируемся чаще раза в минуту, даже если трекер просит
+	minAnnounceInterval = time.Minute
+	// Пока торренту не хватает пиров, анонсируемся чаще (кроме приватных торрентов)
+	wantPeersAnnounceInterval = 2 * time.Minute
+	wantPeersThreshold        = 20
+	// Повтор после ошибки анонса
+	errorAnnounceInterval = 5 * time.Minute
+)
+
+var (
+	// ErrTorrentNotFound - торрента нет в клиенте (загрузка не активна)
+	ErrTorrentNotFound = errors.New("torrent not found")
+	// ErrInvalidTracker - неподдерживаемый или некорректный URL трекера
+	ErrInvalidTracker = errors.New("invalid tracker URL")
+	// ErrTrackerNotFound - у торрента нет такого трекера
+	ErrTrackerNotFound = errors.New("tracker not found")
+
+	// errTrackerBlocked - все адреса трекера в блоклисте или забанены
+	errTrackerBlocked = errors.New("tracker address is blocked")
+)
+
+// TrackerStatus описывает состояние трекера торрента
+type TrackerStatus struct {
+	URL          string     `json:"url"`
+	Tier         int        `json:"tier"`
+	Status       string     `json:"status"` // not_contacted, updating, working, error
+	LastAnnounce *time.Time `json:"last_announce,omitempty"`
+	NextAnnounce *time.Time `json:"next_announce,omitempty"`
+	Seeders      int        `json:"seeders"`
+	Leechers     int        `json:"leechers"`
+	Peers        int        `json:"peers"` // число пиров в последнем ответе
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+// trackerAnnouncer периодически анонсирует торрент на один трекер. Для трекеров
+// WebTorrent он только хранит состояние, которое сообщает библиотека.
+type trackerAnnouncer struct {
+	c       *Client
+	t       *torrent.Torrent
+	url     string
+	library bool
+
+	mu     sync.Mutex
+	status TrackerStatus
+
+	reannounce chan struct{}
+	stopCh     chan struct{}
+	stopOnce   sync.Once
+
+	wasIncomplete bool
+	sentCompleted bool
+}
+
+// ValidTrackerURL проверяет, поддерживается ли URL трекера
+func ValidTrackerURL(trackerURL string) bool {
+	u, err := url.Parse(trackerURL)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	switch u.Scheme {
+	case "http", "https", "udp", "udp4", "udp6", "ws", "wss":
+		return true
+	}
+	return false
+}
+
+// isWebTorrentTracker сообщает, анонсирует ли на трекер библиотека
+func isWebTorrentTracker(trackerURL string) bool {
+	u, err := url.Parse(trackerURL)
+	return err == nil && (u.Scheme == "ws" || u.Scheme == "wss")
+}
+
+// libraryTrackers оставляет в списке трекеров только трекеры WebTorrent - список для
+// библиотеки
+func libraryTrackers(announceList [][]string) [][]string {
+	var tiers [][]string
+	for _, tier := range announceList {
+		var urls []string
+		for _, u := range tier {
+			if isWebTorrentTracker(u) {
+				urls = append(urls, u)
+			}
+		}
+		if len(urls) > 0 {
+			tiers = append(tiers, urls)
+		}
+	}
+	return tiers
+}
+
+// mergeAnnounceList добавляет к списку недостающие трекеры, сохраняя их уровни
+func mergeAnnounceList(announceList, add [][]string) [][]string {
+	merged := make([][]string, 0, max(len(announceList), len(add)))
+	for _, tier := range announceList {
+		merged = append(merged, append([]string(nil), tier...))
+	}
+	for i, tier := range add {
+		if i == len(merged) {
+			merged = append(merged, nil)
+		}
+		for _, u := range tier {
+			if !slices.Contains(merged[i], u) {
+				merged[i] = append(merged[i], u)
+			}
+		}
+	}
+	return merged
+}
+
+// onTrackerStatus обновляет состояние трекеров WebTorrent по событиям библиотеки.
+// Вызывается синхронно, возможно под блокировкой клиента - методы торрента не вызываем.
+func (c *Client) onTrackerStatus(e torrent.StatusUpdatedEvent) {
+	if e.Url == "" {
+		return
+	}
+
+	c.trackersMu.Lock()
+	var targets []*trackerAnnouncer
+	for ih, announcers := range c.trackers {
+		// События соединения относятся ко всем торрентам трекера
+		if e.InfoHash != "" && e.InfoHash != ih.HexString() {
+			continue
+		}
+		if a, ok := announcers[e.Url]; ok && a.library {
+			targets = append(targets, a)
+		}
+	}
+	c.trackersMu.Unlock()
+
+	now := time.Now()
+	for _, a := range targets {
+		a.mu.Lock()
+		switch {
+		case e.Error != nil:
+			a.status.Status = TrackerError
+			a.status.LastError = e.Error.Error()
+		case e.Event == torrent.TrackerAnnounceSuccessful:
+			a.status.Status = TrackerWorking
+			a.status.LastError = ""
+			a.status.LastAnnounce = &now
+		case e.Event == torrent.TrackerDisconnected:
+			a.status.Status = TrackerUpdating
+		}
+		a.mu.Unlock()
+	}
+}
+
+// SetDefaultTrackers задает трекеры, добавляемые к каждой magnet-ссылке
+func (c *Client) SetDefaultTrackers(trackers []string) {
+	c.trackersMu.Lock()
+	defer c.trackersMu.Unlock()
+	c.defaultTrackers = append([]string(nil), trackers...)
+}
+
+// withDefaultTrackers добавляет трекеры по умолчанию отдельным уровнем
+func (c *Client) withDefaultTrackers(spec *torrent.TorrentSpec) {
+	c.trackersMu.Lock()
+	defaults := c.defaultTrackers
+	c.trackersMu.Unlock()
+
+	existing := make(map[string]bool)
+	for _, tier := range spec.Trackers {
+		for _, u := range tier {
+			existing[u] = true
+		}
+	}
+
+	var tier []string
+	for _, u := range defaults {
+		if !existing[u] {
+			tier = append(tier, u)
+		}
+	}
+	if len(tier) > 0 {
+		spec.Trackers = append(spec.Trackers, tier)
+	}
+}
+
+// addTorrentSpec добавляет торрент в библиотеку только с трекерами WebTorrent и запускает
+// анонсы на все трекеры спецификации
+func (c *Client) addTorrentSpec(spec *torrent.TorrentSpec) (*torrent.Torrent, error) {
+	announceList := spec.Trackers
+	spec.Trackers = libraryTrackers(announceList)
+	t, _, err := c.client.AddTorrentSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	c.setAnnounceList(t, mergeAnnounceList(c.announceList(t.InfoHash()), announceList))
+	return t, nil
+}
+
+// announceList возвращает копию полного списка трекеров торрента
+func (c *Client) announceList(ih metainfo.Hash) [][]string {
+	c.trackersMu.Lock()
+	defer c.trackersMu.Unlock()
+	return mergeAnnounceList(nil, c.announceLists[ih])
+}
+
+// fullMetainfo возвращает метаинформацию торрента с полным списком трекеров: в библиотеке
+// остаются только трекеры WebTorrent
+func (c *Client) fullMetainfo(t *torrent.Torrent) metainfo.MetaInfo {
+	mi := t.Metainfo()
+	mi.AnnounceList = c.announceList(t.InfoHash())
+	if len(mi.AnnounceList) > 0 && len(mi.AnnounceList[0]) > 0 {
+		mi.Announce = mi.AnnounceList[0][0]
+	}
+	return mi
+}
+
+// setAnnounceList задает полный список трекеров торрента: запускает анонсы на новые
+// трекеры, останавливает анонсы на удаленные и передает библиотеке трекеры WebTorrent
+func (c *Client) setAnnounceList(t *torrent.Torrent, announceList [][]string) {
+	ih := t.InfoHash()
+
+	c.trackersMu.Lock()
+	announcers, tracked := c.trackers[ih]
+	if !tracked {
+		announcers = make(map[string]*trackerAnnouncer)
+		c.trackers[ih] = announcers
+		// Когда торрент удаляют из клиента, останавливаем его анонсы
+		go func() {
+			<-t.Closed()
+			c.stopTrackers(ih)
+		}()
+	}
+	c.announceLists[ih] = announceList
+
+	listed := make(map[string]bool)
+	for tier, urls := range announceList {
+		for _, u := range urls {
+			listed[u] = true
+			if _, ok := announcers[u]; ok || !ValidTrackerURL(u) {
+				continue
+			}
+			announcers[u] = c.newAnnouncer(t, u, tier)
+		}
+	}
+	var removed []*trackerAnnouncer
+	for u, a := range announcers {
+		if !listed[u] {
+			removed = append(removed, a)
+			delete(announcers, u)
+		}
+	}
+	c.trackersMu.Unlock()
+
+	for _, a := range removed {
+		a.stop()
+	}
+
+	mi := t.Metainfo()
+	library := libraryTrackers(announceList)
+	if !slices.EqualFunc(mi.UpvertedAnnounceList(), library, slices.Equal) {
+		t.ModifyTrackers(library)
+	}
+}
+
+func (c *Client) newAnnouncer(t *torrent.Torrent, trackerURL string, tier int) *trackerAnnouncer {
+	a := &trackerAnnouncer{
+		c:   c,
+		t:   t,
+		url: trackerURL,
+		status: TrackerStatus{
+			URL:    trackerURL,
+			Tier:   tier,
+			Status: TrackerNotContacted,
+		},
+		reannounce: make(chan struct{}, 1),
+		stopCh:     make(chan struct{}),
+		library:    isWebTorrentTracker(trackerURL),
+	}
+	if !a.library {
+		go a.run()
+	}
+	return a
+}
+
+func (c *Client) stopTrackers(ih metainfo.Hash) {
+	c.trackersMu.Lock()
+	announcers := c.trackers[ih]
+	delete(c.trackers, ih)
+	delete(c.announceLists, ih)
+	c.trackersMu.Unlock()
+
+	for _, a := range announcers {
+		a.stop()
+	}
+}
+
+// announcers возвращает анонсеры торрента по info hash
+func (c *Client) announcers(infoHash string) (*torrent.Torrent, map[string]*trackerAnnouncer, error) {
+	var ih metainfo.Hash
+	if err := ih.FromHexString(infoHash); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrTorrentNotFound, infoHash)
+	}
+	t, ok := c.client.Torrent(ih)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", ErrTorrentNotFound, infoHash)
+	}
+
+	c.trackersMu.Lock()
+	defer c.trackersMu.Unlock()
+	return t, c.trackers[ih], nil
+}
+
+// Trackers возвращает трекеры торрента с состоянием анонсов
+func (c *Client) Trackers(infoHash string) ([]TrackerStatus, error) {
+	t, announcers, err := c.announcers(infoHash)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]TrackerStatus, 0, len(announcers))
+	for tier, urls := range c.announceList(t.InfoHash()) {
+		for _, u := range urls {
+			if a, ok := announcers[u]; ok {
+				statuses = append(statuses, a.snapshot())
+			} else {
+				// Некорректные URL из торрента показываем без анонсов
+				statuses = append(statuses, TrackerStatus{
+					URL:       u,
+					Tier:      tier,
+					Status:    TrackerError,
+					LastError: "unsupported tracker URL",
+				})
+			}
+		}
+	}
+	return statuses, nil
+}
+
+// AddTracker добавляет трекер к торренту отдельным уровнем и сразу анонсируется на него
+func (c *Client) AddTracker(infoHash, trackerURL string) error {
+	if !ValidTrackerURL(trackerURL) {
+		return fmt.Errorf("%w: %s", ErrInvalidTracker, trackerURL)
+	}
+	t, _, err := c.announcers(infoHash)
+	if err != nil {
+		return err
+	}
+
+	announceList := c.announceList(t.InfoHash())
+	for _, tier := range announceList {
+		if slices.Contains(tier, trackerURL) {
+			return nil
+		}
+	}
+
+	c.setAnnounceList(t, append(announceList, []string{trackerURL}))
+	c.updateMetainfo(t)
+	return nil
+}
+
+// RemoveTracker удаляет трекер из торрента. Соединение с трекером WebTorrent библиотека
+// закрывает только вместе с торрентом, но трекер пропадает из списка и метаинформации.
+func (c *Client) RemoveTracker(infoHash, trackerURL string) error {
+	t, _, err := c.announcers(infoHash)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	var announceList [][]string
+	for _, tier := range c.announceList(t.InfoHash()) {
+		var urls []string
+		for _, u := range tier {
+			if u == trackerURL {
+				found = true
+				continue
+			}
+			urls = append(urls, u)
+		}
+		if len(urls) > 0 {
+			announceList = append(announceList, urls)
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", ErrTrackerNotFound, trackerURL)
+	}
+
+	// Анонсер удаленного трекера останавливается и отправляет stopped
+	c.setAnnounceList(t, announceList)
+	c.updateMetainfo(t)
+	return nil
+}
+
+// Reannounce немедленно анонсирует торрент на все HTTP и UDP трекеры. Трекеры WebTorrent
+// держат постоянное соединение, и библиотека анонсируется на них по своему расписанию.
+func (c *Client) Reannounce(infoHash string) error {
+	_, announcers, err := c.announcers(infoHash)
+	if err != nil {
+		return err
+	}
+	for _, a := range announcers {
+		if a.library {
+			continue
+		}
+		select {
+		case a.reannounce <- struct{}{}:
+		default:
+			// Анонс уже запрошен
+		}
+	}
+	return nil
+}
+
+func (a *trackerAnnouncer) snapshot() TrackerStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.status
+}
+
+func (a *trackerAnnouncer) stop() {
+	a.stopOnce.Do(func() {
+		close(a.stopCh)
+	})
+}
+
+func (a *trackerAnnouncer) run() {
+	// Первый анонс - started, дальше обычные
+	event := tracker.Started
+
+	for {
+		interval := a.announce(context.Background(), event)
+		event = tracker.None
+
+		next := time.Now().Add(interval)
+		a.mu.Lock()
+		a.status.NextAnnounce = &next
+		a.mu.Unlock()
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-a.reannounce:
+			timer.Stop()
+		case <-a.stopCh:
+			timer.Stop()
+			a.announceStopped()
+			return
+		case <-a.t.Closed():
+			timer.Stop()
+			a.announceStopped()
+			return
+		}
+
+		// Сообщаем трекеру о завершении загрузки один раз
+		if a.wasIncomplete && !a.sentCompleted && a.complete() {
+			event = tracker.Completed
+			a.sentCompleted = true
+		}
+	}
+}
+
+func (a *trackerAnnouncer) announceStopped() {
+	ctx, cancel := context.WithTimeout(context.Background(), tracker.DefaultTrackerAnnounceTimeout)
+	defer cancel()
+	a.announce(ctx, tracker.Stopped)
+}
+
+func (a *trackerAnnouncer) complete() bool {
+	return a.t.Info() != nil && a.t.BytesMissing() == 0
+}
+
+// announce выполняет анонс и возвращает интервал до следующего
+func (a *trackerAnnouncer) announce(ctx context.Context, event tracker.AnnounceEvent) time.Duration {
+	a.mu.Lock()
+	a.status.Status = TrackerUpdating
+	a.mu.Unlock()
+
+	if event == tracker.Started && !a.complete() {
+		a.wasIncomplete = true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, tracker.DefaultTrackerAnnounceTimeout)
+	defer cancel()
+
+	u, _ := url.Parse(a.url)
+	cfg := a.c.clientConfig
+	trackerURL, udpNetwork, err := a.c.trackerAddr(ctx, u)
+	var res tracker.AnnounceResponse
+	if err == nil {
+		res, err = tracker.Announce{
+			Context:      ctx,
+			TrackerUrl:   trackerURL,
+			Request:      a.c.announceRequest(a.t, event),
+			HttpProxy:    cfg.HTTPProxy,
+			DialContext:  cfg.TrackerDialContext,
+			ListenPacket: cfg.TrackerListenPacket,
+			UserAgent:    cfg.HTTPUserAgent,
+			HostHeader:   u.Host,
+			ServerName:   u.Hostname(),
+			UdpNetwork:   udpNetwork,
+			Logger:       alog.Default,
+		}.Do()
+	}
+
+	now := time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.status.LastAnnounce = &now
+
+	if err != nil {
+		if event != tracker.Stopped {
+			log.Printf("Tracker announce failed: %s: %v", a.url, err)
+		}
+		a.status.Status = TrackerError
+		a.status.LastError = err.Error()
+		return errorAnnounceInterval
+	}
+
+	peers := make([]torrent.PeerInfo, 0, len(res.Peers))
+	for _, p := range res.Peers {
+		if p.Port == 0 {
+			continue
+		}
+		info := torrent.PeerInfo{
+			Addr:   &net.TCPAddr{IP: p.IP, Port: p.Port},
+			Source: torrent.PeerSourceTracker,
+		}
+		copy(info.Id[:], p.ID)
+		peers = append(peers, info)
+	}
+	if event != tracker.Stopped {
+		a.t.AddPeers(peers)
+	}
+
+	a.status.Status = TrackerWorking
+	a.status.LastError = ""
+	a.status.Seeders = int(res.Seeders)
+	a.status.Leechers = int(res.Leechers)
+	a.status.Peers = len(peers)
+
+	interval := time.Duration(res.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultAnnounceInterval
+	}
+	if interval > wantPeersAnnounceInterval && a.wantPeers() {
+		interval = wantPeersAnnounceInterval
+	}
+	if interval < minAnnounceInterval {
+		interval = minAnnounceInterval
+	}
+	return interval
+}
+
+// trackerAddr возвращает URL трекера с IP-адресом вместо имени и сеть для UDP-трекеров.
+// Адреса из блоклиста, забаненные и отключенных семейств IP пропускаются, как для пиров.
+// HTTP-трекеры через прокси не резолвим - имя разрешает прокси, а UDP в режиме fail closed
+// запрещен до обращения к DNS.
+func (c *Client) trackerAddr(ctx context.Context, u *url.URL) (string, string, error) {
+	udp := strings.HasPrefix(u.Scheme, "udp")
+	if c.proxy != nil {
+		if !udp {
+			return u.String(), "", nil
+		}
+		if c.proxy.failClosed {
+			return "", "", fmt.Errorf("%w: %s", errProxyOnly, u.Scheme)
+		}
+	}
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return "", "", err
+	}
+	blocked := false
+	for _, ip := range ips {
+		v4 := ip.To4() != nil
+		if v4 && (!c.config.EnableIPv4 || u.Scheme == "udp6") ||
+			!v4 && (!c.config.EnableIPv6 || u.Scheme == "udp4") {
+			continue
+		}
+		if c.peerFilter.blocks(ip) {
+			blocked = true
+			continue
+		}
+
+		target := *u
+		target.Host = ip.String()
+		if !v4 {
+			target.Host = "[" + target.Host + "]"
+		}
+		if u.Port() != "" {
+			target.Host = net.JoinHostPort(ip.String(), u.Port())
+		}
+		network := ""
+		if udp {
+			network = "udp6"
+			if v4 {
+				network = "udp4"
+			}
+		}
+		return target.String(), network, nil
+	}
+	if blocked {
+		return "", "", fmt.Errorf("%w: %s", errTrackerBlocked, u.Hostname())
+	}
+	return "", "", fmt.Errorf("no usable address for tracker %s", u.Hostname())
+}
+
+// wantPeers сообщает, можно ли анонсироваться чаще интервала трекера
+func (a *trackerAnnouncer) wantPeers() bool {
+	info := a.t.Info()
+	if info == nil {
+		return true
+	}
+	// Приватные трекеры следят за интервалом - его нужно соблюдать
+	if info.Private != nil && *info.Private {
+		return false
+	}
+	return a.t.BytesMissing() > 0 && len(a.t.PeerConns()) < wantPeersThreshold
+}
+
+func (c *Client) announceRequest(t *torrent.Torrent, event tracker.AnnounceEvent) tracker.AnnounceRequest {
+	stats := t.Stats()
+
+	left := int64(-1)
+	numWant := int32(200)
+	if t.Info() != nil {
+		left = t.BytesMissing()
+		if left == 0 {
+			numWant = 0
+		}
+	}
+
+	return tracker.AnnounceRequest{
+		InfoHash:   t.InfoHash(),
+		PeerId:     c.client.PeerID(),
+		Downloaded: stats.BytesReadUsefulData.Int64(),
+		Uploaded:   stats.BytesWrittenData.Int64(),
+		Left:       left,
+		Event:      event,
+		Key:        c.announceKey,
+		NumWant:    numWant,
+		Port:       uint16(c.client.LocalPort()),
+	}
+}
@@ -0,0 +1,326 @@
+package torrent
+
+import (
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/tracker"
+	"github.com/gorilla/websocket"
+)
+
+// fakeTracker записывает события анонсов, полученные трекером
+type fakeTracker struct {
+	url    string
+	mu     sync.Mutex
+	events []tracker.AnnounceEvent
+}
+
+func (f *fakeTracker) record(event tracker.AnnounceEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+}
+
+func (f *fakeTracker) count(event tracker.AnnounceEvent) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, e := range f.events {
+		if e == event {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fakeTracker) announces() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.events)
+}
+
+// Ответ фейковых трекеров: интервал, сиды, личи и один пир
+const (
+	fakeInterval = 1800
+	fakeSeeders  = 7
+	fakeLeechers = 3
+)
+
+var fakePeer = []byte{127, 0, 0, 1, 0x1a, 0xe1}
+
+func newHTTPTracker(t *testing.T) *fakeTracker {
+	f := &fakeTracker{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event tracker.AnnounceEvent
+		event.UnmarshalText([]byte(r.URL.Query().Get("event")))
+		f.record(event)
+		data, _ := bencode.Marshal(map[string]any{
+			"interval":   fakeInterval,
+			"complete":   fakeSeeders,
+			"incomplete": fakeLeechers,
+			"peers":      string(fakePeer),
+		})
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	f.url = srv.URL + "/announce"
+	return f
+}
+
+// newUDPTracker запускает трекер по протоколу BEP 15
+func newUDPTracker(t *testing.T) *fakeTracker {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	f := &fakeTracker{url: "udp://" + conn.LocalAddr().String()}
+
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < 16 {
+				continue
+			}
+			action := binary.BigEndian.Uint32(buf[8:])
+			txID := buf[12:16]
+			resp := binary.BigEndian.AppendUint32(nil, action)
+			resp = append(resp, txID...)
+			switch action {
+			case 0: // connect
+				resp = binary.BigEndian.AppendUint64(resp, 0x1234)
+			case 1: // announce
+				if n < 98 {
+					continue
+				}
+				f.record(tracker.AnnounceEvent(binary.BigEndian.Uint32(buf[80:])))
+				resp = binary.BigEndian.AppendUint32(resp, fakeInterval)
+				resp = binary.BigEndian.AppendUint32(resp, fakeLeechers)
+				resp = binary.BigEndian.AppendUint32(resp, fakeSeeders)
+				resp = append(resp, fakePeer...)
+			default:
+				continue
+			}
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return f
+}
+
+// newWebSocketTracker принимает анонсы WebTorrent, ничего не отвечая
+func newWebSocketTracker(t *testing.T) *fakeTracker {
+	f := &fakeTracker{}
+	var upgrader websocket.Upgrader
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+			f.record(tracker.None)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	f.url = "ws" + strings.TrimPrefix(srv.URL, "http") + "/announce"
+	return f
+}
+
+// waitTracker ждет, пока cond не выполнится для состояния трекера
+func waitTracker(t *testing.T, c *Client, infoHash, url string, cond func(TrackerStatus) bool) TrackerStatus {
+	t.Helper()
+	deadline := time.Now().Add(15 * time.Second)
+	var last TrackerStatus
+	for time.Now().Before(deadline) {
+		statuses, err := c.Trackers(infoHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range statuses {
+			if s.URL == url {
+				last = s
+				if cond(s) {
+					return s
+				}
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("tracker %s: unexpected status %+v", url, last)
+	return last
+}
+
+func waitEvent(t *testing.T, f *fakeTracker, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(15 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("tracker %s: expected announce not received (%d announces)", f.url, f.announces())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func working(s TrackerStatus) bool { return s.Status == TrackerWorking }
+
+func TestTrackerAnnounces(t *testing.T) {
+	httpTracker := newHTTPTracker(t)
+	udpTracker := newUDPTracker(t)
+	wsTracker := newWebSocketTracker(t)
+
+	game := newTestGame(t, 1<<20)
+	game.mi.Announce = ""
+	game.mi.AnnounceList = [][]string{{httpTracker.url}, {udpTracker.url, wsTracker.url}}
+	c := newTestClient(t, StorageFile)
+	game.seed(t, c)
+	ih := game.mi.HashInfoBytes().HexString()
+
+	for _, f := range []*fakeTracker{httpTracker, udpTracker} {
+		s := waitTracker(t, c, ih, f.url, working)
+		if s.Seeders != fakeSeeders || s.Leechers != fakeLeechers || s.Peers != 1 {
+			t.Errorf("%s: got %d seeders, %d leechers, %d peers", f.url, s.Seeders, s.Leechers, s.Peers)
+		}
+		if s.LastAnnounce == nil || s.NextAnnounce == nil {
+			t.Errorf("%s: announce times are not set", f.url)
+		}
+		waitEvent(t, f, func() bool { return f.count(tracker.Started) == 1 })
+	}
+
+	// WebTorrent анонсирует библиотека, состояние приходит из ее событий
+	waitTracker(t, c, ih, wsTracker.url, working)
+	if wsTracker.announces() == 0 {
+		t.Error("websocket tracker received no announces")
+	}
+
+	// Библиотеке переданы только трекеры WebTorrent - на HTTP и UDP она не анонсируется
+	lt, _ := c.client.Torrent(game.mi.HashInfoBytes())
+	libraryInfo := lt.Metainfo()
+	if got := libraryInfo.UpvertedAnnounceList(); len(got) != 1 || len(got[0]) != 1 || got[0][0] != wsTracker.url {
+		t.Errorf("library trackers = %v, want only %s", got, wsTracker.url)
+	}
+
+	// Повторный анонс по требованию
+	if err := c.Reannounce(ih); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []*fakeTracker{httpTracker, udpTracker} {
+		waitEvent(t, f, func() bool { return f.count(tracker.None) >= 1 })
+	}
+
+	// Удаленный трекер получает stopped и пропадает из списка
+	if err := c.RemoveTracker(ih, udpTracker.url); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, udpTracker, func() bool { return udpTracker.count(tracker.Stopped) == 1 })
+	statuses, _ := c.Trackers(ih)
+	for _, s := range statuses {
+		if s.URL == udpTracker.url {
+			t.Errorf("removed tracker is still listed: %+v", s)
+		}
+	}
+	if err := c.RemoveTracker(ih, udpTracker.url); err == nil {
+		t.Error("removing a missing tracker succeeded")
+	}
+
+	// Добавленный трекер сразу получает started, остальные не перезапускаются
+	added := newHTTPTracker(t)
+	if err := c.AddTracker(ih, added.url); err != nil {
+		t.Fatal(err)
+	}
+	waitTracker(t, c, ih, added.url, working)
+	waitEvent(t, added, func() bool { return added.count(tracker.Started) == 1 })
+	if n := httpTracker.count(tracker.Started); n != 1 {
+		t.Errorf("http tracker got %d started announces, want 1", n)
+	}
+	waitTracker(t, c, ih, wsTracker.url, working)
+
+	// Кэш метаданных хранит полный список трекеров
+	mi, err := c.LoadCachedMetainfo(ih)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{httpTracker.url}, {wsTracker.url}, {added.url}}
+	if got := mi.UpvertedAnnounceList(); !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("cached trackers = %v, want %v", got, want)
+	}
+}
+
+func TestTrackerAnnounceBlocked(t *testing.T) {
+	httpTracker := newHTTPTracker(t)
+
+	game := newTestGame(t, 1<<20)
+	game.mi.Announce = httpTracker.url
+	c := newTestClient(t, StorageFile)
+	if _, err := c.AddBlocklist("local.p2p", strings.NewReader("Local:127.0.0.1-127.0.0.1\n")); err != nil {
+		t.Fatal(err)
+	}
+	game.seed(t, c)
+	ih := game.mi.HashInfoBytes().HexString()
+
+	s := waitTracker(t, c, ih, httpTracker.url, func(s TrackerStatus) bool { return s.Status == TrackerError })
+	if !strings.Contains(s.LastError, errTrackerBlocked.Error()) {
+		t.Errorf("last error = %q, want %q", s.LastError, errTrackerBlocked)
+	}
+	if n := httpTracker.announces(); n != 0 {
+		t.Errorf("blocked tracker received %d announces", n)
+	}
+}
+
+func TestTrackerAnnounceProxyFailClosed(t *testing.T) {
+	udpTracker := newUDPTracker(t)
+
+	game := newTestGame(t, 1<<20)
+	game.mi.Announce = udpTracker.url
+	cfg := newTestConfig(t.TempDir(), StorageFile)
+	cfg.ProxyURL = "socks5://127.0.0.1:1"
+	cfg.ProxyFailClosed = true
+	c, err := NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	game.seed(t, c)
+	ih := game.mi.HashInfoBytes().HexString()
+
+	// UDP не проходит через прокси - анонс не отправляется
+	s := waitTracker(t, c, ih, udpTracker.url, func(s TrackerStatus) bool { return s.Status == TrackerError })
+	if !strings.Contains(s.LastError, errProxyOnly.Error()) {
+		t.Errorf("last error = %q, want %q", s.LastError, errProxyOnly)
+	}
+	if n := udpTracker.announces(); n != 0 {
+		t.Errorf("UDP tracker received %d announces in fail closed mode", n)
+	}
+}
+
+func TestAddTrackerValidation(t *testing.T) {
+	game := newTestGame(t, 1<<20)
+	c := newTestClient(t, StorageFile)
+	game.seed(t, c)
+	ih := game.mi.HashInfoBytes().HexString()
+
+	for _, u := range []string{"ftp://tracker.example/announce", "not a url", "http://"} {
+		if err := c.AddTracker(ih, u); err == nil {
+			t.Errorf("AddTracker(%q) succeeded", u)
+		}
+	}
+	for _, u := range []string{"http://a.example/announce", "https://b.example/announce", "udp://c.example:80", "wss://d.example/announce"} {
+		if !ValidTrackerURL(u) {
+			t.Errorf("ValidTrackerURL(%q) = false", u)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// ErrInvalidWebSeed - некорректный URL веб-сида
+var ErrInvalidWebSeed = errors.New("invalid web seed URL")
+
+// Веб-сиды (BEP 19) - HTTP(S) зеркала данных торрента. Ссылки из параметров ws= magnet-ссылки
+// и из url-list .torrent файла библиотека добавляет сама, дополнительные передаются в
+// AddOptions.WebSeeds или добавляются к активному торренту через AddWebSeeds.
+
+// ValidWebSeedURL проверяет, что URL веб-сида - абсолютная HTTP(S) ссылка
+func ValidWebSeedURL(webSeedURL string) bool {
+	u, err := url.Parse(webSeedURL)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return u.Scheme == "http" || u.Scheme == "https"
+}
+
+// ValidateWebSeeds проверяет список URL веб-сидов
+func ValidateWebSeeds(urls []string) error {
+	for _, u := range urls {
+		if !ValidWebSeedURL(u) {
+			return fmt.Errorf("%w: %s", ErrInvalidWebSeed, u)
+		}
+	}
+	return nil
+}
+
+// WebSeeds возвращает веб-сиды активного торрента
+func (c *Client) WebSeeds(infoHash string) ([]string, error) {
+	var ih metainfo.Hash
+	if err := ih.FromHexString(infoHash); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrTorrentNotFound, infoHash)
+	}
+	t, ok := c.client.Torrent(ih)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTorrentNotFound, infoHash)
+	}
+
+	urls := t.Metainfo().UrlList
+	sort.Strings(urls)
+	return urls, nil
+}
+
+// AddWebSeeds добавляет веб-сиды к активному торренту. Они сохраняются в кэше метаданных
+// и восстанавливаются после перезапуска.
+func (c *Client) AddWebSeeds(infoHash string, urls []string) error {
+	if err := ValidateWebSeeds(urls); err != nil {
+		return err
+	}
+	var ih metainfo.Hash
+	if err := ih.FromHexString(infoHash); err != nil {
+		return fmt.Errorf("%w: %s", ErrTorrentNotFound, infoHash)
+	}
+	t, ok := c.client.Torrent(ih)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTorrentNotFound, infoHash)
+	}
+
+	t.AddWebSeeds(urls)
+	c.updateMetainfo(t)
+	return nil
+}
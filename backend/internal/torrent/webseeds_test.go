@@ -0,0 +1,161 @@
+package torrent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// Веб-сид отдает данные со скоростью около 1 MiB/s: загрузка 4 MiB длится дольше двух
+// интервалов прогресса (2 с), и сглаженная скорость веб-сидов успевает попасть в прогресс
+const (
+	webSeedChunk    = 64 << 10
+	webSeedInterval = 64 * time.Millisecond
+)
+
+// throttledWriter пишет ответ частями, общими для всех запросов к серверу
+type throttledWriter struct {
+	http.ResponseWriter
+	mu *sync.Mutex
+}
+
+func (w throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), webSeedChunk)
+		w.mu.Lock()
+		time.Sleep(webSeedInterval)
+		w.mu.Unlock()
+		n, err := w.ResponseWriter.Write(p[:n])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// newWebSeed раздает каталог игры по HTTP (BEP 19) и .torrent файл по адресу /game.torrent.
+// Возвращает URL веб-сида и URL .torrent файла.
+func newWebSeed(t *testing.T, game *testGame) (string, string) {
+	t.Helper()
+	torrentData, err := bencode.Marshal(game.mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	files := http.FileServer(http.Dir(filepath.Dir(game.dir)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/game.torrent" {
+			w.Write(torrentData)
+			return
+		}
+		files.ServeHTTP(throttledWriter{w, &mu}, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/", srv.URL + "/game.torrent"
+}
+
+// checkWebSeedProgress проверяет, что данные пришли с веб-сида и его скорость сообщалась
+// отдельно от общей
+func checkWebSeedProgress(t *testing.T, updates []ProgressUpdate, size int64) {
+	t.Helper()
+	var rate float64
+	var webSeeds int
+	for _, u := range updates {
+		rate = max(rate, u.WebSeedRate)
+		webSeeds = max(webSeeds, u.WebSeeds)
+	}
+	last := updates[len(updates)-1]
+	if webSeeds == 0 {
+		t.Error("no web seeds reported in progress")
+	}
+	if last.WebSeedDownloaded < size {
+		t.Errorf("web seed downloaded %d bytes, want at least %d", last.WebSeedDownloaded, size)
+	}
+	if rate <= 0 {
+		t.Error("web seed rate was never reported")
+	}
+}
+
+func TestWebSeedOnlySource(t *testing.T) {
+	const size = 4 << 20
+
+	tests := []struct {
+		name string
+		add  func(t *testing.T, c *Client, game *testGame, webSeed, torrentURL string) chan ProgressUpdate
+	}{
+		{"magnet ws", func(t *testing.T, c *Client, game *testGame, webSeed, torrentURL string) chan ProgressUpdate {
+			// Без пиров метаданные берутся из xs=, данные - только из ws=
+			magnet := "magnet:?xt=urn:btih:" + game.mi.HashInfoBytes().HexString() +
+				"&ws=" + url.QueryEscape(webSeed) + "&xs=" + url.QueryEscape(torrentURL)
+			_, progress, err := c.AddMagnet(magnet, AddOptions{Owner: "test"})
+			if err != nil {
+				t.Fatalf("AddMagnet: %v", err)
+			}
+			return progress
+		}},
+		{"metainfo url-list", func(t *testing.T, c *Client, game *testGame, webSeed, torrentURL string) chan ProgressUpdate {
+			game.mi.UrlList = []string{webSeed}
+			_, progress, err := c.AddTorrentFile(game.torrentFile(t), AddOptions{Owner: "test"})
+			if err != nil {
+				t.Fatalf("AddTorrentFile: %v", err)
+			}
+			return progress
+		}},
+		{"add options", func(t *testing.T, c *Client, game *testGame, webSeed, torrentURL string) chan ProgressUpdate {
+			_, progress, err := c.AddTorrentFile(game.torrentFile(t), AddOptions{Owner: "test", WebSeeds: []string{webSeed}})
+			if err != nil {
+				t.Fatalf("AddTorrentFile: %v", err)
+			}
+			return progress
+		}},
+		{"AddWebSeeds", func(t *testing.T, c *Client, game *testGame, webSeed, torrentURL string) chan ProgressUpdate {
+			_, progress, err := c.AddTorrentFile(game.torrentFile(t), AddOptions{Owner: "test"})
+			if err != nil {
+				t.Fatalf("AddTorrentFile: %v", err)
+			}
+			ih := game.mi.HashInfoBytes().HexString()
+			if err := c.AddWebSeeds(ih, []string{webSeed}); err != nil {
+				t.Fatalf("AddWebSeeds: %v", err)
+			}
+			if seeds, _ := c.WebSeeds(ih); len(seeds) != 1 || seeds[0] != webSeed {
+				t.Errorf("WebSeeds = %v, want [%s]", seeds, webSeed)
+			}
+			return progress
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			game := newTestGame(t, size)
+			webSeed, torrentURL := newWebSeed(t, game)
+			c := newTestClient(t, StorageFile)
+
+			updates := waitCompleted(t, tt.add(t, c, game, webSeed, torrentURL))
+			game.checkPieces(t, c)
+			game.checkFiles(t, filepath.Join(c.config.DownloadDir, game.info.Name))
+			checkWebSeedProgress(t, updates, game.info.TotalLength())
+		})
+	}
+}
+
+func TestValidateWebSeeds(t *testing.T) {
+	if err := ValidateWebSeeds([]string{"http://mirror.example/games/", "https://cdn.example/x"}); err != nil {
+		t.Errorf("valid web seeds rejected: %v", err)
+	}
+	for _, u := range []string{"ftp://mirror.example/", "/relative/path", "magnet:?xt=urn:btih:00"} {
+		if err := ValidateWebSeeds([]string{u}); err == nil {
+			t.Errorf("ValidateWebSeeds(%q) succeeded", u)
+		}
+	}
+}
@@ -0,0 +1,490 @@
+// Package transmission управляет загрузками через уже запущенный демон Transmission по RPC.
+// Client выполняет те же операции, что и встроенный торрент-клиент, и отдает прогресс теми
+// же torrent.ProgressUpdate, поэтому менеджер загрузок использует его вместо встроенного.
+// Торренты остаются в демоне и после остановки сервера: при перезапуске загрузки
+// добавляются снова и подхватывают уже существующие торренты.
+package transmission
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gamecloud/internal/config"
+	"gamecloud/internal/torrent"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/google/uuid"
+)
+
+// Таймаут одного запроса к демону
+const rpcTimeout = 30 * time.Second
+
+type Client struct {
+	rpc             *rpcClient
+	config          *config.TransmissionConfig
+	metadataTimeout time.Duration
+	// Директория загрузок демона по умолчанию - для перевода путей в локальные
+	daemonDir string
+
+	mu        sync.RWMutex
+	jobs      map[string]*job
+	owners    map[string]map[string]struct{} // info hash -> загрузки, использующие торрент
+	admission torrent.AdmissionFunc
+	wg        sync.WaitGroup
+}
+
+// NewClient подключается к демону Transmission. torrentCfg задает общие для торрентов
+// настройки, например время ожидания метаданных.
+func NewClient(cfg *config.TransmissionConfig, torrentCfg *config.TorrentConfig) (*Client, error) {
+	c := &Client{
+		rpc: &rpcClient{
+			url:        cfg.URL,
+			username:   cfg.Username,
+			password:   cfg.Password,
+			httpClient: &http.Client{Timeout: rpcTimeout},
+		},
+		config:          cfg,
+		metadataTimeout: torrentCfg.MetadataTimeout,
+		jobs:            make(map[string]*job),
+		owners:          make(map[string]map[string]struct{}),
+	}
+	if c.metadataTimeout <= 0 {
+		c.metadataTimeout = 60 * time.Second
+	}
+	if c.config.PollInterval <= 0 {
+		c.config.PollInterval = 2 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	version, daemonDir, err := c.rpc.session(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Transmission at %s: %w", cfg.URL, err)
+	}
+	c.daemonDir = daemonDir
+	log.Printf("Connected to Transmission %s at %s", version, cfg.URL)
+	return c, nil
+}
+
+// SetAdmissionCheck устанавливает проверку, выполняемую перед стартом каждой загрузки
+func (c *Client) SetAdmissionCheck(fn torrent.AdmissionFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.admission = fn
+}
+
+// Close прекращает отслеживание загрузок. Торренты в демоне продолжают работать.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	for _, j := range c.jobs {
+		j.cancel()
+	}
+	c.mu.Unlock()
+
+	c.wg.Wait()
+	log.Printf("Transmission client stopped")
+	return nil
+}
+
+func (c *Client) AddMagnet(magnetLink string, opts torrent.AddOptions) (string, chan torrent.ProgressUpdate, error) {
+	if _, err := torrent.MagnetName(magnetLink); err != nil {
+		return "", nil, err
+	}
+	return c.add(map[string]interface{}{"filename": magnetLink}, opts)
+}
+
+func (c *Client) AddTorrentURL(torrentURL string, opts torrent.AddOptions) (string, chan torrent.ProgressUpdate, error) {
+	// .torrent файл скачиваем сами: демон может не иметь доступа к ссылке, а ошибки
+	// HTTP классифицируются так же, как у встроенного клиента
+	mi, err := torrent.FetchMetainfo(context.Background(), http.DefaultClient, torrentURL)
+	if err != nil {
+		return "", nil, err
+	}
+	var buf bytes.Buffer
+	if err := mi.Write(&buf); err != nil {
+		return "", nil, fmt.Errorf("failed to encode torrent file: %w", err)
+	}
+	return c.addMetainfo(buf.Bytes(), opts)
+}
+
+func (c *Client) AddTorrentFile(torrentFile io.Reader, opts torrent.AddOptions) (string, chan torrent.ProgressUpdate, error) {
+	data, err := io.ReadAll(torrentFile)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read torrent file: %w", err)
+	}
+	if _, err := metainfo.Load(bytes.NewReader(data)); err != nil {
+		return "", nil, fmt.Errorf("failed to parse torrent file: %w: %w", torrent.ErrInvalidTorrent, err)
+	}
+	return c.addMetainfo(data, opts)
+}
+
+func (c *Client) addMetainfo(data []byte, opts torrent.AddOptions) (string, chan torrent.ProgressUpdate, error) {
+	return c.add(map[string]interface{}{"metainfo": base64.StdEncoding.EncodeToString(data)}, opts)
+}
+
+// add добавляет торрент в демон и начинает следить за ним. Торрент, который уже есть в
+// демоне (например, добавленный до перезапуска сервера), используется как есть.
+func (c *Client) add(args map[string]interface{}, opts torrent.AddOptions) (string, chan torrent.ProgressUpdate, error) {
+	if c.config.DownloadDir != "" {
+		args["download-dir"] = c.config.DownloadDir
+	}
+	if len(opts.WebSeeds) > 0 {
+		log.Printf("Transmission does not support adding web seeds over RPC, ignoring %d", len(opts.WebSeeds))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	added, duplicate, err := c.rpc.addTorrent(ctx, args)
+	if err != nil {
+		return "", nil, err
+	}
+	hash := strings.ToLower(added.HashString)
+	if duplicate {
+		// Торрент мог быть остановлен в демоне
+		if err := c.rpc.action(ctx, "torrent-start", hash); err != nil {
+			log.Printf("Failed to start existing Transmission torrent %s: %v", hash, err)
+		}
+	}
+	if opts.Verify {
+		if err := c.rpc.action(ctx, "torrent-verify", hash); err != nil {
+			log.Printf("Failed to verify Transmission torrent %s: %v", hash, err)
+		}
+	}
+
+	jobCtx, jobCancel := context.WithCancel(context.Background())
+	j := &job{
+		id:       uuid.New().String(),
+		hash:     hash,
+		owner:    opts.Owner,
+		name:     added.Name,
+		progress: make(chan torrent.ProgressUpdate, 100),
+		ctx:      jobCtx,
+		cancel:   jobCancel,
+	}
+
+	c.mu.Lock()
+	c.jobs[j.id] = j
+	if c.owners[hash] == nil {
+		c.owners[hash] = make(map[string]struct{})
+	}
+	c.owners[hash][opts.Owner] = struct{}{}
+	c.mu.Unlock()
+
+	c.wg.Add(1)
+	go c.run(j)
+
+	return j.id, j.progress, nil
+}
+
+func (c *Client) job(downloadID string) (*job, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	j, ok := c.jobs[downloadID]
+	if !ok {
+		return nil, fmt.Errorf("download not found: %s", downloadID)
+	}
+	return j, nil
+}
+
+// InfoHash возвращает info hash торрента загрузки
+func (c *Client) InfoHash(downloadID string) (string, error) {
+	j, err := c.job(downloadID)
+	if err != nil {
+		return "", err
+	}
+	return j.hash, nil
+}
+
+func (c *Client) PauseDownload(downloadID string) error {
+	j, err := c.job(downloadID)
+	if err != nil {
+		return err
+	}
+	j.setPaused(true)
+	// Общий торрент продолжает скачиваться, пока его не поставят на паузу все владельцы
+	if !c.othersPaused(j) {
+		return nil
+	}
+	return c.action("torrent-stop", j.hash)
+}
+
+func (c *Client) ResumeDownload(downloadID string) error {
+	j, err := c.job(downloadID)
+	if err != nil {
+		return err
+	}
+	if err := c.action("torrent-start", j.hash); err != nil {
+		return err
+	}
+	j.setPaused(false)
+	return nil
+}
+
+// CancelDownload отменяет загрузку. Торрент удаляется из демона, если он больше никому
+// не нужен; данные на диске остаются.
+func (c *Client) CancelDownload(downloadID string) error {
+	j, err := c.job(downloadID)
+	if err != nil {
+		return err
+	}
+	j.cancel()
+
+	c.mu.Lock()
+	delete(c.jobs, downloadID)
+	last := c.releaseOwner(j.hash, j.owner)
+	c.mu.Unlock()
+
+	if last {
+		return c.remove(j.hash)
+	}
+	if !j.isPaused() && c.othersPaused(j) {
+		// Торрент остается у других владельцев, и все они на паузе
+		return c.action("torrent-stop", j.hash)
+	}
+	return nil
+}
+
+// ContentPath возвращает локальный путь к данным завершенной загрузки
+func (c *Client) ContentPath(downloadID string) (string, error) {
+	j, err := c.job(downloadID)
+	if err != nil {
+		return "", err
+	}
+	dir, name, done := j.location()
+	if !done {
+		return "", fmt.Errorf("download is not completed: %s", downloadID)
+	}
+	return c.localPath(filepath.Join(dir, name)), nil
+}
+
+// ReleaseJob прекращает отслеживание загрузки, не удаляя торрент из демона -
+// он продолжает раздаваться
+func (c *Client) ReleaseJob(downloadID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if j, ok := c.jobs[downloadID]; ok {
+		j.cancel()
+		delete(c.jobs, downloadID)
+	}
+}
+
+// DropTorrent снимает владельца с торрента. Если других владельцев нет, торрент удаляется
+// из демона (данные на диске остаются) и возвращается true.
+func (c *Client) DropTorrent(infoHash, owner string) bool {
+	infoHash = strings.ToLower(infoHash)
+	c.mu.Lock()
+	last := c.releaseOwner(infoHash, owner)
+	c.mu.Unlock()
+	if !last {
+		return false
+	}
+	if err := c.remove(infoHash); err != nil {
+		log.Printf("Failed to remove Transmission torrent %s: %v", infoHash, err)
+	}
+	return true
+}
+
+// releaseOwner снимает владельца с торрента и сообщает, был ли он последним. Торрент
+// без известных владельцев (например, после перезапуска сервера) считается свободным.
+// Вызывается под c.mu.
+func (c *Client) releaseOwner(hash, owner string) bool {
+	owners, ok := c.owners[hash]
+	if !ok {
+		return true
+	}
+	if _, ok := owners[owner]; !ok {
+		return false
+	}
+	delete(owners, owner)
+	if len(owners) > 0 {
+		return false
+	}
+	delete(c.owners, hash)
+	return true
+}
+
+// othersPaused сообщает, стоят ли на паузе все остальные загрузки того же торрента
+func (c *Client) othersPaused(except *job) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, j := range c.jobs {
+		if j != except && j.hash == except.hash && !j.isPaused() {
+			return false
+		}
+	}
+	return true
+}
+
+// isTracked сообщает, используется ли торрент какой-либо загрузкой
+func (c *Client) isTracked(hash string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.owners[hash]
+	return ok
+}
+
+func (c *Client) action(method, hash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	return c.rpc.action(ctx, method, hash)
+}
+
+func (c *Client) remove(hash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	return c.rpc.removeTorrent(ctx, hash, false)
+}
+
+// localPath переводит путь на стороне демона в путь, доступный этому серверу
+func (c *Client) localPath(remote string) string {
+	if c.config.LocalDir == "" {
+		return remote
+	}
+	base := c.config.DownloadDir
+	if base == "" {
+		base = c.daemonDir
+	}
+	rel, err := filepath.Rel(base, remote)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return remote
+	}
+	return filepath.Join(c.config.LocalDir, rel)
+}
+
+// run следит за торрентом загрузки: ждет метаданные, проверяет место на диске и
+// отправляет прогресс, пока загрузка не завершится
+func (c *Client) run(j *job) {
+	defer c.wg.Done()
+	defer close(j.progress)
+
+	completed := false
+	defer func() {
+		// Завершенная загрузка остается до ReleaseJob: менеджеру еще нужен путь к данным
+		if !completed {
+			c.mu.Lock()
+			if c.jobs[j.id] == j {
+				delete(c.jobs, j.id)
+			}
+			c.mu.Unlock()
+		}
+	}()
+
+	ticker := time.NewTicker(c.config.PollInterval)
+	defer ticker.Stop()
+
+	deadline := time.Now().Add(c.metadataTimeout)
+	admitted := false
+	for {
+		ctx, cancel := context.WithTimeout(j.ctx, rpcTimeout)
+		t, err := c.rpc.getTorrent(ctx, j.hash, progressFields)
+		cancel()
+
+		switch {
+		case j.ctx.Err() != nil:
+			log.Printf("Transmission download cancelled: %s", j.name)
+			return
+		case errors.Is(err, torrent.ErrTorrentNotFound):
+			// Торрент удалили из демона в обход сервера
+			c.failJob(j, err)
+			return
+		case err != nil:
+			// Демон может быть временно недоступен - пробуем на следующем опросе
+			log.Printf("Failed to get progress from Transmission: %v", err)
+		case t.MetadataPercentComplete < 1:
+			if time.Now().After(deadline) {
+				log.Printf("Timeout waiting for torrent info: %s", j.hash)
+				c.failJob(j, torrent.ErrMetadataTimeout)
+				return
+			}
+			c.send(j, j.update(t))
+		case t.Error == errorLocal:
+			log.Printf("Transmission download failed: %s: %s", t.Name, t.ErrorString)
+			c.failJob(j, fmt.Errorf("transmission: %s", t.ErrorString))
+			return
+		default:
+			j.setLocation(t.DownloadDir, t.Name, false)
+
+			if !admitted {
+				// Проверяем, можно ли продолжать загрузку (например, хватит ли места на диске)
+				admitted = true
+				c.mu.RLock()
+				admission := c.admission
+				c.mu.RUnlock()
+				if admission != nil {
+					if err := admission(j.id, c.localPath(t.DownloadDir), t.LeftUntilDone); err != nil {
+						log.Printf("Download rejected: %s: %v", t.Name, err)
+						c.failJob(j, err)
+						return
+					}
+				}
+			}
+
+			if t.LeftUntilDone == 0 && t.Status != statusCheckWait && t.Status != statusCheck {
+				log.Printf("Download completed: %s", t.Name)
+				j.setLocation(t.DownloadDir, t.Name, true)
+				update := j.update(t)
+				update.Status = "completed"
+				update.Progress = 100
+				select {
+				case j.progress <- update:
+					completed = true
+				case <-j.ctx.Done():
+				}
+				return
+			}
+			c.send(j, j.update(t))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-j.ctx.Done():
+			log.Printf("Transmission download cancelled: %s", j.name)
+			return
+		}
+	}
+}
+
+// send отправляет прогресс, не блокируясь на заполненном канале
+func (c *Client) send(j *job, update torrent.ProgressUpdate) {
+	select {
+	case j.progress <- update:
+	default:
+		// Канал заполнен, пропускаем обновление
+	}
+}
+
+// failJob сообщает об ошибке загрузки и удаляет торрент из демона, если он больше никому не нужен
+func (c *Client) failJob(j *job, err error) {
+	_, name, _ := j.location()
+	update := torrent.ProgressUpdate{
+		ID:        j.id,
+		InfoHash:  j.hash,
+		Name:      name,
+		Status:    "failed",
+		Error:     err.Error(),
+		Err:       err,
+		UpdatedAt: time.Now(),
+	}
+	select {
+	case j.progress <- update:
+	case <-j.ctx.Done():
+	}
+
+	c.mu.Lock()
+	last := c.releaseOwner(j.hash, j.owner)
+	c.mu.Unlock()
+	if last && !errors.Is(err, torrent.ErrTorrentNotFound) {
+		if err := c.remove(j.hash); err != nil {
+			log.Printf("Failed to remove Transmission torrent %s: %v", j.hash, err)
+		}
+	}
+}
@@ -0,0 +1,497 @@
+package transmission
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gamecloud/internal/config"
+	"gamecloud/internal/torrent"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const (
+	testHash   = "0123456789abcdef0123456789abcdef01234567"
+	testMagnet = "magnet:?xt=urn:btih:" + testHash + "&dn=Test+Game"
+	daemonDir  = "/var/lib/transmission/downloads"
+)
+
+// fakeDaemon - демон Transmission с одним торрентом, который меняет тест
+type fakeDaemon struct {
+	t *testing.T
+
+	mu        sync.Mutex
+	sessionID string
+	conflicts int                 // ответов 409
+	calls     []string            // методы в порядке вызова (кроме torrent-get)
+	args      []map[string]any    // аргументы вызовов из calls
+	torrent   rpcTorrent          // состояние торрента для torrent-get
+	present   bool                // торрент добавлен в демон
+	hashes    map[string][]string // ids вызовов torrent-start/stop/remove
+}
+
+func newFakeDaemon(t *testing.T) (*fakeDaemon, *httptest.Server) {
+	d := &fakeDaemon{
+		t:         t,
+		sessionID: "session-1",
+		hashes:    make(map[string][]string),
+		torrent: rpcTorrent{
+			HashString:              testHash,
+			Name:                    "Test Game",
+			DownloadDir:             daemonDir,
+			MetadataPercentComplete: 1,
+			SizeWhenDone:            1000,
+			LeftUntilDone:           1000,
+			Status:                  statusDownloadWait,
+		},
+	}
+	srv := httptest.NewServer(d)
+	t.Cleanup(srv.Close)
+	return d, srv
+}
+
+func (d *fakeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if r.Header.Get(sessionHeader) != d.sessionID {
+		d.conflicts++
+		w.Header().Set(sessionHeader, d.sessionID)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	var req struct {
+		Method    string         `json:"method"`
+		Arguments map[string]any `json:"arguments"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Method != "torrent-get" {
+		d.calls = append(d.calls, req.Method)
+		d.args = append(d.args, req.Arguments)
+	}
+
+	result := map[string]any{}
+	switch req.Method {
+	case "session-get":
+		result = map[string]any{"version": "4.0.5", "download-dir": daemonDir}
+	case "torrent-add":
+		key := "torrent-added"
+		if d.present {
+			key = "torrent-duplicate"
+		}
+		d.present = true
+		result[key] = addedTorrent{ID: 1, Name: d.torrent.Name, HashString: d.torrent.HashString}
+	case "torrent-get":
+		torrents := []rpcTorrent{}
+		if d.present {
+			torrents = append(torrents, d.torrent)
+		}
+		result["torrents"] = torrents
+	case "torrent-start", "torrent-stop", "torrent-verify", "torrent-remove":
+		for _, id := range req.Arguments["ids"].([]any) {
+			d.hashes[req.Method] = append(d.hashes[req.Method], id.(string))
+		}
+		switch req.Method {
+		case "torrent-start":
+			d.torrent.Status = statusDownload
+		case "torrent-stop":
+			d.torrent.Status = statusStopped
+		case "torrent-remove":
+			d.present = false
+		}
+	default:
+		json.NewEncoder(w).Encode(map[string]any{"result": "method name not recognized"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"result": "success", "arguments": result})
+}
+
+// setTorrent меняет состояние торрента, которое вернет следующий torrent-get
+func (d *fakeDaemon) setTorrent(fn func(t *rpcTorrent)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fn(&d.torrent)
+}
+
+func (d *fakeDaemon) rotateSession(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sessionID = id
+}
+
+// lastCall возвращает аргументы последнего вызова method
+func (d *fakeDaemon) lastCall(method string) map[string]any {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := len(d.calls) - 1; i >= 0; i-- {
+		if d.calls[i] == method {
+			return d.args[i]
+		}
+	}
+	d.t.Fatalf("%s was not called (calls: %v)", method, d.calls)
+	return nil
+}
+
+func (d *fakeDaemon) callCount(method string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.hashes[method])
+}
+
+func newTestClient(t *testing.T, srv *httptest.Server, cfg config.TransmissionConfig) *Client {
+	t.Helper()
+	cfg.URL = srv.URL + "/transmission/rpc"
+	cfg.PollInterval = 10 * time.Millisecond
+	c, err := NewClient(&cfg, &config.TorrentConfig{MetadataTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// nextUpdate ждет обновление прогресса, для которого cond возвращает true
+func nextUpdate(t *testing.T, progress chan torrent.ProgressUpdate, cond func(torrent.ProgressUpdate) bool) torrent.ProgressUpdate {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case update, ok := <-progress:
+			if !ok {
+				t.Fatal("progress channel closed")
+			}
+			if cond(update) {
+				return update
+			}
+		case <-timeout:
+			t.Fatal("expected progress update not received")
+		}
+	}
+}
+
+func testTorrentFile(t *testing.T) []byte {
+	t.Helper()
+	info := metainfo.Info{Name: "Test Game", PieceLength: 16 << 10, Length: 1000, Pieces: make([]byte, 20)}
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := (&metainfo.MetaInfo{InfoBytes: infoBytes}).Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSessionHandshake(t *testing.T) {
+	d, srv := newFakeDaemon(t)
+	c := newTestClient(t, srv, config.TransmissionConfig{})
+
+	// Первый запрос без идентификатора сессии получает 409 и повторяется с ним
+	if d.conflicts != 1 {
+		t.Fatalf("got %d conflicts during connect, want 1", d.conflicts)
+	}
+	if c.daemonDir != daemonDir {
+		t.Errorf("daemonDir = %q, want %q", c.daemonDir, daemonDir)
+	}
+
+	// Демон перезапустился с новой сессией - запрос повторяется с новым идентификатором
+	d.rotateSession("session-2")
+	if _, _, err := c.rpc.session(t.Context()); err != nil {
+		t.Fatalf("request after session change: %v", err)
+	}
+	if d.conflicts != 2 {
+		t.Fatalf("got %d conflicts, want 2", d.conflicts)
+	}
+}
+
+func TestRPCErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	cfg := config.TransmissionConfig{URL: srv.URL}
+	_, err := NewClient(&cfg, &config.TorrentConfig{})
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("err = %v, want HTTP 401", err)
+	}
+
+	_, daemon := newFakeDaemon(t)
+	c := newTestClient(t, daemon, config.TransmissionConfig{})
+	err = c.rpc.call(t.Context(), "no-such-method", nil, nil)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Method != "no-such-method" {
+		t.Fatalf("err = %v, want RPCError", err)
+	}
+}
+
+func TestAddTorrent(t *testing.T) {
+	torrentFile := testTorrentFile(t)
+
+	tests := []struct {
+		name  string
+		add   func(c *Client) (string, chan torrent.ProgressUpdate, error)
+		check func(t *testing.T, args map[string]any)
+	}{
+		{"magnet", func(c *Client) (string, chan torrent.ProgressUpdate, error) {
+			return c.AddMagnet(testMagnet, torrent.AddOptions{Owner: "a"})
+		}, func(t *testing.T, args map[string]any) {
+			if args["filename"] != testMagnet {
+				t.Errorf("filename = %v, want magnet link", args["filename"])
+			}
+		}},
+		{"metainfo", func(c *Client) (string, chan torrent.ProgressUpdate, error) {
+			return c.AddTorrentFile(bytes.NewReader(torrentFile), torrent.AddOptions{Owner: "a"})
+		}, func(t *testing.T, args map[string]any) {
+			data, err := base64.StdEncoding.DecodeString(fmt.Sprint(args["metainfo"]))
+			if err != nil || !bytes.Equal(data, torrentFile) {
+				t.Errorf("metainfo does not match the torrent file")
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, srv := newFakeDaemon(t)
+			c := newTestClient(t, srv, config.TransmissionConfig{DownloadDir: "/data/games"})
+
+			id, progress, err := tt.add(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			args := d.lastCall("torrent-add")
+			tt.check(t, args)
+			if args["download-dir"] != "/data/games" {
+				t.Errorf("download-dir = %v", args["download-dir"])
+			}
+			if hash, _ := c.InfoHash(id); hash != testHash {
+				t.Errorf("InfoHash = %q, want %q", hash, testHash)
+			}
+			nextUpdate(t, progress, func(u torrent.ProgressUpdate) bool { return u.ID == id })
+
+			// Повторное добавление того же торрента запускает его в демоне
+			if _, _, err := tt.add(c); err != nil {
+				t.Fatal(err)
+			}
+			if d.callCount("torrent-start") != 1 {
+				t.Errorf("duplicate torrent was not started")
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		_, srv := newFakeDaemon(t)
+		c := newTestClient(t, srv, config.TransmissionConfig{})
+		if _, _, err := c.AddTorrentFile(bytes.NewReader([]byte("not a torrent")), torrent.AddOptions{}); !errors.Is(err, torrent.ErrInvalidTorrent) {
+			t.Errorf("AddTorrentFile err = %v, want ErrInvalidTorrent", err)
+		}
+		if _, _, err := c.AddMagnet("magnet:?dn=no-hash", torrent.AddOptions{}); err == nil {
+			t.Error("AddMagnet without info hash succeeded")
+		}
+	})
+}
+
+func TestStartStopRemove(t *testing.T) {
+	d, srv := newFakeDaemon(t)
+	c := newTestClient(t, srv, config.TransmissionConfig{})
+
+	first, progress, err := c.AddMagnet(testMagnet, torrent.AddOptions{Owner: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := c.AddMagnet(testMagnet, torrent.AddOptions{Owner: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	starts := d.callCount("torrent-start")
+
+	// Общий торрент останавливается, только когда на паузе все владельцы
+	if err := c.PauseDownload(first); err != nil {
+		t.Fatal(err)
+	}
+	if d.callCount("torrent-stop") != 0 {
+		t.Fatal("shared torrent stopped while another download is active")
+	}
+	if err := c.PauseDownload(second); err != nil {
+		t.Fatal(err)
+	}
+	if d.callCount("torrent-stop") != 1 {
+		t.Fatal("torrent-stop was not sent")
+	}
+	nextUpdate(t, progress, func(u torrent.ProgressUpdate) bool { return u.Status == "paused" })
+
+	if err := c.ResumeDownload(first); err != nil {
+		t.Fatal(err)
+	}
+	if d.callCount("torrent-start") != starts+1 {
+		t.Fatal("torrent-start was not sent")
+	}
+
+	// Торрент удаляется из демона вместе с последним владельцем, данные остаются
+	if err := c.CancelDownload(first); err != nil {
+		t.Fatal(err)
+	}
+	if d.callCount("torrent-remove") != 0 {
+		t.Fatal("torrent removed while another download uses it")
+	}
+	if err := c.CancelDownload(second); err != nil {
+		t.Fatal(err)
+	}
+	if d.callCount("torrent-remove") != 1 {
+		t.Fatal("torrent-remove was not sent")
+	}
+	if args := d.lastCall("torrent-remove"); args["delete-local-data"] != false {
+		t.Errorf("delete-local-data = %v, want false", args["delete-local-data"])
+	}
+	if _, err := c.InfoHash(first); err == nil {
+		t.Error("cancelled download is still tracked")
+	}
+}
+
+func TestProgressMapping(t *testing.T) {
+	j := &job{id: "job", hash: testHash}
+	base := rpcTorrent{Name: "Test Game", SizeWhenDone: 1000, LeftUntilDone: 400, PercentDone: 0.6,
+		RateDownload: 2048, RateUpload: 512, ETA: 30, PeersConnected: 5, PeersSendingToUs: 3, WebseedsSendingToUs: 1}
+
+	tests := []struct {
+		name    string
+		modify  func(t *rpcTorrent)
+		paused  bool
+		status  string
+		eta     int64
+		checked float64
+	}{
+		{"downloading", func(t *rpcTorrent) { t.Status = statusDownload }, false, "downloading", 30, 0},
+		{"queued", func(t *rpcTorrent) { t.Status = statusDownloadWait }, false, "waiting", 30, 0},
+		{"no data yet", func(t *rpcTorrent) { t.Status = statusDownload; t.LeftUntilDone = 1000 }, false, "waiting", 30, 0},
+		{"stopped", func(t *rpcTorrent) { t.Status = statusStopped }, false, "paused", 30, 0},
+		{"paused by user", func(t *rpcTorrent) { t.Status = statusDownload }, true, "paused", 30, 0},
+		{"checking", func(t *rpcTorrent) { t.Status = statusCheck; t.RecheckProgress = 0.25 }, false, "checking", 30, 25},
+		{"unknown eta", func(t *rpcTorrent) { t.Status = statusDownload; t.ETA = -1 }, false, "downloading", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := base
+			tt.modify(&rt)
+			j.setPaused(tt.paused)
+
+			u := j.update(&rt)
+			if u.Status != tt.status || u.ETA != tt.eta || u.Checked != tt.checked {
+				t.Errorf("status %q eta %d checked %v, want %q %d %v", u.Status, u.ETA, u.Checked, tt.status, tt.eta, tt.checked)
+			}
+			if u.ID != "job" || u.InfoHash != testHash || u.Name != "Test Game" {
+				t.Errorf("identity fields not mapped: %+v", u)
+			}
+			if u.Size != 1000 || u.Downloaded != rt.SizeWhenDone-rt.LeftUntilDone || u.Progress != rt.PercentDone*100 {
+				t.Errorf("size %d downloaded %d progress %v", u.Size, u.Downloaded, u.Progress)
+			}
+			if u.DownloadRate != 2048 || u.UploadRate != 512 || u.Peers != 5 || u.Seeds != 3 || u.WebSeeds != 1 {
+				t.Errorf("rates or peers not mapped: %+v", u)
+			}
+		})
+	}
+}
+
+func TestDownloadCompletes(t *testing.T) {
+	d, srv := newFakeDaemon(t)
+	local := t.TempDir()
+	c := newTestClient(t, srv, config.TransmissionConfig{LocalDir: local})
+
+	var admittedDir string
+	var admittedSize int64
+	c.SetAdmissionCheck(func(downloadID, dir string, size int64) error {
+		admittedDir, admittedSize = dir, size
+		return nil
+	})
+
+	id, progress, err := c.AddMagnet(testMagnet, torrent.AddOptions{Owner: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextUpdate(t, progress, func(u torrent.ProgressUpdate) bool { return u.Status == "waiting" })
+
+	d.setTorrent(func(t *rpcTorrent) {
+		t.Status = statusDownload
+		t.LeftUntilDone = 500
+		t.PercentDone = 0.5
+	})
+	nextUpdate(t, progress, func(u torrent.ProgressUpdate) bool { return u.Status == "downloading" && u.Downloaded == 500 })
+
+	d.setTorrent(func(t *rpcTorrent) {
+		t.Status = statusSeed
+		t.LeftUntilDone = 0
+		t.PercentDone = 1
+	})
+	final := nextUpdate(t, progress, func(u torrent.ProgressUpdate) bool { return u.Status == "completed" })
+	if final.Progress != 100 || final.Downloaded != 1000 {
+		t.Errorf("final update %+v", final)
+	}
+
+	if admittedDir != local || admittedSize != 1000 {
+		t.Errorf("admission got dir %q size %d, want %q 1000", admittedDir, admittedSize, local)
+	}
+	// Путь демона переводится в локальный
+	path, err := c.ContentPath(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(local, "Test Game"); path != want {
+		t.Errorf("ContentPath = %q, want %q", path, want)
+	}
+}
+
+func TestDownloadFails(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(d *fakeDaemon)
+		want   error
+	}{
+		{"local error", func(d *fakeDaemon) {
+			d.setTorrent(func(t *rpcTorrent) { t.Error = errorLocal; t.ErrorString = "No space left on device" })
+		}, nil},
+		{"removed from daemon", func(d *fakeDaemon) {
+			d.mu.Lock()
+			d.present = false
+			d.mu.Unlock()
+		}, torrent.ErrTorrentNotFound},
+		{"metadata timeout", func(d *fakeDaemon) {
+			d.setTorrent(func(t *rpcTorrent) { t.MetadataPercentComplete = 0.5 })
+		}, torrent.ErrMetadataTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, srv := newFakeDaemon(t)
+			c := newTestClient(t, srv, config.TransmissionConfig{})
+			_, progress, err := c.AddMagnet(testMagnet, torrent.AddOptions{Owner: "a"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.modify(d)
+
+			failed := nextUpdate(t, progress, func(u torrent.ProgressUpdate) bool { return u.Status == "failed" })
+			if tt.want != nil && !errors.Is(failed.Err, tt.want) {
+				t.Errorf("err = %v, want %v", failed.Err, tt.want)
+			}
+			if failed.Error == "" {
+				t.Error("failed update has no error text")
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package transmission
+
+import (
+	"context"
+	"gamecloud/internal/torrent"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// InspectTorrentFile разбирает .torrent файл без добавления его в демон
+func (c *Client) InspectTorrentFile(torrentFile io.Reader) (*torrent.TorrentPreview, error) {
+	return torrent.PreviewTorrentFile(torrentFile)
+}
+
+// InspectTorrentURL скачивает .torrent файл по URL и разбирает его
+func (c *Client) InspectTorrentURL(ctx context.Context, torrentURL string) (*torrent.TorrentPreview, error) {
+	mi, err := torrent.FetchMetainfo(ctx, http.DefaultClient, torrentURL)
+	if err != nil {
+		return nil, err
+	}
+	return torrent.PreviewMetainfo(mi)
+}
+
+// InspectMagnet получает метаданные по magnet-ссылке через демон. Добавленный для этого
+// торрент сразу удаляется вместе с тем немногим, что он успел скачать. Если торрент уже
+// есть в демоне, используется его информация.
+func (c *Client) InspectMagnet(ctx context.Context, magnetLink string) (*torrent.TorrentPreview, error) {
+	if _, err := torrent.MagnetName(magnetLink); err != nil {
+		return nil, err
+	}
+
+	args := map[string]interface{}{"filename": magnetLink}
+	if c.config.DownloadDir != "" {
+		args["download-dir"] = c.config.DownloadDir
+	}
+	added, duplicate, err := c.rpc.addTorrent(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	hash := strings.ToLower(added.HashString)
+	if !duplicate {
+		defer func() {
+			// Пока шла проверка, тот же торрент мог быть добавлен как настоящая загрузка
+			if c.isTracked(hash) {
+				return
+			}
+			removeCtx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+			defer cancel()
+			if err := c.rpc.removeTorrent(removeCtx, hash, true); err != nil {
+				log.Printf("Failed to remove inspected Transmission torrent %s: %v", hash, err)
+			}
+		}()
+	}
+
+	timer := time.NewTimer(c.metadataTimeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(c.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		t, err := c.rpc.getTorrent(ctx, hash, inspectFields)
+		if err != nil {
+			return nil, err
+		}
+		if t.MetadataPercentComplete >= 1 {
+			return buildPreview(t), nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			return nil, torrent.ErrMetadataTimeout
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// buildPreview собирает предпросмотр из полей торрента Transmission
+func buildPreview(t *rpcTorrent) *torrent.TorrentPreview {
+	// Transmission отдает пути файлов вместе с именем торрента в начале
+	info := metainfo.Info{Name: t.Name, PieceLength: t.PieceSize}
+	if len(t.Files) == 1 && t.Files[0].Name == t.Name {
+		info.Length = t.Files[0].Length
+	} else {
+		for _, f := range t.Files {
+			parts := strings.Split(f.Name, "/")
+			if len(parts) > 1 && parts[0] == t.Name {
+				parts = parts[1:]
+			}
+			info.Files = append(info.Files, metainfo.FileInfo{Length: f.Length, Path: parts})
+		}
+	}
+
+	preview := &torrent.TorrentPreview{
+		Name:       t.Name,
+		InfoHash:   strings.ToLower(t.HashString),
+		TotalSize:  t.TotalSize,
+		PieceSize:  t.PieceSize,
+		NumPieces:  t.PieceCount,
+		Private:    t.IsPrivate,
+		Trackers:   make([]string, 0, len(t.Trackers)),
+		WebSeeds:   append([]string{}, t.Webseeds...),
+		Comment:    t.Comment,
+		CreatedBy:  t.Creator,
+		MagnetLink: t.MagnetLink,
+	}
+	seen := make(map[string]bool)
+	for _, tr := range t.Trackers {
+		if tr.Announce != "" && !seen[tr.Announce] {
+			seen[tr.Announce] = true
+			preview.Trackers = append(preview.Trackers, tr.Announce)
+		}
+	}
+	if t.DateCreated > 0 {
+		created := time.Unix(t.DateCreated, 0)
+		preview.CreationDate = &created
+	}
+	preview.Files, preview.NumFiles = torrent.FileTree(&info)
+	return preview
+}
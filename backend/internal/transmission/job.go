@@ -0,0 +1,88 @@
+package transmission
+
+import (
+	"context"
+	"gamecloud/internal/torrent"
+	"sync"
+	"time"
+)
+
+// job - загрузка, которой соответствует торрент в демоне
+type job struct {
+	id       string
+	hash     string
+	owner    string
+	progress chan torrent.ProgressUpdate
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	mu     sync.Mutex
+	paused bool
+	name   string
+	dir    string // директория данных на стороне демона
+	done   bool
+}
+
+func (j *job) setPaused(paused bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.paused = paused
+}
+
+func (j *job) isPaused() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.paused
+}
+
+func (j *job) setLocation(dir, name string, done bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.dir, j.name, j.done = dir, name, done
+}
+
+// location возвращает директорию и имя данных торрента и завершена ли загрузка
+func (j *job) location() (string, string, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.dir, j.name, j.done
+}
+
+// update переводит состояние торрента Transmission в прогресс загрузки
+func (j *job) update(t *rpcTorrent) torrent.ProgressUpdate {
+	status := "waiting"
+	switch {
+	case t.Status == statusCheckWait || t.Status == statusCheck:
+		status = "checking"
+	case j.isPaused() || t.Status == statusStopped:
+		status = "paused"
+	case t.Status == statusDownload && t.SizeWhenDone-t.LeftUntilDone > 0:
+		status = "downloading"
+	}
+
+	eta := t.ETA
+	if eta < 0 {
+		eta = 0
+	}
+
+	update := torrent.ProgressUpdate{
+		ID:           j.id,
+		InfoHash:     j.hash,
+		Name:         t.Name,
+		Size:         t.SizeWhenDone,
+		Downloaded:   t.SizeWhenDone - t.LeftUntilDone,
+		DownloadRate: float64(t.RateDownload),
+		UploadRate:   float64(t.RateUpload),
+		Progress:     t.PercentDone * 100,
+		Status:       status,
+		ETA:          eta,
+		Peers:        t.PeersConnected,
+		Seeds:        t.PeersSendingToUs,
+		WebSeeds:     t.WebseedsSendingToUs,
+		UpdatedAt:    time.Now(),
+	}
+	if status == "checking" {
+		update.Checked = t.RecheckProgress * 100
+	}
+	return update
+}
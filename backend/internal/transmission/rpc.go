@@ -0,0 +1,114 @@
+package transmission
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Заголовок защиты от CSRF: демон отвечает 409 с новым идентификатором сессии,
+// и запрос нужно повторить с ним
+const sessionHeader = "X-Transmission-Session-Id"
+
+// RPCError - демон выполнил запрос с ошибкой
+type RPCError struct {
+	Method string
+	Result string
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("transmission %s: %s", e.Method, e.Result)
+}
+
+// HTTPStatusError - RPC ответил неуспешным HTTP статусом (например, 401 при неверном пароле)
+type HTTPStatusError struct {
+	StatusCode int
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("transmission RPC: HTTP %d", e.StatusCode)
+}
+
+// rpcClient выполняет запросы Transmission RPC
+type rpcClient struct {
+	url        string
+	username   string
+	password   string
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	sessionID string
+}
+
+type rpcRequest struct {
+	Method    string      `json:"method"`
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+type rpcResponse struct {
+	Result    string          `json:"result"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// call выполняет метод RPC и разбирает аргументы ответа в result (если он не nil)
+func (r *rpcClient) call(ctx context.Context, method string, args interface{}, result interface{}) error {
+	body, err := json.Marshal(rpcRequest{Method: method, Arguments: args})
+	if err != nil {
+		return err
+	}
+
+	// Второй попытки хватает: после 409 идентификатор сессии уже актуален
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("transmission %s: %w", method, err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		r.mu.Lock()
+		if r.sessionID != "" {
+			req.Header.Set(sessionHeader, r.sessionID)
+		}
+		r.mu.Unlock()
+		if r.username != "" || r.password != "" {
+			req.SetBasicAuth(r.username, r.password)
+		}
+
+		resp, err := r.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("transmission %s: %w", method, err)
+		}
+
+		if resp.StatusCode == http.StatusConflict {
+			resp.Body.Close()
+			r.mu.Lock()
+			r.sessionID = resp.Header.Get(sessionHeader)
+			r.mu.Unlock()
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return &HTTPStatusError{StatusCode: resp.StatusCode}
+		}
+
+		var decoded rpcResponse
+		err = json.NewDecoder(resp.Body).Decode(&decoded)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("transmission %s: invalid response: %w", method, err)
+		}
+		if decoded.Result != "success" {
+			return &RPCError{Method: method, Result: decoded.Result}
+		}
+		if result != nil && len(decoded.Arguments) > 0 {
+			if err := json.Unmarshal(decoded.Arguments, result); err != nil {
+				return fmt.Errorf("transmission %s: invalid response: %w", method, err)
+			}
+		}
+		return nil
+	}
+
+	return &HTTPStatusError{StatusCode: http.StatusConflict}
+}
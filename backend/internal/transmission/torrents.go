@@ -0,0 +1,144 @@
+package transmission
+
+import (
+	"context"
+	"fmt"
+	"gamecloud/internal/torrent"
+)
+
+// Состояния торрента в Transmission (поле status)
+const (
+	statusStopped      = 0
+	statusCheckWait    = 1
+	statusCheck        = 2
+	statusDownloadWait = 3
+	statusDownload     = 4
+	statusSeedWait     = 5
+	statusSeed         = 6
+)
+
+// errorLocal - ошибка на стороне демона (например, нет доступа к директории). Ошибки
+// трекеров (1 и 2) не мешают загрузке и не считаются ошибкой задачи.
+const errorLocal = 3
+
+// rpcTorrent - поля торрента из ответа torrent-get
+type rpcTorrent struct {
+	ID                      int     `json:"id"`
+	HashString              string  `json:"hashString"`
+	Name                    string  `json:"name"`
+	Status                  int     `json:"status"`
+	Error                   int     `json:"error"`
+	ErrorString             string  `json:"errorString"`
+	DownloadDir             string  `json:"downloadDir"`
+	MetadataPercentComplete float64 `json:"metadataPercentComplete"`
+	PercentDone             float64 `json:"percentDone"`
+	RecheckProgress         float64 `json:"recheckProgress"`
+	SizeWhenDone            int64   `json:"sizeWhenDone"`
+	LeftUntilDone           int64   `json:"leftUntilDone"`
+	RateDownload            int64   `json:"rateDownload"`
+	RateUpload              int64   `json:"rateUpload"`
+	ETA                     int64   `json:"eta"` // -1 - неизвестно, -2 - бесконечно
+	PeersConnected          int     `json:"peersConnected"`
+	PeersSendingToUs        int     `json:"peersSendingToUs"`
+	WebseedsSendingToUs     int     `json:"webseedsSendingToUs"`
+
+	// Поля для предпросмотра (см. inspect.go)
+	TotalSize   int64        `json:"totalSize"`
+	PieceSize   int64        `json:"pieceSize"`
+	PieceCount  int          `json:"pieceCount"`
+	Files       []rpcFile    `json:"files"`
+	Trackers    []rpcTracker `json:"trackers"`
+	Webseeds    []string     `json:"webseeds"`
+	Comment     string       `json:"comment"`
+	Creator     string       `json:"creator"`
+	DateCreated int64        `json:"dateCreated"`
+	IsPrivate   bool         `json:"isPrivate"`
+	MagnetLink  string       `json:"magnetLink"`
+}
+
+type rpcFile struct {
+	Name   string `json:"name"` // путь с именем торрента в начале для многофайловых торрентов
+	Length int64  `json:"length"`
+}
+
+type rpcTracker struct {
+	Announce string `json:"announce"`
+}
+
+// Поля, нужные для прогресса загрузки
+var progressFields = []string{
+	"id", "hashString", "name", "status", "error", "errorString", "downloadDir",
+	"metadataPercentComplete", "percentDone", "recheckProgress", "sizeWhenDone", "leftUntilDone",
+	"rateDownload", "rateUpload", "eta", "peersConnected", "peersSendingToUs", "webseedsSendingToUs",
+}
+
+// Поля, нужные для предпросмотра торрента
+var inspectFields = []string{
+	"hashString", "name", "metadataPercentComplete", "totalSize", "pieceSize", "pieceCount",
+	"files", "trackers", "webseeds", "comment", "creator", "dateCreated", "isPrivate", "magnetLink",
+}
+
+// addedTorrent - ответ torrent-add
+type addedTorrent struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	HashString string `json:"hashString"`
+}
+
+// addTorrent добавляет торрент. duplicate - торрент уже был в демоне.
+func (r *rpcClient) addTorrent(ctx context.Context, args map[string]interface{}) (*addedTorrent, bool, error) {
+	var result struct {
+		Added     *addedTorrent `json:"torrent-added"`
+		Duplicate *addedTorrent `json:"torrent-duplicate"`
+	}
+	if err := r.call(ctx, "torrent-add", args, &result); err != nil {
+		return nil, false, err
+	}
+	switch {
+	case result.Added != nil:
+		return result.Added, false, nil
+	case result.Duplicate != nil:
+		return result.Duplicate, true, nil
+	}
+	return nil, false, &RPCError{Method: "torrent-add", Result: "no torrent in response"}
+}
+
+// getTorrent возвращает торрент по info hash
+func (r *rpcClient) getTorrent(ctx context.Context, hash string, fields []string) (*rpcTorrent, error) {
+	var result struct {
+		Torrents []rpcTorrent `json:"torrents"`
+	}
+	args := map[string]interface{}{"ids": []string{hash}, "fields": fields}
+	if err := r.call(ctx, "torrent-get", args, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Torrents) == 0 {
+		return nil, fmt.Errorf("%w: %s", torrent.ErrTorrentNotFound, hash)
+	}
+	return &result.Torrents[0], nil
+}
+
+// action выполняет torrent-start, torrent-stop или torrent-verify
+func (r *rpcClient) action(ctx context.Context, method, hash string) error {
+	return r.call(ctx, method, map[string]interface{}{"ids": []string{hash}}, nil)
+}
+
+// removeTorrent удаляет торрент из демона; данные на диске удаляются, только если deleteData
+func (r *rpcClient) removeTorrent(ctx context.Context, hash string, deleteData bool) error {
+	return r.call(ctx, "torrent-remove", map[string]interface{}{
+		"ids":               []string{hash},
+		"delete-local-data": deleteData,
+	}, nil)
+}
+
+// session возвращает версию демона и его директорию загрузок по умолчанию
+func (r *rpcClient) session(ctx context.Context) (version, downloadDir string, err error) {
+	var result struct {
+		Version     string `json:"version"`
+		DownloadDir string `json:"download-dir"`
+	}
+	if err := r.call(ctx, "session-get", nil, &result); err != nil {
+		return "", "", err
+	}
+	return result.Version, result.DownloadDir, nil
+}
@@ -1,11 +1,13 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
 	"gamecloud/internal/torrent"
 	"log"
 	"net/http"
 	"sync"
+	"time"
 	"fmt"
 
 	"github.com/gin-gonic/gin"
@@ -46,6 +48,12 @@ type ProgressMessage struct {
 	Data torrent.ProgressUpdate  `json:"data"`
 }
 
+// Message представляет произвольное типизированное сообщение для клиента
+type Message struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
 // NewHub создаёт новый WebSocket hub
 func NewHub(jwtSecret string) *Hub {
 	return &Hub{
@@ -154,6 +162,22 @@ func (h *Hub) BroadcastProgress(userID string, progress torrent.ProgressUpdate)
 		return
 	}
 	
+	h.sendToUser(userID, data)
+}
+
+// BroadcastMessage отправляет пользователю сообщение указанного типа
+func (h *Hub) BroadcastMessage(userID string, messageType string, payload interface{}) {
+	data, err := json.Marshal(Message{Type: messageType, Data: payload})
+	if err != nil {
+		log.Printf("Error marshaling %s message: %v", messageType, err)
+		return
+	}
+
+	h.sendToUser(userID, data)
+}
+
+// sendToUser рассылает готовое сообщение всем соединениям пользователя
+func (h *Hub) sendToUser(userID string, data []byte) {
 	h.mu.RLock()
 	clients := h.userClients[userID]
 	h.mu.RUnlock()
@@ -167,6 +191,44 @@ func (h *Hub) BroadcastProgress(userID string, progress torrent.ProgressUpdate)
 	}
 }
 
+// Shutdown предупреждает всех клиентов об остановке сервера и закрывает соединения.
+// Сообщение пишется напрямую, минуя очередь клиента, чтобы успеть до закрытия; запись
+// ограничена дедлайном ctx.
+func (h *Hub) Shutdown(ctx context.Context) {
+	data, err := json.Marshal(Message{
+		Type: "server_shutdown",
+		Data: map[string]string{"message": "Server is shutting down"},
+	})
+	if err != nil {
+		log.Printf("Error marshaling server_shutdown message: %v", err)
+		return
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client)
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		client.mu.Lock()
+		client.conn.SetWriteDeadline(deadline)
+		if err := client.conn.WriteMessage(websocket.TextMessage, data); err == nil {
+			client.conn.WriteMessage(websocket.CloseMessage, closeMessage)
+		}
+		client.mu.Unlock()
+		// readPump получит ошибку чтения и отключит клиента от hub'а
+		client.conn.Close()
+	}
+	log.Printf("WebSocket: Notified %d clients about shutdown", len(clients))
+}
+
 // HandleWebSocket обрабатывает WebSocket подключения
 func (h *Hub) HandleWebSocket(c *gin.Context) {
 	log.Printf("WebSocket: Connection attempt from %s", c.ClientIP())
@@ -1,13 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"gamecloud/internal/api"
 	"gamecloud/internal/config"
 	"gamecloud/internal/database"
+	"gamecloud/internal/direct"
 	"gamecloud/internal/download"
+	"gamecloud/internal/hooks"
 	"gamecloud/internal/torrent"
+	"gamecloud/internal/transmission"
 	websocketPkg "gamecloud/internal/websocket"
 
 	"github.com/gin-gonic/gin"
@@ -24,24 +33,46 @@ func main() {
 	}
 	log.Println("Database initialized successfully")
 
-	// Initialize torrent client
-	log.Println("Initializing torrent client...")
-	torrentClient, err := torrent.NewClient(&cfg.TorrentConfig)
-	if err != nil {
-		log.Fatal("Failed to initialize torrent client:", err)
+	// Initialize torrent client: встроенный или внешний демон Transmission
+	var backend download.Backend
+	var httpClient *http.Client
+	switch cfg.TorrentConfig.Backend {
+	case "embedded":
+		log.Println("Initializing torrent client...")
+		torrentClient, err := torrent.NewClient(&cfg.TorrentConfig)
+		if err != nil {
+			log.Fatal("Failed to initialize torrent client:", err)
+		}
+		log.Println("Torrent client initialized successfully")
+		backend = torrentClient
+		// Прямые HTTP(S) загрузки идут через тот же прокси, что и торренты
+		httpClient = torrentClient.HTTPClient()
+	case "transmission":
+		log.Println("Connecting to Transmission...")
+		transmissionClient, err := transmission.NewClient(&cfg.Transmission, &cfg.TorrentConfig)
+		if err != nil {
+			log.Fatal("Failed to initialize Transmission client:", err)
+		}
+		backend = transmissionClient
+	default:
+		log.Fatalf("Unknown TORRENT_BACKEND %q: expected embedded or transmission", cfg.TorrentConfig.Backend)
 	}
-	log.Println("Torrent client initialized successfully")
-	defer torrentClient.Close()
+
+	directClient := direct.NewClient(&cfg.Direct, httpClient)
 
 	// Initialize WebSocket hub
 	wsHub := websocketPkg.NewHub(cfg.JWTSecret)
 	go wsHub.Run()
 
 	// Initialize download manager with torrent client
-	downloadManager := download.NewManager(torrentClient, db, cfg)
+	downloadManager := download.NewManager(backend, db, cfg)
 	downloadManager.SetWebSocketHub(wsHub) // Подключаем WebSocket hub
+	downloadManager.SetDirectClient(directClient)
+
+	// Хуки на события загрузок (скрипты и webhook)
+	hookDispatcher := hooks.NewDispatcher(db)
+	downloadManager.SetHookDispatcher(hookDispatcher)
 	downloadManager.Start()
-	defer downloadManager.Stop()
 
 	// Setup API routes
 	router := gin.Default()
@@ -52,6 +83,66 @@ func main() {
 	api.SetupRoutes(router, db, downloadManager, cfg, wsHub)
 
 	// Start server
-	log.Printf("Starting server on port %s", cfg.Port)
-	log.Fatal(router.Run(":" + cfg.Port))
+	srv := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: router,
+	}
+	go func() {
+		log.Printf("Starting server on port %s", cfg.Port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	// Ждем SIGINT/SIGTERM; повторный сигнал завершает процесс сразу
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+	log.Printf("Shutting down (timeout %s)...", cfg.ShutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		// Перестаем принимать запросы. Текущим дается половина времени, чтобы на
+		// сохранение загрузок его осталось достаточно; долгие запросы (стриминг) обрываются.
+		httpCtx, cancelHTTP := context.WithTimeout(shutdownCtx, cfg.ShutdownTimeout/2)
+		defer cancelHTTP()
+		if err := srv.Shutdown(httpCtx); err != nil {
+			log.Printf("HTTP server shutdown: %v", err)
+			srv.Close()
+		}
+
+		// WebSocket соединения не отслеживаются http.Server - закрываем их сами
+		wsHub.Shutdown(shutdownCtx)
+
+		// Сохраняем прогресс загрузок, затем закрываем клиенты: торренты записывают
+		// состояние для быстрого возобновления, прямые загрузки - смещения частей
+		downloadManager.Stop()
+		// Хукам - не больше четверти времени: повторы отменяются, зависшие попытки
+		// прерываются, чтобы успеть закрыть клиенты и БД
+		hooksCtx, cancelHooks := context.WithTimeout(shutdownCtx, cfg.ShutdownTimeout/4)
+		if err := hookDispatcher.Wait(hooksCtx); err != nil {
+			log.Printf("Hooks did not finish before shutdown: %v", err)
+		}
+		cancelHooks()
+		directClient.Close()
+		if err := backend.Close(); err != nil {
+			log.Printf("Failed to close torrent client: %v", err)
+		}
+
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}()
+
+	select {
+	case <-done:
+		log.Println("Server stopped")
+	case <-shutdownCtx.Done():
+		log.Fatalf("Shutdown did not finish in %s, exiting", cfg.ShutdownTimeout)
+	}
 }